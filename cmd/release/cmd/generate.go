@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/go-github/v90/github"
+	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/k3s"
 	"github.com/rancher/ecm-distro-tools/release/kdm"
@@ -37,6 +38,10 @@ var (
 
 	releaseNotesAlert string
 
+	k3sGenerateTagsDocker   bool
+	k3sGenerateTagsContinue bool
+	k3sGenerateTagsAbort    bool
+
 	concurrencyLimit                      int
 	imagesListURL                         string
 	registry                              string
@@ -109,12 +114,18 @@ var k3sGenerateTagsSubCmd = &cobra.Command{
 		if !found {
 			return NewVersionNotFoundError(version, "k3s")
 		}
+		switch {
+		case k3sGenerateTagsContinue:
+			return k3s.ContinueTags(&k3sRelease, rootConfig.User)
+		case k3sGenerateTagsAbort:
+			return k3s.AbortTags(&k3sRelease)
+		}
 		ctx := context.Background()
 		ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
 		if err != nil {
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
-		return k3s.GenerateTags(ctx, ghClient, &k3sRelease, rootConfig.User, rootConfig.Auth.SSHKeyPath)
+		return k3s.GenerateTags(ctx, ghClient, &k3sRelease, rootConfig.User, rootConfig.Auth.SSHKeyPath, k3sGenerateTagsDocker)
 	},
 }
 
@@ -201,7 +212,18 @@ var rancherGenerateImagesLocationsSubCmd = &cobra.Command{
 			checkImages = append(checkImages, rancherImages...)
 		}
 
-		imagesLocations, err := rancher.ImagesLocations(username, password, concurrencyLimit, checkImages, ignoreImages, registry, registries)
+		target, err := rancherRegistryClient(registry)
+		if err != nil {
+			return err
+		}
+		sources := make([]*reg.Client, len(registries))
+		for i, source := range registries {
+			if sources[i], err = rancherRegistryClient(source); err != nil {
+				return err
+			}
+		}
+
+		imagesLocations, err := reg.ImagesLocations(context.Background(), target, sources, concurrencyLimit, checkImages, ignoreImages)
 		if err != nil {
 			return err
 		}
@@ -231,7 +253,12 @@ var rancherGenerateMissingImagesListSubCmd = &cobra.Command{
 			checkImages = append(checkImages, rancherImages...)
 		}
 
-		missingImages, err := rancher.MissingImagesFromRegistry(username, password, registry, concurrencyLimit, checkImages, ignoreImages)
+		client, err := rancherRegistryClient(registry)
+		if err != nil {
+			return err
+		}
+
+		missingImages, err := client.MissingImages(context.Background(), concurrencyLimit, checkImages, ignoreImages)
 		if err != nil {
 			return err
 		}
@@ -259,15 +286,32 @@ var rancherGenerateDockerImagesDigestsSubCmd = &cobra.Command{
 		if len(rancherImagesDigestsImages) == 0 && rancherImagesDigestsImagesURL == "" {
 			return errors.New("either --images-list or --images-url must be provided")
 		}
-		return rancher.GenerateDockerImageDigests(rancherImagesDigestsOutputFile, rancherImagesDigestsImagesURL, rancherImagesDigestsRegistry, username, password, rancherImagesDigestsImages, verbose)
+		client, err := rancherRegistryClient(rancherImagesDigestsRegistry)
+		if err != nil {
+			return err
+		}
+		return rancher.GenerateDockerImageDigests(context.Background(), rancherImagesDigestsOutputFile, rancherImagesDigestsImagesURL, client, rancherImagesDigestsImages)
 	},
 }
 
+// rancherRegistryClient returns a client for registry, authenticated with
+// the --username and --password flags if they're set.
+func rancherRegistryClient(registry string) (*reg.Client, error) {
+	client, err := newRegistryClient(registry)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		client.SetCredentials(username, password)
+	}
+	return client, nil
+}
+
 var rancherGenerateImagesSyncConfigSubCmd = &cobra.Command{
 	Use:   "images-sync-config",
 	Short: "Generate a regsync config file for images sync",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return rancher.GenerateImagesSyncConfig(rancherSyncImages, rancherSourceRegistry, rancherTargetRegistry, rancherSyncConfigOutputPath)
+		return rancher.GenerateImagesSyncConfig(rancherSyncImages, rancherSourceRegistry, rancherTargetRegistry, rootConfig.RegistryDefinitions(), rancherSyncConfigOutputPath)
 	},
 }
 
@@ -445,6 +489,10 @@ func init() {
 
 	k3sGenerateSubCmd.AddCommand(k3sGenerateReleaseNotesSubCmd)
 	k3sGenerateSubCmd.AddCommand(k3sGenerateTagsSubCmd)
+	k3sGenerateTagsSubCmd.Flags().BoolVar(&k3sGenerateTagsDocker, "docker", false, "Rebase with git and tag with tag.sh in a Go container instead of go-git")
+	k3sGenerateTagsSubCmd.Flags().BoolVar(&k3sGenerateTagsContinue, "continue", false, "Continue a rebase stopped on a conflict once it's resolved")
+	k3sGenerateTagsSubCmd.Flags().BoolVar(&k3sGenerateTagsAbort, "abort", false, "Abort a rebase stopped on a conflict")
+	k3sGenerateTagsSubCmd.MarkFlagsMutuallyExclusive("continue", "abort")
 
 	rke2GenerateSubCmd.AddCommand(rke2GenerateReleaseNotesSubCmd)
 
@@ -2,18 +2,21 @@ package cmd
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"sort"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
 	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
-	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/release/inspect"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
@@ -22,144 +25,186 @@ const (
 	ossRegistry = "docker.io"
 )
 
-func archStatus(expected bool, ossInfo, primeInfo reg.Image, platform reg.Platform) string {
-	if !expected {
-		return "-"
+// signaturePolicy loads the keys and certificates of the signatures config.
+func signaturePolicy(c *config.Signatures) (*reg.SignaturePolicy, error) {
+	var policy reg.SignaturePolicy
+
+	for _, path := range c.PublicKeys {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := reg.ParsePublicKeys(b)
+		if err != nil {
+			return nil, errors.New(path + ": " + err.Error())
+		}
+		policy.PublicKeys = append(policy.PublicKeys, keys...)
 	}
 
-	hasArch := ossInfo.Platforms[platform] && primeInfo.Platforms[platform]
-	if hasArch {
-		return "✓"
+	for _, path := range c.RekorKeys {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := reg.ParsePublicKeys(b)
+		if err != nil {
+			return nil, errors.New(path + ": " + err.Error())
+		}
+		policy.RekorKeys = append(policy.RekorKeys, keys...)
 	}
-	return "✗"
-}
 
-func windowsStatus(expected, exists bool) string {
-	if !expected {
-		return "-"
+	if c.FulcioRoots != "" {
+		b, err := os.ReadFile(c.FulcioRoots)
+		if err != nil {
+			return nil, err
+		}
+		policy.Roots = x509.NewCertPool()
+		if !policy.Roots.AppendCertsFromPEM(b) {
+			return nil, errors.New(c.FulcioRoots + ": no PEM encoded certificates found")
+		}
 	}
-	if exists {
-		return "✓"
+
+	for _, identity := range c.Identities {
+		var subject *regexp.Regexp
+		if identity.SubjectRegexp != "" {
+			re, err := regexp.Compile(identity.SubjectRegexp)
+			if err != nil {
+				return nil, err
+			}
+			subject = re
+		}
+		policy.Identities = append(policy.Identities, reg.KeylessIdentity{Issuer: identity.Issuer, Subject: subject})
 	}
-	return "✗"
-}
 
-func formatImageRef(ref name.Reference) string {
-	return ref.Context().RepositoryStr() + ":" + ref.Identifier()
+	return &policy, nil
 }
 
-func table(w io.Writer, results []rke2.Image) {
-	sort.Slice(results, func(i, j int) bool {
-		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
-	})
-
-	missingCount := 0
-	for _, result := range results {
-		if !result.OSSImage.Exists || !result.PrimeImage.Exists {
-			missingCount++
+var inspectCmd = &cobra.Command{
+	Use:   "inspect [version]",
+	Short: "Inspect release artifacts",
+	Long: `Inspect release artifacts for a given version.
+Currently supports inspecting the image lists of published k3s, rke2 and Rancher
+releases, the repo is picked from the version metadata (+k3s, +rke2 or none for
+Rancher). Use --prime to inspect a Rancher Prime release instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
 		}
-	}
-	if missingCount > 0 {
-		fmt.Fprintln(w, missingCount, "incomplete images")
-	} else {
-		fmt.Fprintln(w, "all images OK")
-	}
 
-	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
-	defer tw.Flush()
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if _, ok := inspect.Formatters[outputFormat]; !ok {
+			return errors.New("invalid output format " + outputFormat + ", expected one of " + strings.Join(inspect.FormatNames(), ", "))
+		}
 
-	fmt.Fprintln(tw, "image\toss\tprime\tsig\tamd64\tarm64\twin")
-	fmt.Fprintln(tw, "-----\t---\t-----\t---\t-----\t-----\t-------")
-
-	for _, result := range results {
-		ossStatus := "✗"
-		if result.OSSImage.Exists {
-			ossStatus = "✓"
-		}
-		primeStatus := "✗"
-		if result.PrimeImage.Exists {
-			primeStatus = "✓"
-		}
-		tw.Write([]byte(strings.Join([]string{
-			formatImageRef(result.Reference),
-			ossStatus,
-			primeStatus,
-			"?", // sigstore not implemented
-			archStatus(result.ExpectsLinuxAmd64, result.OSSImage, result.PrimeImage, reg.Platform{OS: "linux", Architecture: "amd64"}),
-			archStatus(result.ExpectsLinuxArm64, result.OSSImage, result.PrimeImage, reg.Platform{OS: "linux", Architecture: "arm64"}),
-			windowsStatus(result.ExpectsWindows, result.OSSImage.Exists && result.PrimeImage.Exists),
-			"",
-		}, "\t") + "\n"))
-	}
-}
+		product, err := inspectProduct(args[0], inspectPrime)
+		if err != nil {
+			return err
+		}
 
-func csv(w io.Writer, results []rke2.Image) {
-	sort.Slice(results, func(i, j int) bool {
-		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
-	})
+		ctx := context.Background()
+		filesystem, err := inspectAssets(ctx, product, args[0])
+		if err != nil {
+			return err
+		}
 
-	fmt.Fprintln(w, "image,oss,prime,sig,amd64,arm64,win")
+		ossHost := ossRegistry
+		primeHost := rootConfig.PrimeRegistry
+		if inspectRegistry != "" {
+			ossHost = inspectRegistry
+			primeHost = inspectRegistry
+		}
 
-	for _, result := range results {
-		ossStatus := "N"
-		if result.OSSImage.Exists {
-			ossStatus = "Y"
+		ossClient, err := newRegistryClient(ossHost)
+		if err != nil {
+			return err
 		}
-		primeStatus := "N"
-		if result.PrimeImage.Exists {
-			primeStatus = "Y"
+
+		var primeClient *reg.Client
+		if primeHost != "" {
+			if primeClient, err = newRegistryClient(primeHost); err != nil {
+				return err
+			}
 		}
 
-		amd64Status := ""
-		if result.ExpectsLinuxAmd64 {
-			if result.OSSImage.Platforms[reg.Platform{OS: "linux", Architecture: "amd64"}] &&
-				result.PrimeImage.Platforms[reg.Platform{OS: "linux", Architecture: "amd64"}] {
-				amd64Status = "Y"
-			} else {
-				amd64Status = "N"
+		if rootConfig.Signatures != nil {
+			policy, err := signaturePolicy(rootConfig.Signatures)
+			if err != nil {
+				return errors.New("invalid signatures config: " + err.Error())
+			}
+			ossClient.SetSignaturePolicy(policy)
+			if primeClient != nil {
+				primeClient.SetSignaturePolicy(policy)
 			}
 		}
 
-		arm64Status := ""
-		if result.ExpectsLinuxArm64 {
-			if result.OSSImage.Platforms[reg.Platform{OS: "linux", Architecture: "arm64"}] &&
-				result.PrimeImage.Platforms[reg.Platform{OS: "linux", Architecture: "arm64"}] {
-				arm64Status = "Y"
-			} else {
-				arm64Status = "N"
+		for _, kind := range inspectRequiredAttestations {
+			if kind != reg.AttestationSBOM && kind != reg.AttestationProvenance {
+				return errors.New("invalid required attestation " + kind + ", expected sbom or provenance")
+			}
+		}
+		if inspectAttestations || len(inspectRequiredAttestations) > 0 {
+			ossClient.CheckAttestations(true)
+			if primeClient != nil {
+				primeClient.CheckAttestations(true)
 			}
 		}
 
-		winStatus := ""
-		if result.ExpectsWindows {
-			if result.OSSImage.Exists && result.PrimeImage.Exists {
-				winStatus = "Y"
-			} else {
-				winStatus = "N"
+		// a nil *reg.Client isn't a nil inspect.RegistryClient
+		var prime inspect.RegistryClient
+		if primeClient != nil {
+			prime = primeClient
+		}
+
+		inspector := inspect.NewReleaseInspector(filesystem, product, ossClient, prime, debug)
+		inspector.SetConcurrencyLimit(inspectConcurrencyLimit)
+		inspector.SetRequiredAttestations(inspectRequiredAttestations)
+		if len(rootConfig.WindowsBuilds) > 0 {
+			builds := make([]inspect.WindowsBuild, len(rootConfig.WindowsBuilds))
+			for i, build := range rootConfig.WindowsBuilds {
+				builds[i] = inspect.WindowsBuild{Name: build.Name, OSVersion: build.OSVersion}
 			}
+			inspector.SetWindowsBuilds(builds)
 		}
 
-		values := []string{
-			formatImageRef(result.Reference),
-			ossStatus,
-			primeStatus,
-			"?", // sigstore not implemented
-			amd64Status,
-			arm64Status,
-			winStatus,
+		results, err := inspector.InspectRelease(ctx, args[0])
+		if err != nil {
+			return err
 		}
-		fmt.Fprintln(w, strings.Join(values, ","))
-	}
+
+		report := inspector.Report(args[0], results)
+
+		if err := inspect.Format(os.Stdout, outputFormat, report); err != nil {
+			return err
+		}
+
+		if incomplete := report.Incomplete(); incomplete > 0 {
+			return errors.New(strconv.Itoa(incomplete) + " of " + strconv.Itoa(len(report.Images)) + " images incomplete")
+		}
+
+		return nil
+	},
 }
 
-var inspectCmd = &cobra.Command{
-	Use:   "inspect [version]",
-	Short: "Inspect release artifacts",
-	Long: `Inspect release artifacts for a given version.
-Currently supports inspecting the image list for published rke2 releases.`,
+var inspectDiffCmd = &cobra.Command{
+	Use:   "diff [old version] [new version]",
+	Short: "Diff the image lists of two releases",
+	Long: `Diff the image lists of two releases of the same product, listing the images
+added, removed and bumped to another tag for each platform.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 {
-			return errors.New("expected at least one argument: [version]")
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [old version] [new version]")
+		}
+
+		product, err := inspectProduct(args[0], inspectPrime)
+		if err != nil {
+			return err
+		}
+		newProduct, err := inspectProduct(args[1], inspectPrime)
+		if err != nil {
+			return err
+		}
+		if newProduct.Name != product.Name {
+			return errors.New("can't diff a " + product.Name + " release with a " + newProduct.Name + " one")
 		}
 
 		ctx := context.Background()
@@ -167,38 +212,291 @@ Currently supports inspecting the image list for published rke2 releases.`,
 		if err != nil {
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
-		filesystem, err := release.NewFS(ctx, gh, "rancher", "rke2", args[0])
+		oldAssets, err := release.NewFS(ctx, gh, product.Owner, product.Repo, args[0])
 		if err != nil {
 			return err
 		}
-
-		ossClient := reg.NewClient(ossRegistry, debug)
-
-		var primeClient *reg.Client
-		if rootConfig.PrimeRegistry != "" {
-			primeClient = reg.NewClient(rootConfig.PrimeRegistry, debug)
+		newAssets, err := release.NewFS(ctx, gh, product.Owner, product.Repo, args[1])
+		if err != nil {
+			return err
 		}
 
-		inspector := rke2.NewReleaseInspector(filesystem, ossClient, primeClient, debug)
-
-		results, err := inspector.InspectRelease(ctx, args[0])
+		changes, err := inspect.Diff(product, oldAssets, newAssets)
 		if err != nil {
 			return err
 		}
 
-		outputFormat, _ := cmd.Flags().GetString("output")
-		switch outputFormat {
-		case "csv":
-			csv(os.Stdout, results)
+		switch inspectDiffOutput {
+		case "markdown":
+			diffMarkdown(os.Stdout, args[0], args[1], changes)
+		case "table":
+			diffTable(os.Stdout, changes)
 		default:
-			table(os.Stdout, results)
+			return errors.New("invalid output format " + inspectDiffOutput + ", expected table or markdown")
 		}
 
 		return nil
 	},
 }
 
+var inspectGoBuildInfoCmd = scanCmd(
+	"go-buildinfo [version]",
+	"List the Go build info of the binaries of the release images",
+	`List the Go version, main module and FIPS mode of the ELF and PE Go binaries
+of every platform of the images of a release. With --module, only the binaries
+built with that module are listed, with its version.`,
+	func(ctx context.Context, inspector *inspect.ReleaseInspector, version string, client inspect.FilesystemClient) (inspect.Report, error) {
+		results, err := inspector.GoBinaries(ctx, version, client)
+		if err != nil {
+			return inspect.Report{}, err
+		}
+		return inspector.GoBinariesReport(version, results, inspectGoBuildInfoModule), nil
+	},
+)
+
+var inspectOSCmd = scanCmd(
+	"os [version]",
+	"List the base OS and packages of the release images",
+	`List the base distro and version, from the os-release, and the number of
+apk, dpkg or rpm packages of every platform of the images of a release. With
+--package, only the images with that package installed are listed, with its
+version.`,
+	func(ctx context.Context, inspector *inspect.ReleaseInspector, version string, client inspect.FilesystemClient) (inspect.Report, error) {
+		results, err := inspector.ImagesOS(ctx, version, client)
+		if err != nil {
+			return inspect.Report{}, err
+		}
+		return inspector.ImagesOSReport(version, results, inspectOSPackage), nil
+	},
+)
+
+// scanCmd returns a command that pulls every platform of the images of a
+// release and renders the report of scan, which reads their filesystems.
+func scanCmd(use, short, long string, scan func(ctx context.Context, inspector *inspect.ReleaseInspector, version string, client inspect.FilesystemClient) (inspect.Report, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("expected at least one argument: [version]")
+			}
+
+			outputFormat, _ := cmd.Flags().GetString("output")
+			if _, ok := inspect.Formatters[outputFormat]; !ok {
+				return errors.New("invalid output format " + outputFormat + ", expected one of " + strings.Join(inspect.FormatNames(), ", "))
+			}
+
+			product, err := inspectProduct(args[0], inspectPrime)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			filesystem, err := inspectAssets(ctx, product, args[0])
+			if err != nil {
+				return err
+			}
+
+			client, err := newRegistryClient(config.ValueOrDefault(inspectRegistry, ossRegistry))
+			if err != nil {
+				return err
+			}
+
+			inspector := inspect.NewReleaseInspector(filesystem, product, nil, nil, debug)
+			inspector.SetConcurrencyLimit(inspectConcurrencyLimit)
+
+			report, err := scan(ctx, inspector, args[0], client)
+			if err != nil {
+				return err
+			}
+
+			if err := inspect.Format(os.Stdout, outputFormat, report); err != nil {
+				return err
+			}
+
+			if failed := report.Incomplete(); failed > 0 {
+				return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(report.Images)) + " images couldn't be read")
+			}
+
+			return nil
+		},
+	}
+}
+
+// inspectAssets returns the assets of the release of version, from
+// --from-dir or --from-tarball if set, or else from GitHub.
+func inspectAssets(ctx context.Context, product inspect.Product, version string) (fs.FS, error) {
+	switch {
+	case inspectFromDir != "":
+		return os.DirFS(inspectFromDir), nil
+	case inspectFromTarball != "":
+		f, err := os.Open(inspectFromTarball)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		names := make([]string, 0, len(product.ImageLists))
+		for _, list := range product.ImageLists {
+			names = append(names, list.Name)
+		}
+		return release.NewTarFS(f, names)
+	}
+
+	gh, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create github client: %v", err)
+	}
+
+	return release.NewFS(ctx, gh, product.Owner, product.Repo, version)
+}
+
+// inspectProduct returns the product of a release, with the Rancher repo
+// names of the config. prime inspects Rancher Prime instead of Rancher.
+func inspectProduct(version string, prime bool) (inspect.Product, error) {
+	product, err := inspect.ProductFor(version)
+	if err != nil {
+		return inspect.Product{}, err
+	}
+
+	if product.Name == inspect.Rancher.Name {
+		product.Repo = config.ValueOrDefault(rootConfig.RancherRepositoryName, config.RancherRepositoryName)
+		if prime {
+			product = inspect.RancherPrime
+			product.Repo = config.ValueOrDefault(rootConfig.RancherPrimeRepositoryName, config.RancherPrimeRepositoryName)
+		}
+		product.Owner = config.ValueOrDefault(rootConfig.RancherGithubOrganization, config.RancherGithubOrganization)
+	} else if prime {
+		return inspect.Product{}, errors.New("--prime is only supported for rancher releases")
+	}
+
+	return product, nil
+}
+
+// diffTag is the tag of a side of an image change, - if there's none.
+func diffTag(tag string) string {
+	if tag == "" {
+		return "-"
+	}
+	return tag
+}
+
+func diffTable(w io.Writer, changes []inspect.ImageChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "no image changes")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "platform\timage\tchange\told\tnew")
+	fmt.Fprintln(tw, "--------\t-----\t------\t---\t---")
+	for _, change := range changes {
+		fmt.Fprintln(tw, strings.Join([]string{
+			change.Platform.String(),
+			change.Repository,
+			change.Kind(),
+			diffTag(change.OldTag),
+			diffTag(change.NewTag),
+		}, "\t"))
+	}
+}
+
+// diffMarkdown writes a table of the image changes of each platform, to be
+// pasted in release notes or PRs.
+func diffMarkdown(w io.Writer, oldVersion, newVersion string, changes []inspect.ImageChange) {
+	fmt.Fprintln(w, "## Image changes from "+oldVersion+" to "+newVersion)
+
+	if len(changes) == 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "No image changes.")
+		return
+	}
+
+	var platform reg.Platform
+	for i, change := range changes {
+		if i == 0 || change.Platform != platform {
+			platform = change.Platform
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "### "+platform.String())
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| Image | Change | "+oldVersion+" | "+newVersion+" |")
+			fmt.Fprintln(w, "|-------|--------|-----|-----|")
+		}
+		fmt.Fprintln(w, "| `"+change.Repository+"` | "+change.Kind()+" | "+diffTag(change.OldTag)+" | "+diffTag(change.NewTag)+" |")
+	}
+}
+
+// newRegistryClient returns a client for registry, with its definition in
+// the config if it has one. It's authenticated with the credentials of the
+// config for the registry, or else of the environment variables of its
+// definition, or else of the docker config.
+func newRegistryClient(registry string) (*reg.Client, error) {
+	client := reg.NewClient(registry, debug)
+
+	definition, ok := rootConfig.RegistryDefinitions()[registry]
+	if ok {
+		if definition.BaseURL != "" {
+			if err := client.SetBaseURL(definition.BaseURL); err != nil {
+				return nil, err
+			}
+		}
+		client.SetTokenService(definition.AuthURL, definition.Service)
+	}
+
+	if rootConfig.Auth != nil {
+		if creds, ok := rootConfig.Auth.Registries[registry]; ok {
+			client.SetCredentials(creds.Username, creds.Password)
+			return client, nil
+		}
+	}
+	if ok && definition.UsernameEnv != "" {
+		if username := os.Getenv(definition.UsernameEnv); username != "" {
+			client.SetCredentials(username, os.Getenv(definition.PasswordEnv))
+		}
+	}
+
+	return client, nil
+}
+
+var (
+	inspectConcurrencyLimit     int
+	inspectPrime                bool
+	inspectAttestations         bool
+	inspectRequiredAttestations []string
+	inspectDiffOutput           string
+	inspectFromDir              string
+	inspectFromTarball          string
+	inspectRegistry             string
+	inspectGoBuildInfoModule    string
+	inspectOSPackage            string
+)
+
 func init() {
 	rootCmd.AddCommand(inspectCmd)
-	inspectCmd.Flags().StringP("output", "o", "table", "Output format (table|csv)")
+	inspectCmd.AddCommand(inspectDiffCmd)
+	inspectCmd.AddCommand(inspectGoBuildInfoCmd)
+	inspectCmd.AddCommand(inspectOSCmd)
+	inspectCmd.PersistentFlags().BoolVar(&inspectPrime, "prime", false, "Inspect the Rancher Prime release of the version")
+	inspectCmd.Flags().IntVarP(&inspectConcurrencyLimit, "concurrency-limit", "l", inspect.DefaultConcurrencyLimit, "Number of images checked at once")
+	inspectCmd.Flags().StringP("output", "o", "table", "Output format ("+strings.Join(inspect.FormatNames(), "|")+")")
+	inspectCmd.Flags().BoolVar(&inspectAttestations, "attestations", false, "List the SBOM and provenance attestations of the images")
+	inspectCmd.Flags().StringSliceVar(&inspectRequiredAttestations, "require-attestations", nil, "Fail if any image is missing one of these attestations (sbom,provenance), implies --attestations")
+	inspectCmd.Flags().StringVar(&inspectFromDir, "from-dir", "", "Read the image lists from a directory instead of the GitHub release")
+	inspectCmd.Flags().StringVar(&inspectFromTarball, "from-tarball", "", "Read the image lists from a tarball instead of the GitHub release")
+	inspectCmd.Flags().StringVar(&inspectRegistry, "registry", "", "Look up the images in this registry instead of the OSS and Prime ones")
+	inspectCmd.MarkFlagsMutuallyExclusive("from-dir", "from-tarball")
+	inspectGoBuildInfoCmd.Flags().StringVar(&inspectGoBuildInfoModule, "module", "", "Only list the binaries built with this module, e.g. golang.org/x/net")
+	inspectOSCmd.Flags().StringVar(&inspectOSPackage, "package", "", "Only list the images with this package installed, e.g. openssl")
+	for _, cmd := range []*cobra.Command{inspectGoBuildInfoCmd, inspectOSCmd} {
+		cmd.Flags().StringP("output", "o", "table", "Output format ("+strings.Join(inspect.FormatNames(), "|")+")")
+		cmd.Flags().StringVar(&inspectFromDir, "from-dir", "", "Read the image lists from a directory instead of the GitHub release")
+		cmd.Flags().StringVar(&inspectFromTarball, "from-tarball", "", "Read the image lists from a tarball instead of the GitHub release")
+		cmd.Flags().StringVar(&inspectRegistry, "registry", "", "Pull the images from this registry instead of docker.io")
+		cmd.Flags().IntVarP(&inspectConcurrencyLimit, "concurrency-limit", "l", inspect.DefaultConcurrencyLimit, "Number of images read at once")
+		cmd.MarkFlagsMutuallyExclusive("from-dir", "from-tarball")
+	}
+	inspectDiffCmd.Flags().StringVarP(&inspectDiffOutput, "output", "o", "table", "Output format (table|markdown)")
 }
@@ -9,8 +9,9 @@ import (
 	"testing/fstest"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
 	reg "github.com/rancher/ecm-distro-tools/registry"
-	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/release/inspect"
 )
 
 type mockRegistryClient struct {
@@ -34,7 +35,7 @@ func newMockFS() fs.FS {
 			Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1"),
 		},
 		"rke2-images.windows-amd64.txt": &fstest.MapFile{
-			Data: []byte("rancher/rke2-runtime-windows:v1.23.4-rke2r1"),
+			Data: []byte("rancher/rke2-runtime-windows:v1.23.4-rke2r1\nrancher/mirrored-pause:3.6"),
 		},
 	}
 }
@@ -47,6 +48,11 @@ func TestInspectAndCSVOutput(t *testing.T) {
 				{OS: "linux", Architecture: "amd64"}: true,
 				{OS: "linux", Architecture: "arm64"}: true,
 			},
+			Digest: "sha256:01",
+			PlatformDigests: map[reg.Platform]string{
+				{OS: "linux", Architecture: "amd64"}: "sha256:02",
+				{OS: "linux", Architecture: "arm64"}: "sha256:03",
+			},
 		},
 		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
 			Exists: true,
@@ -54,6 +60,12 @@ func TestInspectAndCSVOutput(t *testing.T) {
 				{OS: "linux", Architecture: "amd64"}: true,
 			},
 		},
+		"rancher/mirrored-pause:3.6": {
+			Exists: true,
+			Platforms: map[reg.Platform]bool{
+				{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.5820"}: true,
+			},
+		},
 	}
 
 	primeImages := map[string]reg.Image{
@@ -63,6 +75,11 @@ func TestInspectAndCSVOutput(t *testing.T) {
 				{OS: "linux", Architecture: "amd64"}: true,
 				{OS: "linux", Architecture: "arm64"}: true,
 			},
+			Digest: "sha256:04",
+			PlatformDigests: map[reg.Platform]string{
+				{OS: "linux", Architecture: "amd64"}: "sha256:02",
+				{OS: "linux", Architecture: "arm64"}: "sha256:05",
+			},
 		},
 		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
 			Exists: false,
@@ -70,10 +87,17 @@ func TestInspectAndCSVOutput(t *testing.T) {
 				{OS: "linux", Architecture: "amd64"}: true,
 			},
 		},
+		"rancher/mirrored-pause:3.6": {
+			Exists: true,
+			Platforms: map[reg.Platform]bool{
+				{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.5820"}: true,
+			},
+		},
 	}
 
-	inspector := rke2.NewReleaseInspector(
+	inspector := inspect.NewReleaseInspector(
 		newMockFS(),
+		inspect.RKE2,
 		&mockRegistryClient{images: ossImages},
 		&mockRegistryClient{images: primeImages},
 		false,
@@ -85,7 +109,9 @@ func TestInspectAndCSVOutput(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	csv(&buf, results)
+	if err := inspect.FormatCSV(&buf, inspector.Report("v1.23.4+rke2r1", results)); err != nil {
+		t.Fatalf("FormatCSV() error = %v", err)
+	}
 
 	expectedBytes, err := os.ReadFile("testdata/inspect_test_output.csv")
 	if err != nil {
@@ -93,6 +119,59 @@ func TestInspectAndCSVOutput(t *testing.T) {
 	}
 	expected := string(expectedBytes)
 	if got := buf.String(); got != expected {
-		t.Errorf("csv() output = %q, want %q", got, expected)
+		t.Errorf("FormatCSV() output = %q, want %q", got, expected)
+	}
+}
+
+func TestDiffMarkdown(t *testing.T) {
+	changes := []inspect.ImageChange{
+		{Platform: inspect.LinuxAmd64, Repository: "rancher/hardened-etcd", OldTag: "v3.5.9-k3s1-build20230802", NewTag: "v3.5.13-k3s1-build20240531"},
+		{Platform: inspect.LinuxAmd64, Repository: "rancher/rke2-runtime", OldTag: "v1.30.1-rke2r1", NewTag: "v1.30.2-rke2r1"},
+		{Platform: inspect.WindowsAmd64, Repository: "rancher/rke2-runtime", OldTag: "v1.30.1-rke2r1-windows-amd64"},
+	}
+
+	var buf bytes.Buffer
+	diffMarkdown(&buf, "v1.30.1+rke2r1", "v1.30.2+rke2r1", changes)
+
+	expected := "## Image changes from v1.30.1+rke2r1 to v1.30.2+rke2r1\n" +
+		"\n" +
+		"### linux/amd64\n" +
+		"\n" +
+		"| Image | Change | v1.30.1+rke2r1 | v1.30.2+rke2r1 |\n" +
+		"|-------|--------|-----|-----|\n" +
+		"| `rancher/hardened-etcd` | bumped | v3.5.9-k3s1-build20230802 | v3.5.13-k3s1-build20240531 |\n" +
+		"| `rancher/rke2-runtime` | bumped | v1.30.1-rke2r1 | v1.30.2-rke2r1 |\n" +
+		"\n" +
+		"### windows/amd64\n" +
+		"\n" +
+		"| Image | Change | v1.30.1+rke2r1 | v1.30.2+rke2r1 |\n" +
+		"|-------|--------|-----|-----|\n" +
+		"| `rancher/rke2-runtime` | removed | v1.30.1-rke2r1-windows-amd64 | - |\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("diffMarkdown() output = %q, want %q", got, expected)
+	}
+}
+
+func TestInspectProduct(t *testing.T) {
+	orig := rootConfig
+	defer func() { rootConfig = orig }()
+	rootConfig = &config.Config{RancherGithubOrganization: "rancher-fork", RancherPrimeRepositoryName: "rancher-prime-fork"}
+
+	for _, prime := range []bool{false, true} {
+		product, err := inspectProduct("v2.9.0", prime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if product.Owner != "rancher-fork" {
+			t.Errorf("inspectProduct(prime=%v) owner = %s, want rancher-fork", prime, product.Owner)
+		}
+	}
+
+	product, err := inspectProduct("v2.9.0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Repo != "rancher-prime-fork" {
+		t.Errorf("inspectProduct() repo = %s, want rancher-prime-fork", product.Repo)
 	}
 }
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/rancher"
+	"github.com/rancher/ecm-distro-tools/release/version"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var allowNewCommits bool
+
+// promoteCmd represents the promote command.
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote the latest RC to GA by tagging the RC commit",
+}
+
+var k3sPromoteSubCmd = &cobra.Command{
+	Use:   "k3s [version]",
+	Short: "Tag k3s GA at the latest RC commit",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+
+		version := args[0]
+		k3sRelease, found := rootConfig.K3s.Versions[version]
+		if !found {
+			return NewVersionNotFoundError(version, "k3s")
+		}
+
+		ctx := context.Background()
+		ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+		if err != nil {
+			return fmt.Errorf("failed to create github client: %v", err)
+		}
+
+		opts := repository.CreateRefOpts{
+			Tag:    k3sRelease.NewK8sVersion + "+" + k3sRelease.NewSuffix,
+			Repo:   config.K3sRepositoryName,
+			Owner:  k3sRelease.K3sRepoOwner,
+			Branch: k3sRelease.ReleaseBranch,
+		}
+
+		latestRC, err := release.LatestRC(ctx, opts.Owner, opts.Repo, k3sRelease.NewK8sVersion, k3sRelease.NewSuffix, ghClient)
+		if err != nil {
+			return err
+		}
+
+		return promoteRef(ctx, ghClient, latestRC, &opts, dryRun || k3sRelease.DryRun)
+	},
+}
+
+var rke2PromoteSubCmd = &cobra.Command{
+	Use:   "rke2 [version]",
+	Short: "Tag rke2 GA at the latest RC commit",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+
+		version := args[0]
+		rke2Release, found := rootConfig.RKE2.Versions[version]
+		if !found {
+			return NewVersionNotFoundError(version, "rke2")
+		}
+
+		ctx := context.Background()
+		ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+		if err != nil {
+			return fmt.Errorf("failed to create github client: %v", err)
+		}
+
+		opts := repository.CreateRefOpts{
+			Tag:    rke2Release.NewK8sVersion + "+" + rke2Release.NewSuffix,
+			Repo:   rke2Release.RKE2RepoName,
+			Owner:  rke2Release.RKE2RepoOwner,
+			Branch: rke2Release.ReleaseBranch,
+		}
+
+		latestRC, err := release.LatestRC(ctx, opts.Owner, opts.Repo, rke2Release.NewK8sVersion, rke2Release.NewSuffix, ghClient)
+		if err != nil {
+			return err
+		}
+
+		return promoteRef(ctx, ghClient, latestRC, &opts, dryRun || rke2Release.DryRun)
+	},
+}
+
+var rancherPromoteSubCmd = &cobra.Command{
+	Use:   "rancher [version]",
+	Short: "Tag Rancher GA at the latest RC commit",
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return copyRancherVersions(), cobra.ShellCompDirectiveNoFileComp
+		}
+
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+
+		repo := config.ValueOrDefault(rootConfig.RancherRepositoryName, config.RancherRepositoryName)
+
+		return promoteRancher(repo, args[0])
+	},
+}
+
+var rancherPrimePromoteSubCmd = &cobra.Command{
+	Use:   "rancher-prime [version]",
+	Short: "Tag Rancher Prime GA at the latest RC commit",
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return copyRancherVersions(), cobra.ShellCompDirectiveNoFileComp
+		}
+
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+
+		repo := config.ValueOrDefault(rootConfig.RancherPrimeRepositoryName, config.RancherPrimeRepositoryName)
+
+		return promoteRancher(repo, args[0])
+	},
+}
+
+// promoteRef tags opts.Tag at the commit of the given RC, refusing to do so
+// if the release branch has moved since the RC was tagged.
+func promoteRef(ctx context.Context, ghClient *github.Client, latestRC *string, opts *repository.CreateRefOpts, dryRun bool) error {
+	if latestRC == nil {
+		return errors.New("couldn't find the latest RC for " + opts.Tag)
+	}
+
+	promotion, err := release.NewPromotion(ctx, ghClient, opts.Owner, opts.Repo, opts.Branch, *latestRC)
+	if err != nil {
+		return err
+	}
+	promotion.Print(os.Stdout)
+
+	if err := promotion.Validate(allowNewCommits); err != nil {
+		return err
+	}
+
+	opts.SHA = promotion.SHA
+
+	fmt.Printf("create ref options: %+v\n", *opts)
+
+	if dryRun {
+		fmt.Println("dry run, skipping creating tag")
+		return nil
+	}
+
+	createdRef, err := repository.CreateRef(ctx, ghClient, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ref created: " + createdRef.GetURL())
+	return nil
+}
+
+func promoteRancher(repo, tag string) error {
+	rancherRelease, found := rootConfig.Rancher.Versions[tag]
+	if !found {
+		return NewVersionNotFoundError(tag, "rancher")
+	}
+
+	owner := config.ValueOrDefault(rootConfig.RancherGithubOrganization, config.RancherGithubOrganization)
+
+	releaseBranch, err := rancher.ReleaseBranchFromTag(tag)
+	if err != nil {
+		return errors.New("failed to generate release branch from tag: " + err.Error())
+	}
+
+	releaseBranch = config.ValueOrDefault(rancherRelease.ReleaseBranch, releaseBranch)
+
+	ctx := context.Background()
+	ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+	if err != nil {
+		return fmt.Errorf("failed to create github client: %v", err)
+	}
+
+	v, err := version.Parse(tag)
+	if err != nil {
+		return err
+	}
+
+	latestRC, err := release.LatestPreRelease(ctx, ghClient, owner, repo, v, "rc", version.Rancher)
+	if err != nil {
+		return err
+	}
+	if latestRC == nil {
+		return errors.New("couldn't find the latest RC for " + tag)
+	}
+
+	promotion, err := release.NewPromotion(ctx, ghClient, owner, repo, releaseBranch, latestRC.String())
+	if err != nil {
+		return err
+	}
+	promotion.Print(os.Stdout)
+
+	if err := promotion.Validate(allowNewCommits); err != nil {
+		return err
+	}
+
+	createdTag, tagCommit, err := rancher.CreateTag(ctx, ghClient, owner, repo, tag, promotion.SHA, releaseBranch, "ga", false, dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Println("created tag: " + createdTag + ": " + tagCommit)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+
+	promoteCmd.AddCommand(k3sPromoteSubCmd)
+	promoteCmd.AddCommand(rke2PromoteSubCmd)
+	promoteCmd.AddCommand(rancherPromoteSubCmd)
+	promoteCmd.AddCommand(rancherPrimePromoteSubCmd)
+
+	promoteCmd.PersistentFlags().BoolVar(&allowNewCommits, "allow-new-commits", false, "Promote even if commits were merged to the release branch after the latest RC")
+}
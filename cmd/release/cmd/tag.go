@@ -4,14 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/cli"
 	"github.com/rancher/ecm-distro-tools/release/dashboard"
 	"github.com/rancher/ecm-distro-tools/release/k3s"
 	"github.com/rancher/ecm-distro-tools/release/rancher"
 	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
@@ -24,6 +30,12 @@ type tagRKE2CmdFlags struct {
 
 var tagRKE2Flags tagRKE2CmdFlags
 
+var rke2PackagingRPMVersion int
+
+var satelliteImageTimeout time.Duration
+
+var tagAll bool
+
 // tagCmd represents the tag command.
 var tagCmd = &cobra.Command{
 	Use:   "tag",
@@ -34,8 +46,8 @@ var k3sTagSubCmd = &cobra.Command{
 	Use:   "k3s [ga,rc] [version]",
 	Short: "Tag k3s releases",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 2 {
-			return errors.New("expected at least two arguments: [ga,rc] [version]")
+		if err := validateTagArgs(args, tagAll); err != nil {
+			return err
 		}
 
 		rc, err := releaseTypePreRelease(args[0])
@@ -43,25 +55,33 @@ var k3sTagSubCmd = &cobra.Command{
 			return err
 		}
 
-		tag := args[1]
-		k3sRelease, found := rootConfig.K3s.Versions[tag]
-		if !found {
-			return NewVersionNotFoundError(tag, "k3s")
-		}
-
 		ctx := context.Background()
 		ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
 		if err != nil {
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
 
-		opts := repository.CreateRefOpts{
-			Tag:    tag,
-			Repo:   "k3s",
-			Owner:  k3sRelease.K3sRepoOwner,
-			Branch: k3sRelease.ReleaseBranch,
+		tagK3s := func(tag string) tagResult {
+			k3sRelease, found := rootConfig.K3s.Versions[tag]
+			if !found {
+				return tagResult{Version: tag, Err: NewVersionNotFoundError(tag, "k3s")}
+			}
+
+			opts := repository.CreateRefOpts{
+				Tag:    tag,
+				Repo:   "k3s",
+				Owner:  k3sRelease.K3sRepoOwner,
+				Branch: k3sRelease.ReleaseBranch,
+			}
+			ref, err := k3s.CreateRef(ctx, ghClient, &k3sRelease, &opts, rc)
+			return newTagResult(tag, &opts, ref, err)
+		}
+
+		if tagAll {
+			return tagVersions(os.Stdout, slices.Collect(maps.Keys(rootConfig.K3s.Versions)), tagK3s)
 		}
-		return k3s.CreateRef(ctx, ghClient, &k3sRelease, &opts, rc)
+
+		return tagK3s(args[1]).Err
 	},
 }
 
@@ -69,8 +89,8 @@ var rke2TagSubCmd = &cobra.Command{
 	Use:   "rke2 [ga,rc] [version]",
 	Short: "Tag rke2 releases",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 2 {
-			return errors.New("expected at least two arguments: [ga,rc] [version]")
+		if err := validateTagArgs(args, tagAll); err != nil {
+			return err
 		}
 
 		rc, err := releaseTypePreRelease(args[0])
@@ -78,10 +98,49 @@ var rke2TagSubCmd = &cobra.Command{
 			return err
 		}
 
-		tag := args[1]
-		rke2Release, found := rootConfig.RKE2.Versions[tag]
-		if !found {
-			return NewVersionNotFoundError(tag, "rke2")
+		ctx := context.Background()
+		ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+		if err != nil {
+			return fmt.Errorf("failed to create github client: %v", err)
+		}
+
+		tagRKE2 := func(tag string) tagResult {
+			rke2Release, found := rootConfig.RKE2.Versions[tag]
+			if !found {
+				return tagResult{Version: tag, Err: NewVersionNotFoundError(tag, "rke2")}
+			}
+
+			opts := repository.CreateRefOpts{
+				Tag:    tag,
+				Repo:   rke2Release.RKE2RepoName,
+				Owner:  rke2Release.RKE2RepoOwner,
+				Branch: rke2Release.ReleaseBranch,
+			}
+			ref, err := rke2.CreateRef(ctx, ghClient, &rke2Release, &opts, rc)
+			return newTagResult(tag, &opts, ref, err)
+		}
+
+		if tagAll {
+			return tagVersions(os.Stdout, slices.Collect(maps.Keys(rootConfig.RKE2.Versions)), tagRKE2)
+		}
+
+		return tagRKE2(args[1]).Err
+	},
+}
+
+var rke2PackagingTagSubCmd = &cobra.Command{
+	Use:   "rke2-packaging [testing,latest,stable] [rke2-version]",
+	Short: "Tag rke2-packaging releases",
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return []string{release.ChannelTesting, release.ChannelLatest, release.ChannelStable}, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [testing,latest,stable] [rke2-version]")
 		}
 
 		ctx := context.Background()
@@ -90,13 +149,22 @@ var rke2TagSubCmd = &cobra.Command{
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
 
-		opts := repository.CreateRefOpts{
-			Tag:    tag,
-			Repo:   rke2Release.RKE2RepoName,
-			Owner:  rke2Release.RKE2RepoOwner,
-			Branch: rke2Release.ReleaseBranch,
+		owner, repo, err := repository.OwnerRepoFromURL(config.RKE2PackagingRepositoryURL)
+		if err != nil {
+			return err
 		}
-		return rke2.CreateRef(ctx, ghClient, &rke2Release, &opts, rc)
+
+		opts := &rke2.PackagingOpts{
+			Owner:       owner,
+			Repo:        repo,
+			RKE2Owner:   config.RancherGithubOrganization,
+			RKE2Repo:    config.RKE2RepositoryName,
+			RKE2Version: args[1],
+			Channel:     args[0],
+			RPMVersion:  rke2PackagingRPMVersion,
+			DryRun:      dryRun,
+		}
+		return rke2.CreatePackagingRelease(ctx, ghClient, opts)
 	},
 }
 
@@ -181,17 +249,139 @@ var systemAgentInstallerK3sTagSubCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
-		opts := &repository.CreateReleaseOpts{
-			Tag:    tag,
-			Repo:   "system-agent-installer-k3s",
-			Owner:  k3sRelease.SystemAgentInstallerRepoOwner,
-			Branch: "main",
+		opts, err := satelliteReleaseOpts(config.K3sSystemAgentInstallerRepositoryURL, k3sRelease.SystemAgentInstallerRepoOwner, tag)
+		if err != nil {
+			return err
 		}
 
 		return k3s.CreateRelease(ctx, ghClient, &k3sRelease, opts, releaseNotesAlert, rc)
 	},
 }
 
+var k3sUpgradeTagSubCmd = &cobra.Command{
+	Use:   "k3s-upgrade [ga,rc] [version]",
+	Short: "Tag k3s-upgrade releases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [ga,rc] [version]")
+		}
+
+		rc, err := releaseTypePreRelease(args[0])
+		if err != nil {
+			return err
+		}
+
+		tag := args[1]
+		k3sRelease, found := rootConfig.K3s.Versions[tag]
+		if !found {
+			return NewVersionNotFoundError(tag, "k3s")
+		}
+
+		opts, err := satelliteReleaseOpts(config.K3sUpgradeRepositoryURL, k3sRelease.K3sRepoOwner, tag)
+		if err != nil {
+			return err
+		}
+		k3sRelease.DryRun = k3sRelease.DryRun || dryRun
+
+		owner := config.ValueOrDefault(k3sRelease.K3sRepoOwner, config.K3sGithubOrganization)
+		scheme := version.Distro(k3sRelease.NewSuffix)
+
+		return tagSatellite(release.K3sUpgrade, opts, owner, config.K3sRepositoryName, k3sRelease.NewK8sVersion, scheme, rc, k3sRelease.DryRun)
+	},
+}
+
+var rke2UpgradeTagSubCmd = &cobra.Command{
+	Use:   "rke2-upgrade [ga,rc] [version]",
+	Short: "Tag rke2-upgrade releases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [ga,rc] [version]")
+		}
+
+		rc, err := releaseTypePreRelease(args[0])
+		if err != nil {
+			return err
+		}
+
+		tag := args[1]
+		rke2Release, found := rootConfig.RKE2.Versions[tag]
+		if !found {
+			return NewVersionNotFoundError(tag, "rke2")
+		}
+
+		opts, err := satelliteReleaseOpts(config.RKE2UpgradeRepositoryURL, rke2Release.RKE2RepoOwner, tag)
+		if err != nil {
+			return err
+		}
+		rke2Release.DryRun = rke2Release.DryRun || dryRun
+
+		owner := config.ValueOrDefault(rke2Release.RKE2RepoOwner, config.RancherGithubOrganization)
+		repo := config.ValueOrDefault(rke2Release.RKE2RepoName, config.RKE2RepositoryName)
+		scheme := version.Distro(rke2Release.NewSuffix)
+
+		return tagSatellite(release.RKE2Upgrade, opts, owner, repo, rke2Release.NewK8sVersion, scheme, rc, rke2Release.DryRun)
+	},
+}
+
+var systemAgentInstallerRKE2TagSubCmd = &cobra.Command{
+	Use:   "system-agent-installer-rke2 [ga,rc] [version]",
+	Short: "Tag system-agent-installer-rke2 releases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [ga,rc] [version]")
+		}
+
+		rc, err := releaseTypePreRelease(args[0])
+		if err != nil {
+			return err
+		}
+
+		tag := args[1]
+		rke2Release, found := rootConfig.RKE2.Versions[tag]
+		if !found {
+			return NewVersionNotFoundError(tag, "rke2")
+		}
+
+		opts, err := satelliteReleaseOpts(config.RKE2SystemAgentInstallerRepositoryURL, rke2Release.RKE2RepoOwner, tag)
+		if err != nil {
+			return err
+		}
+		rke2Release.DryRun = rke2Release.DryRun || dryRun
+
+		owner := config.ValueOrDefault(rke2Release.RKE2RepoOwner, config.RancherGithubOrganization)
+		repo := config.ValueOrDefault(rke2Release.RKE2RepoName, config.RKE2RepositoryName)
+		scheme := version.Distro(rke2Release.NewSuffix)
+
+		return tagSatellite(release.RKE2SystemAgentInstaller, opts, owner, repo, rke2Release.NewK8sVersion, scheme, rc, rke2Release.DryRun)
+	},
+}
+
+var k3sSELinuxTagSubCmd = &cobra.Command{
+	Use:               "k3s-selinux [testing,latest,stable] [version]",
+	Short:             "Tag k3s-selinux releases",
+	ValidArgsFunction: selinuxValidArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [testing,latest,stable] [version]")
+		}
+
+		return tagSELinux(config.K3sSELinuxRepositoryURL, args[0], args[1])
+	},
+}
+
+var rke2SELinuxTagSubCmd = &cobra.Command{
+	Use:               "rke2-selinux [testing,latest,stable] [version]",
+	Short:             "Tag rke2-selinux releases",
+	ValidArgsFunction: selinuxValidArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [testing,latest,stable] [version]")
+		}
+
+		return tagSELinux(config.RKE2SELinuxRepositoryURL, args[0], args[1])
+	},
+}
+
 var rancherPrimeTagSubCmd = &cobra.Command{
 	Use:   "rancher-prime [ga, rc, alpha] [version]",
 	Short: "Tag Rancher Prime releases",
@@ -413,19 +603,96 @@ var cliTagSubCmd = &cobra.Command{
 	},
 }
 
+// satelliteReleaseOpts returns the release options of a repo released
+// alongside k3s or rke2, owned by owner if set, e.g. by a fork, and by the
+// owner of repoURL otherwise.
+func satelliteReleaseOpts(repoURL, owner, tag string) (*repository.CreateReleaseOpts, error) {
+	urlOwner, repo, err := repository.OwnerRepoFromURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repository.CreateReleaseOpts{
+		Tag:    tag,
+		Repo:   repo,
+		Owner:  config.ValueOrDefault(owner, urlOwner),
+		Branch: "main",
+	}, nil
+}
+
+// tagSatellite creates the release of a satellite repo with the tag of the
+// k3s or rke2 release of k8sVersion in sourceOwner/sourceRepo, then waits for
+// its image to be published.
+func tagSatellite(s release.Satellite, opts *repository.CreateReleaseOpts, sourceOwner, sourceRepo, k8sVersion string, scheme version.Scheme, rc, dryRun bool) error {
+	ctx := context.Background()
+	ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+	if err != nil {
+		return fmt.Errorf("failed to create github client: %v", err)
+	}
+
+	tag, err := release.SatelliteTag(ctx, ghClient, sourceOwner, sourceRepo, k8sVersion, scheme, rc)
+	if err != nil {
+		return err
+	}
+	opts.Tag = tag
+
+	if err := release.CreateSatelliteRelease(ctx, ghClient, opts, rc, dryRun); err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return release.WaitForSatelliteImage(ctx, reg.NewClient(ossRegistry, debug), s, opts.Tag, satelliteImageTimeout, 30*time.Second)
+}
+
+// tagSELinux creates the next release of a selinux repo in channel.
+func tagSELinux(repoURL, channel, selinuxVersion string) error {
+	owner, repo, err := repository.OwnerRepoFromURL(repoURL)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+	if err != nil {
+		return fmt.Errorf("failed to create github client: %v", err)
+	}
+
+	tag, err := release.SELinuxTag(ctx, ghClient, owner, repo, selinuxVersion, channel)
+	if err != nil {
+		return err
+	}
+
+	opts := &repository.CreateReleaseOpts{
+		Tag:    tag,
+		Repo:   repo,
+		Owner:  owner,
+		Branch: "master",
+	}
+
+	return release.CreateSELinuxRelease(ctx, ghClient, opts, channel == release.ChannelTesting, dryRun)
+}
+
+func selinuxValidArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return []string{release.ChannelTesting, release.ChannelLatest, release.ChannelStable}, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
 func previousPatch(tag string) (string, error) {
-	version, err := semver.NewVersion(tag)
+	v, err := version.Parse(tag)
 	if err != nil {
 		return "", err
 	}
-	patch := version.Patch()
-	if patch == 0 {
+	if v.Patch == 0 {
 		return "", errors.New("can't find previous tag for a new minor: " + tag)
 	}
 
-	patch -= 1
-
-	previousPatch := fmt.Sprintf("v%d.%d.%d", version.Major(), version.Minor(), patch)
+	previousPatch := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch-1)
 	return previousPatch, nil
 }
 
@@ -447,9 +714,15 @@ func init() {
 
 	tagCmd.AddCommand(k3sTagSubCmd)
 	tagCmd.AddCommand(rke2TagSubCmd)
+	tagCmd.AddCommand(rke2PackagingTagSubCmd)
 	tagCmd.AddCommand(rancherTagSubCmd)
 	tagCmd.AddCommand(rancherPrimeTagSubCmd)
 	tagCmd.AddCommand(systemAgentInstallerK3sTagSubCmd)
+	tagCmd.AddCommand(systemAgentInstallerRKE2TagSubCmd)
+	tagCmd.AddCommand(k3sUpgradeTagSubCmd)
+	tagCmd.AddCommand(rke2UpgradeTagSubCmd)
+	tagCmd.AddCommand(k3sSELinuxTagSubCmd)
+	tagCmd.AddCommand(rke2SELinuxTagSubCmd)
 	tagCmd.AddCommand(dashboardTagSubCmd)
 	tagCmd.AddCommand(cliTagSubCmd)
 
@@ -457,6 +730,20 @@ func init() {
 	tagRKE2Flags.ReleaseVersion = rke2TagSubCmd.Flags().StringP("release-version", "r", "r1", "Release version")
 	tagRKE2Flags.RCVersion = rke2TagSubCmd.Flags().String("rc", "", "RC version")
 	tagRKE2Flags.RPMVersion = rke2TagSubCmd.Flags().Int("rpm-version", 0, "RPM version")
+
+	// k3s and rke2 batch tagging
+	for _, c := range []*cobra.Command{k3sTagSubCmd, rke2TagSubCmd} {
+		c.Flags().BoolVar(&tagAll, "all", false, "Tag every version in the config")
+		c.Flags().IntVarP(&concurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Concurrency Limit")
+	}
+
+	// rke2-packaging
+	rke2PackagingTagSubCmd.Flags().IntVar(&rke2PackagingRPMVersion, "rpm-version", 0, "RPM version, incremented when the RPMs of a release need to be republished")
+
+	// satellites
+	for _, c := range []*cobra.Command{k3sUpgradeTagSubCmd, rke2UpgradeTagSubCmd, systemAgentInstallerRKE2TagSubCmd} {
+		c.Flags().DurationVar(&satelliteImageTimeout, "image-timeout", 30*time.Minute, "How long to wait for the image to be published after tagging")
+	}
 }
 
 func releaseTypePreRelease(releaseType string) (bool, error) {
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/release/version"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"golang.org/x/sync/errgroup"
+)
+
+// tagResult is the outcome of tagging a single configured version.
+type tagResult struct {
+	Version string
+	Tag     string
+	SHA     string
+	URL     string
+	Err     error
+}
+
+func newTagResult(v string, opts *repository.CreateRefOpts, ref *github.Reference, err error) tagResult {
+	result := tagResult{Version: v, Err: err}
+	if err != nil {
+		return result
+	}
+
+	result.Tag = opts.Tag
+	if ref != nil {
+		result.SHA = ref.GetObject().GetSHA()
+		result.URL = "https://github.com/" + opts.Owner + "/" + opts.Repo + "/tree/" + opts.Tag
+	}
+
+	return result
+}
+
+// validateTagArgs checks the arguments of the commands that tag either a
+// single version or, with --all, every version in the config.
+func validateTagArgs(args []string, all bool) error {
+	if all {
+		if len(args) != 1 {
+			return errors.New("expected a single argument with --all: [ga,rc]")
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return errors.New("expected at least two arguments: [ga,rc] [version]")
+	}
+	return nil
+}
+
+// tagVersions tags every version with at most concurrencyLimit tags being
+// created at once. A failure doesn't stop the other versions from being
+// tagged; the results are printed at the end and an error is returned if
+// any of them failed.
+func tagVersions(w io.Writer, versions []string, tag func(string) tagResult) error {
+	sortVersions(versions)
+
+	results := make([]tagResult, len(versions))
+
+	var g errgroup.Group
+	g.SetLimit(max(concurrencyLimit, 1))
+
+	for i, v := range versions {
+		g.Go(func() error {
+			results[i] = tag(v)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return printTagResults(w, results)
+}
+
+func printTagResults(w io.Writer, results []tagResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "version\ttag\tsha\turl\terror")
+	fmt.Fprintln(tw, "-------\t---\t---\t---\t-----")
+
+	var failed int
+	for _, result := range results {
+		var errMsg string
+		if result.Err != nil {
+			failed++
+			errMsg = result.Err.Error()
+		}
+		tw.Write([]byte(strings.Join([]string{
+			result.Version,
+			result.Tag,
+			result.SHA,
+			result.URL,
+			errMsg,
+		}, "\t") + "\n"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(results)) + " versions failed to be tagged")
+	}
+
+	return nil
+}
+
+// sortVersions sorts versions in ascending order, versions that can't be
+// parsed are sorted lexically after the valid ones.
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		a, errA := version.Parse(versions[i])
+		b, errB := version.Parse(versions[j])
+		switch {
+		case errA == nil && errB == nil:
+			return a.Compare(b) < 0
+		case errA == nil:
+			return true
+		case errB == nil:
+			return false
+		}
+		return versions[i] < versions[j]
+	})
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+func TestTagVersions(t *testing.T) {
+	versions := []string{"v1.30.1", "v1.28.9", "v1.29.4"}
+
+	var buf bytes.Buffer
+	err := tagVersions(&buf, versions, func(v string) tagResult {
+		if v == "v1.29.4" {
+			return tagResult{Version: v, Err: errors.New("couldn't find the latest RC")}
+		}
+		return tagResult{Version: v, Tag: v + "-rc1+rke2r1", SHA: "abc"}
+	})
+	if err == nil || err.Error() != "1 of 3 versions failed to be tagged" {
+		t.Errorf("tagVersions() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	for i, v := range []string{"v1.28.9", "v1.29.4", "v1.30.1"} {
+		if !strings.HasPrefix(lines[i+2], v) {
+			t.Errorf("line %d = %q, expected it to start with %s", i+2, lines[i+2], v)
+		}
+	}
+	if !strings.Contains(lines[3], "couldn't find the latest RC") {
+		t.Errorf("line 3 = %q, expected the error", lines[3])
+	}
+}
+
+func TestValidateTagArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		all     bool
+		wantErr bool
+	}{
+		{args: []string{"rc", "v1.30.1"}},
+		{args: []string{"rc"}, wantErr: true},
+		{args: []string{"rc"}, all: true},
+		{args: []string{"rc", "v1.30.1"}, all: true, wantErr: true},
+		{args: []string{}, all: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateTagArgs(tt.args, tt.all); (err != nil) != tt.wantErr {
+			t.Errorf("validateTagArgs(%v, %v) error = %v, wantErr %v", tt.args, tt.all, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewTagResult(t *testing.T) {
+	opts := &repository.CreateRefOpts{Owner: "rancher", Repo: "rke2", Tag: "v1.30.1-rc1+rke2r1"}
+	ref := &github.Reference{Object: &github.GitObject{SHA: github.Ptr("abc")}}
+
+	result := newTagResult("v1.30.1", opts, ref, nil)
+	if want := "https://github.com/rancher/rke2/tree/v1.30.1-rc1+rke2r1"; result.URL != want {
+		t.Errorf("newTagResult() URL = %s, want %s", result.URL, want)
+	}
+	if result.SHA != "abc" {
+		t.Errorf("newTagResult() SHA = %s, want abc", result.SHA)
+	}
+}
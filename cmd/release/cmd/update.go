@@ -7,17 +7,22 @@ import (
 	"os"
 	"strings"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/rancher/ecm-distro-tools/cmd/release/config"
 	"github.com/rancher/ecm-distro-tools/release/charts"
 	"github.com/rancher/ecm-distro-tools/release/cli"
 	"github.com/rancher/ecm-distro-tools/release/k3s"
 	"github.com/rancher/ecm-distro-tools/release/rancher"
 	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
 
+var (
+	k3sGoProxy                string
+	rke2ReferencesInteractive bool
+)
+
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update files and other utilities",
@@ -50,7 +55,7 @@ var updateK3sReferencesCmd = &cobra.Command{
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
 
-		return k3s.UpdateK3sReferences(ctx, ghClient, &k3sRelease, rootConfig.User)
+		return k3s.UpdateK3sReferences(ctx, ghClient, &k3sRelease, rootConfig.User, rootConfig.Auth.SSHKeyPath, k3sGoProxy)
 	},
 }
 
@@ -81,7 +86,7 @@ var updateRKE2ReferencesCmd = &cobra.Command{
 			return fmt.Errorf("failed to create github client: %v", err)
 		}
 
-		return rke2.UpdateRKE2References(ctx, ghClient, &rke2Release, rootConfig.User)
+		return rke2.UpdateRKE2References(ctx, ghClient, &rke2Release, rootConfig.User, rootConfig.Auth.SSHKeyPath, rke2ReferencesInteractive)
 	},
 }
 
@@ -191,8 +196,7 @@ var updateRancherDashboardCmd = &cobra.Command{
 		tag := args[0]
 
 		// checking if the provided version is valid
-		_, err := semver.NewVersion(tag)
-		if err != nil {
+		if _, err := version.Parse(tag); err != nil {
 			return err
 		}
 
@@ -243,7 +247,7 @@ var updateRancherCLICmd = &cobra.Command{
 		tag := args[0]
 
 		// checking if the provided version is valid
-		if _, err := semver.NewVersion(tag); err != nil {
+		if _, err := version.Parse(tag); err != nil {
 			return err
 		}
 
@@ -295,7 +299,7 @@ var updateCLICmd = &cobra.Command{
 		tag := args[0]
 
 		// checking if the provided version is valid
-		if _, err := semver.NewVersion(tag); err != nil {
+		if _, err := version.Parse(tag); err != nil {
 			return fmt.Errorf("cli version not semver valid: %v", err)
 		}
 
@@ -377,12 +381,14 @@ func init() {
 	updateCmd.AddCommand(updateChartsCmd)
 	updateCmd.AddCommand(updateK3sCmd)
 	updateK3sCmd.AddCommand(updateK3sReferencesCmd)
+	updateK3sReferencesCmd.Flags().StringVar(&k3sGoProxy, "goproxy", k3s.GoProxy(), "Go module proxy to resolve the new module references with before updating them, empty to skip")
 	updateCmd.AddCommand(updateRancherCmd)
 	updateRancherCmd.AddCommand(updateRancherDashboardCmd)
 	updateRancherCmd.AddCommand(updateRancherCLICmd)
 	updateCmd.AddCommand(updateCLICmd)
 	updateCmd.AddCommand(updateRKE2Cmd)
 	updateRKE2Cmd.AddCommand(updateRKE2ReferencesCmd)
+	updateRKE2ReferencesCmd.Flags().BoolVarP(&rke2ReferencesInteractive, "interactive", "i", false, "Ask to approve the changes of each file before committing them")
 }
 
 func validateChartConfig() error {
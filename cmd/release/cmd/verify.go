@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/k3s"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that release artifacts were published as expected",
+}
+
+var verifyK3sSubCmd = &cobra.Command{
+	Use:   "k3s",
+	Short: "Verify k3s release artifacts",
+}
+
+var verifyRKE2SubCmd = &cobra.Command{
+	Use:   "rke2",
+	Short: "Verify rke2 release artifacts",
+}
+
+var verifyAssetsOutput string
+
+var verifyAssetsStrict bool
+
+var verifyK3sAssetsSubCmd = &cobra.Command{
+	Use:     "assets [tag]",
+	Short:   "Verify the assets and checksums of a published k3s release",
+	Example: "release verify k3s assets v1.30.2+k3s1 --output json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [tag]")
+		}
+		return verifyAssets("k3s", config.K3sGithubOrganization, config.K3sRepositoryName, args[0])
+	},
+}
+
+var verifyRKE2AssetsSubCmd = &cobra.Command{
+	Use:     "assets [tag]",
+	Short:   "Verify the assets and checksums of a published rke2 release",
+	Example: "release verify rke2 assets v1.30.2+rke2r1 --output json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [tag]")
+		}
+		return verifyAssets("rke2", config.RancherGithubOrganization, config.RKE2RepositoryName, args[0])
+	},
+}
+
+func verifyAssets(product, owner, repo, tag string) error {
+	expected, err := release.ExpectedAssets(product, tag)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+	if err != nil {
+		return fmt.Errorf("failed to create github client: %v", err)
+	}
+	filesystem, err := release.NewFS(ctx, ghClient, owner, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	checks, err := release.CheckAssets(filesystem, expected)
+	if err != nil {
+		return err
+	}
+
+	return release.WriteAssetChecks(os.Stdout, checks, verifyAssetsOutput, verifyAssetsStrict)
+}
+
+var verifyK3sTagsSubCmd = &cobra.Command{
+	Use:     "tags [version]",
+	Short:   "Verify the k3s-io/kubernetes tags were pushed to the k3s-io remote",
+	Example: "release verify k3s tags v1.30.2",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+		version := args[0]
+		k3sRelease, found := rootConfig.K3s.Versions[version]
+		if !found {
+			return NewVersionNotFoundError(version, "k3s")
+		}
+		return k3s.VerifyTags(&k3sRelease, rootConfig.Auth.SSHKeyPath, os.Stdout)
+	},
+}
+
+var verifyK3sModulesSubCmd = &cobra.Command{
+	Use:     "modules [version]",
+	Short:   "Verify the modules the updated k3s go.mod references resolve through the Go module proxy",
+	Example: "release verify k3s modules v1.30.2 --goproxy http://localhost:3000",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+		version := args[0]
+		k3sRelease, found := rootConfig.K3s.Versions[version]
+		if !found {
+			return NewVersionNotFoundError(version, "k3s")
+		}
+		if k3sGoProxy == "" {
+			return errors.New("--goproxy can't be empty")
+		}
+		ctx := context.Background()
+		ghClient, err := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+		if err != nil {
+			return fmt.Errorf("failed to create github client: %v", err)
+		}
+		return k3s.CheckModuleProxy(ctx, ghClient, &k3sRelease, k3sGoProxy, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.AddCommand(verifyK3sSubCmd)
+	verifyK3sSubCmd.AddCommand(verifyK3sTagsSubCmd)
+	verifyK3sSubCmd.AddCommand(verifyK3sModulesSubCmd)
+	verifyK3sModulesSubCmd.Flags().StringVar(&k3sGoProxy, "goproxy", k3s.GoProxy(), "Go module proxy to resolve the modules with")
+	verifyK3sSubCmd.AddCommand(verifyK3sAssetsSubCmd)
+
+	verifyCmd.AddCommand(verifyRKE2SubCmd)
+	verifyRKE2SubCmd.AddCommand(verifyRKE2AssetsSubCmd)
+
+	for _, c := range []*cobra.Command{verifyK3sAssetsSubCmd, verifyRKE2AssetsSubCmd} {
+		c.Flags().StringVarP(&verifyAssetsOutput, "output", "o", "table", "Output format (table|json)")
+		c.Flags().BoolVar(&verifyAssetsStrict, "strict", false, "Fail on assets whose digest couldn't be verified")
+	}
+}
@@ -19,6 +19,7 @@ const (
 	K3sGithubOrganization       = "k3s-io"
 	K3sRepositoryName           = "k3s"
 	K3sK8sRepositoryName        = "kubernetes"
+	RKE2RepositoryName          = "rke2"
 	ImageScanningRepositoryName = "image-scanning"
 )
 
@@ -169,28 +170,115 @@ type Auth struct {
 	AWSSecretAccessKey string `json:"aws_secret_access_key"`
 	AWSSessionToken    string `json:"aws_session_token"`
 	AWSDefaultRegion   string `json:"aws_default_region"`
+	// Registries are the credentials of the container registries, keyed by
+	// host. Registries without credentials use the docker config ones.
+	Registries map[string]RegistryCredentials `json:"registries"`
+}
+
+// RegistryCredentials are the basic auth credentials of a registry.
+type RegistryCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Registry is the definition of a container registry. BaseURL is where its
+// API is served, http:// for an insecure one like a local registry:2. AuthURL
+// and Service override the token endpoint the registry advertises, and the
+// credentials are read from the UsernameEnv and PasswordEnv environment
+// variables, unless auth.registries has some for the registry.
+type Registry struct {
+	BaseURL     string `json:"base_url"`
+	AuthURL     string `json:"auth_url"`
+	Service     string `json:"service"`
+	UsernameEnv string `json:"username_env"`
+	PasswordEnv string `json:"password_env"`
+}
+
+// DefaultRegistries are the definitions of the registries the images are
+// released to, used unless the config defines them.
+var DefaultRegistries = map[string]Registry{
+	"registry.rancher.com": {
+		BaseURL:     "https://registry.rancher.com",
+		AuthURL:     "https://scc.suse.com/api/registry/authorize",
+		Service:     "SUSE Linux Docker Registry",
+		UsernameEnv: "PRIME_REGISTRY_USERNAME",
+		PasswordEnv: "PRIME_REGISTRY_PASSWORD",
+	},
+	SuseStageRegistry: {
+		BaseURL:     "https://stgregistry.suse.com",
+		AuthURL:     "https://stgscc.suse.com/api/registry/authorize",
+		Service:     "SUSE Linux Docker Registry",
+		UsernameEnv: "STAGING_REGISTRY_USERNAME",
+		PasswordEnv: "STAGING_REGISTRY_PASSWORD",
+	},
+	"docker.io": {
+		BaseURL:     "https://index.docker.io",
+		AuthURL:     "https://auth.docker.io/token",
+		Service:     "registry.docker.io",
+		UsernameEnv: "DOCKERIO_REGISTRY_USERNAME",
+		PasswordEnv: "DOCKERIO_REGISTRY_PASSWORD",
+	},
+}
+
+// Signatures configures how the cosign signatures of the release images are
+// verified. Keys and certificates are paths to PEM encoded files.
+type Signatures struct {
+	PublicKeys  []string            `json:"public_keys"`
+	FulcioRoots string              `json:"fulcio_roots"`
+	RekorKeys   []string            `json:"rekor_keys"`
+	Identities  []SignatureIdentity `json:"identities"`
+}
+
+// SignatureIdentity is an identity trusted to sign images keyless.
+type SignatureIdentity struct {
+	Issuer        string `json:"issuer"`
+	SubjectRegexp string `json:"subject_regexp"`
+}
+
+// WindowsBuild is a Windows Server release the rke2 Windows images are
+// expected to have a manifest for, e.g. ltsc2022 with the os.version
+// 10.0.20348.
+type WindowsBuild struct {
+	Name      string `json:"name"`
+	OSVersion string `json:"os_version"`
 }
 
 // Config
 type Config struct {
-	User                       *User          `json:"user"`
-	K3s                        *K3s           `json:"k3s"`
-	Rancher                    *Rancher       `json:"rancher"`
-	RKE2                       *RKE2          `json:"rke2"`
-	Charts                     *ChartsRelease `json:"charts"`
-	Auth                       *Auth          `json:"auth"`
-	Dashboard                  *Dashboard     `json:"dashboard"`
-	CLI                        *CLI           `json:"cli"`
-	PrimeRegistry              string         `json:"prime_registry"`
-	RancherGithubOrganization  string         `json:"rancher_github_organization"`
-	RancherRepositoryName      string         `json:"rancher_repository_name"`
-	RancherPrimeRepositoryName string         `json:"rancher_prime_repository_name"`
-	RancherRepositoryGitURI    string         `json:"rancher_repository_git_uri"`
-	RancherRepositoryURL       string         `json:"rancher_repository_url"`
-	UIRepositoryName           string         `json:"ui_repository_name"`
-	DashboardRepositoryName    string         `json:"dashboard_repository_name"`
-	CLIRepositoryName          string         `json:"cli_repository_name"`
-	CLIRepositoryURL           string         `json:"cli_repository_url"`
+	User                       *User               `json:"user"`
+	K3s                        *K3s                `json:"k3s"`
+	Rancher                    *Rancher            `json:"rancher"`
+	RKE2                       *RKE2               `json:"rke2"`
+	Charts                     *ChartsRelease      `json:"charts"`
+	Auth                       *Auth               `json:"auth"`
+	Dashboard                  *Dashboard          `json:"dashboard"`
+	CLI                        *CLI                `json:"cli"`
+	PrimeRegistry              string              `json:"prime_registry"`
+	Registries                 map[string]Registry `json:"registries"`
+	Signatures                 *Signatures         `json:"signatures"`
+	WindowsBuilds              []WindowsBuild      `json:"windows_builds"`
+	RancherGithubOrganization  string              `json:"rancher_github_organization"`
+	RancherRepositoryName      string              `json:"rancher_repository_name"`
+	RancherPrimeRepositoryName string              `json:"rancher_prime_repository_name"`
+	RancherRepositoryGitURI    string              `json:"rancher_repository_git_uri"`
+	RancherRepositoryURL       string              `json:"rancher_repository_url"`
+	UIRepositoryName           string              `json:"ui_repository_name"`
+	DashboardRepositoryName    string              `json:"dashboard_repository_name"`
+	CLIRepositoryName          string              `json:"cli_repository_name"`
+	CLIRepositoryURL           string              `json:"cli_repository_url"`
+}
+
+// RegistryDefinitions returns the definitions of the registries of the
+// config, added to the default ones.
+func (c *Config) RegistryDefinitions() map[string]Registry {
+	registries := make(map[string]Registry, len(DefaultRegistries)+len(c.Registries))
+	for host, registry := range DefaultRegistries {
+		registries[host] = registry
+	}
+	for host, registry := range c.Registries {
+		registries[host] = registry
+	}
+	return registries
 }
 
 // Load reads the given config file and returns a struct
@@ -293,7 +381,12 @@ func ExampleConfig() (string, error) {
 			AWSSessionToken:    "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
 			AWSDefaultRegion:   "us-east-1",
 		},
-		PrimeRegistry:             "example.com",
+		PrimeRegistry: "example.com",
+		Registries: map[string]Registry{
+			"localhost:5000": {
+				BaseURL: "http://localhost:5000",
+			},
+		},
 		RancherGithubOrganization: RancherGithubOrganization,
 		RancherRepositoryName:     RancherRepositoryName,
 		RancherRepositoryGitURI:   RancherRepositoryGitURI,
@@ -301,6 +394,16 @@ func ExampleConfig() (string, error) {
 		UIRepositoryName:          UIRepositoryName,
 		DashboardRepositoryName:   DashboardRepositoryName,
 		CLIRepositoryName:         CLIRepositoryName,
+		Signatures: &Signatures{
+			PublicKeys:  []string{"path/to/cosign.pub"},
+			FulcioRoots: "path/to/fulcio.pem",
+			Identities: []SignatureIdentity{
+				{
+					Issuer:        "https://token.actions.githubusercontent.com",
+					SubjectRegexp: "^https://github.com/rancher/",
+				},
+			},
+		},
 	}
 	b, err := json.MarshalIndent(conf, "", "  ")
 	if err != nil {
@@ -0,0 +1,224 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	AttestationSBOM       = "sbom"
+	AttestationProvenance = "provenance"
+
+	// buildkit adds an attestation manifest to the index for each platform
+	// manifest, referenced by digest in its annotations.
+	buildkitReferenceTypeAnnotation   = "vnd.docker.reference.type"
+	buildkitReferenceDigestAnnotation = "vnd.docker.reference.digest"
+	buildkitAttestationManifest       = "attestation-manifest"
+
+	inTotoPredicateTypeAnnotation = "in-toto.io/predicate-type"
+	cosignPredicateTypeAnnotation = "predicateType"
+)
+
+// Attestations are the kinds of attestations found for a platform of an
+// image.
+type Attestations struct {
+	SBOM       bool
+	Provenance bool
+}
+
+// Has reports whether the attestation of kind, sbom or provenance, was
+// found.
+func (a Attestations) Has(kind string) bool {
+	switch kind {
+	case AttestationSBOM:
+		return a.SBOM
+	case AttestationProvenance:
+		return a.Provenance
+	}
+	return false
+}
+
+func (a *Attestations) add(o Attestations) {
+	a.SBOM = a.SBOM || o.SBOM
+	a.Provenance = a.Provenance || o.Provenance
+}
+
+// classifyAttestation returns the attestation an in-toto predicate type or
+// an artifact type is for.
+func classifyAttestation(kind string) Attestations {
+	switch {
+	case strings.HasPrefix(kind, "https://spdx.dev/Document"),
+		strings.HasPrefix(kind, "https://cyclonedx.org/bom"),
+		kind == "application/spdx+json",
+		kind == "text/spdx",
+		kind == "application/vnd.cyclonedx+json":
+		return Attestations{SBOM: true}
+	case strings.HasPrefix(kind, "https://slsa.dev/provenance/"):
+		return Attestations{Provenance: true}
+	}
+	return Attestations{}
+}
+
+// CheckAttestations makes Image list the attestations of the images that
+// exist.
+func (c *Client) CheckAttestations(enabled bool) {
+	c.attestations = enabled
+}
+
+// Attestations lists the SBOM and provenance attestations of each platform
+// of ref. They are looked up in the buildkit attestation manifests of the
+// index, the cosign sha256-<digest>.att tag and the OCI referrers of the
+// image and of its platform manifests. Attestations of the whole image apply
+// to every platform.
+func (c *Client) Attestations(ctx context.Context, ref name.Reference) (map[Platform]Attestations, error) {
+	tagRef, err := c.reference(ref)
+	if err != nil {
+		return nil, err
+	}
+	repo := tagRef.Context()
+
+	desc, err := remote.Get(tagRef, c.options(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := make(map[Platform]v1.Hash)
+	attestations := make(map[Platform]Attestations)
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+
+		byDigest := make(map[string]Platform)
+		for _, m := range manifest.Manifests {
+			if m.Annotations[buildkitReferenceTypeAnnotation] == buildkitAttestationManifest || m.Platform == nil {
+				continue
+			}
+			platform := Platform{OS: m.Platform.OS, Architecture: m.Platform.Architecture}
+			platforms[platform] = m.Digest
+			byDigest[m.Digest.String()] = platform
+		}
+
+		for _, m := range manifest.Manifests {
+			if m.Annotations[buildkitReferenceTypeAnnotation] != buildkitAttestationManifest {
+				continue
+			}
+			platform, ok := byDigest[m.Annotations[buildkitReferenceDigestAnnotation]]
+			if !ok {
+				continue
+			}
+			found, err := c.manifestAttestations(ctx, repo.Digest(m.Digest.String()), inTotoPredicateTypeAnnotation)
+			if err != nil {
+				return nil, err
+			}
+			a := attestations[platform]
+			a.add(found)
+			attestations[platform] = a
+		}
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		platforms[Platform{OS: cfg.OS, Architecture: cfg.Architecture}] = desc.Digest
+	}
+
+	image, err := c.imageAttestations(ctx, repo, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	for platform, digest := range platforms {
+		a := attestations[platform]
+		a.add(image)
+		if digest != desc.Digest {
+			found, err := c.referrerAttestations(ctx, repo, digest)
+			if err != nil {
+				return nil, err
+			}
+			a.add(found)
+		}
+		attestations[platform] = a
+	}
+
+	return attestations, nil
+}
+
+// imageAttestations returns the attestations of the cosign .att tag and the
+// OCI referrers of digest.
+func (c *Client) imageAttestations(ctx context.Context, repo name.Repository, digest v1.Hash) (Attestations, error) {
+	attTag := repo.Tag(digest.Algorithm + "-" + digest.Hex + ".att")
+
+	found, err := c.manifestAttestations(ctx, attTag, cosignPredicateTypeAnnotation)
+	if err != nil {
+		var transportErr *transport.Error
+		if !errors.As(err, &transportErr) || transportErr.StatusCode != http.StatusNotFound {
+			return Attestations{}, err
+		}
+	}
+
+	referrers, err := c.referrerAttestations(ctx, repo, digest)
+	if err != nil {
+		return Attestations{}, err
+	}
+	found.add(referrers)
+
+	return found, nil
+}
+
+// referrerAttestations classifies the OCI referrers of digest by their
+// artifact type, or the predicate type of their layers for in-toto and
+// sigstore bundle referrers.
+func (c *Client) referrerAttestations(ctx context.Context, repo name.Repository, digest v1.Hash) (Attestations, error) {
+	idx, err := remote.Referrers(repo.Digest(digest.String()), c.options(ctx)...)
+	if err != nil {
+		return Attestations{}, err
+	}
+	referrers, err := idx.IndexManifest()
+	if err != nil {
+		return Attestations{}, err
+	}
+
+	var found Attestations
+	for _, referrer := range referrers.Manifests {
+		found.add(classifyAttestation(referrer.ArtifactType))
+		for _, annotation := range []string{inTotoPredicateTypeAnnotation, "dev.sigstore.bundle.predicateType"} {
+			found.add(classifyAttestation(referrer.Annotations[annotation]))
+		}
+	}
+
+	return found, nil
+}
+
+// manifestAttestations classifies the layers of a manifest by the predicate
+// type in their annotation.
+func (c *Client) manifestAttestations(ctx context.Context, ref name.Reference, annotation string) (Attestations, error) {
+	m, err := c.manifest(ctx, ref)
+	if err != nil {
+		return Attestations{}, err
+	}
+
+	var found Attestations
+	for _, layer := range m.Layers {
+		found.add(classifyAttestation(layer.Annotations[annotation]))
+	}
+
+	return found, nil
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// attestationImage returns an image with a layer per predicate type,
+// annotated with annotation.
+func attestationImage(t *testing.T, annotation string, predicateTypes ...string) v1.Image {
+	t.Helper()
+
+	img := empty.Image
+	for _, predicateType := range predicateTypes {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(predicateType), "application/vnd.in-toto+json"),
+			Annotations: map[string]string{annotation: predicateType},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return img
+}
+
+func platformImage(t *testing.T, platform Platform) v1.Image {
+	t.Helper()
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS = platform.OS
+	cfg.Architecture = platform.Architecture
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestClientAttestations(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amd64 := Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := Platform{OS: "linux", Architecture: "arm64"}
+
+	// multi arch image built by buildkit, with attestations for amd64 only
+	amd64Img := platformImage(t, amd64)
+	amd64Digest, err := amd64Img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex),
+		mutate.IndexAddendum{
+			Add:        amd64Img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		},
+		mutate.IndexAddendum{
+			Add:        platformImage(t, arm64),
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+		},
+		mutate.IndexAddendum{
+			Add: attestationImage(t, inTotoPredicateTypeAnnotation, "https://spdx.dev/Document", "https://slsa.dev/provenance/v0.2"),
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"},
+				Annotations: map[string]string{
+					buildkitReferenceTypeAnnotation:   buildkitAttestationManifest,
+					buildkitReferenceDigestAnnotation: amd64Digest.String(),
+				},
+			},
+		},
+	)
+	multiRef, err := name.ParseReference(u.Host + "/rancher/multi:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(multiRef, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	// single arch image with a cosign provenance attestation
+	singleImg := platformImage(t, amd64)
+	singleRef, err := name.ParseReference(u.Host + "/rancher/single:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(singleRef, singleImg); err != nil {
+		t.Fatal(err)
+	}
+	singleDigest, err := singleImg.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	attRef := singleRef.Context().Tag(singleDigest.Algorithm + "-" + singleDigest.Hex + ".att")
+	if err := remote.Write(attRef, attestationImage(t, cosignPredicateTypeAnnotation, "https://slsa.dev/provenance/v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		image         string
+		want          map[Platform]Attestations
+		wantPlatforms []Platform
+	}{
+		{
+			image: "rancher/multi:v1",
+			want: map[Platform]Attestations{
+				amd64: {SBOM: true, Provenance: true},
+				arm64: {},
+			},
+			wantPlatforms: []Platform{amd64, arm64},
+		},
+		{
+			image: "rancher/single:v1",
+			want: map[Platform]Attestations{
+				amd64: {Provenance: true},
+			},
+			wantPlatforms: []Platform{amd64},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			client := NewClient(u.Host, false)
+			client.CheckAttestations(true)
+
+			ref, err := name.ParseReference(tt.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := client.Image(context.Background(), ref)
+			if err != nil {
+				t.Fatalf("Image() error = %v", err)
+			}
+			if len(img.Attestations) != len(tt.want) {
+				t.Fatalf("Image() attestations = %v, want %v", img.Attestations, tt.want)
+			}
+			for platform, want := range tt.want {
+				if got := img.Attestations[platform]; got != want {
+					t.Errorf("%s attestations = %+v, want %+v", platform, got, want)
+				}
+			}
+			if len(img.Platforms) != len(tt.wantPlatforms) || len(img.PlatformDigests) != len(tt.wantPlatforms) {
+				t.Errorf("Image() platforms = %v, want %v", img.Platforms, tt.wantPlatforms)
+			}
+			for _, platform := range tt.wantPlatforms {
+				if !img.Platforms[platform] {
+					t.Errorf("Image() platforms = %v, want %s", img.Platforms, platform)
+				}
+			}
+		})
+	}
+}
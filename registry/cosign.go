@@ -0,0 +1,465 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	SignatureVerified = "verified"
+	SignatureInvalid  = "invalid"
+	SignatureUnsigned = "unsigned"
+	SignatureError    = "error"
+
+	cosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	cosignBundleAnnotation      = "dev.sigstore.cosign/bundle"
+	cosignSignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+)
+
+var (
+	// fulcioIssuerOID is the deprecated OIDC issuer extension, stored as a
+	// raw string, fulcioIssuerV2OID replaces it with a DER UTF8String.
+	fulcioIssuerOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Signature is the result of verifying the cosign signatures of an image.
+type Signature struct {
+	Status string
+	// Reason explains an invalid or error status.
+	Reason string
+}
+
+// SignaturePolicy is what the cosign signatures of an image are verified
+// against. Signatures made with a key are verified with PublicKeys, and
+// keyless ones with a Fulcio certificate must chain to Roots and match one
+// of the Identities.
+type SignaturePolicy struct {
+	PublicKeys    []crypto.PublicKey
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+	Identities    []KeylessIdentity
+	// RekorKeys verify the signed entry timestamp of the transparency log
+	// bundle of keyless signatures, which can't be verified without them.
+	RekorKeys []crypto.PublicKey
+}
+
+// KeylessIdentity matches the OIDC issuer and the subject, the SAN email or
+// URI, of a Fulcio certificate.
+type KeylessIdentity struct {
+	Issuer  string
+	Subject *regexp.Regexp
+}
+
+// ParsePublicKeys parses the PEM encoded public keys in b.
+func ParsePublicKeys(b []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.New("invalid public key: " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+
+	return keys, nil
+}
+
+// SetSignaturePolicy makes Image verify the cosign signatures of the images
+// that exist with the given policy.
+func (c *Client) SetSignaturePolicy(policy *SignaturePolicy) {
+	c.policy = policy
+}
+
+// Signature looks up the cosign signatures of ref, from its
+// sha256-<digest>.sig tag or its OCI referrers, and verifies them with the
+// signature policy of the client.
+func (c *Client) Signature(ctx context.Context, ref name.Reference) Signature {
+	if c.policy == nil {
+		return Signature{Status: SignatureError, Reason: "no signature policy configured"}
+	}
+
+	tagRef, err := c.reference(ref)
+	if err != nil {
+		return Signature{Status: SignatureError, Reason: err.Error()}
+	}
+
+	desc, err := remote.Head(tagRef, c.options(ctx)...)
+	if err != nil {
+		return Signature{Status: SignatureError, Reason: err.Error()}
+	}
+
+	manifests, err := c.signatureManifests(ctx, tagRef.Context(), desc.Digest)
+	if err != nil {
+		return Signature{Status: SignatureError, Reason: err.Error()}
+	}
+	if len(manifests) == 0 {
+		return Signature{Status: SignatureUnsigned}
+	}
+
+	reason := "no signature layers"
+	for _, m := range manifests {
+		for _, layer := range m.Layers {
+			if _, ok := layer.Annotations[cosignSignatureAnnotation]; !ok {
+				continue
+			}
+			payload, err := c.blob(ctx, tagRef.Context(), layer.Digest)
+			if err != nil {
+				return Signature{Status: SignatureError, Reason: err.Error()}
+			}
+			if err := c.policy.verify(payload, layer.Annotations, desc.Digest); err != nil {
+				reason = err.Error()
+				continue
+			}
+			return Signature{Status: SignatureVerified}
+		}
+	}
+
+	return Signature{Status: SignatureInvalid, Reason: reason}
+}
+
+// signatureManifests returns the manifests of the cosign signatures of the
+// image digest in repo.
+func (c *Client) signatureManifests(ctx context.Context, repo name.Repository, digest v1.Hash) ([]*v1.Manifest, error) {
+	sigTag := repo.Tag(digest.Algorithm + "-" + digest.Hex + ".sig")
+
+	m, err := c.manifest(ctx, sigTag)
+	if err == nil {
+		return []*v1.Manifest{m}, nil
+	}
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) || transportErr.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	idx, err := remote.Referrers(repo.Digest(digest.String()), append(c.options(ctx), remote.WithFilter("artifactType", cosignSignatureArtifactType))...)
+	if err != nil {
+		return nil, err
+	}
+	referrers, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*v1.Manifest
+	for _, referrer := range referrers.Manifests {
+		if referrer.ArtifactType != cosignSignatureArtifactType {
+			continue
+		}
+		m, err := c.manifest(ctx, repo.Digest(referrer.Digest.String()))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
+func (c *Client) manifest(ctx context.Context, ref name.Reference) (*v1.Manifest, error) {
+	desc, err := remote.Get(ref, c.options(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	return v1.ParseManifest(bytes.NewReader(desc.Manifest))
+}
+
+func (c *Client) blob(ctx context.Context, repo name.Repository, digest v1.Hash) ([]byte, error) {
+	layer, err := remote.Layer(repo.Digest(digest.String()), c.options(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// verify checks that payload is a simple signing payload of digest, and
+// that its signature in annotations is valid for the policy.
+func (p *SignaturePolicy) verify(payload []byte, annotations map[string]string, digest v1.Hash) error {
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+		return errors.New("invalid signature payload: " + err.Error())
+	}
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest.String() {
+		return errors.New("signature is for " + simpleSigning.Critical.Image.DockerManifestDigest)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(annotations[cosignSignatureAnnotation])
+	if err != nil {
+		return errors.New("invalid signature encoding: " + err.Error())
+	}
+
+	if certPEM, ok := annotations[cosignCertificateAnnotation]; ok && certPEM != "" {
+		return p.verifyKeyless(payload, sig, certPEM, annotations)
+	}
+
+	if len(p.PublicKeys) == 0 {
+		return errors.New("signed with a key but no public keys are configured")
+	}
+	for _, key := range p.PublicKeys {
+		if verifySignature(key, payload, sig) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("signature doesn't match any of the public keys")
+}
+
+// verifyKeyless verifies a signature made with a Fulcio certificate. The
+// certificate is short lived, it's checked at the time of the transparency
+// log entry of the bundle.
+func (p *SignaturePolicy) verifyKeyless(payload, sig []byte, certPEM string, annotations map[string]string) error {
+	if p.Roots == nil || len(p.Identities) == 0 {
+		return errors.New("signed keyless but no roots or identities are configured")
+	}
+	if len(p.RekorKeys) == 0 {
+		return errors.New("signed keyless but no rekor keys are configured")
+	}
+
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return errors.New("invalid signing certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.New("invalid signing certificate: " + err.Error())
+	}
+
+	integratedTime, err := p.bundleTime(annotations[cosignBundleAnnotation], payload, sig, cert)
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	if p.Intermediates != nil {
+		intermediates = p.Intermediates.Clone()
+	}
+	if chain := annotations[cosignChainAnnotation]; chain != "" {
+		intermediates.AppendCertsFromPEM([]byte(chain))
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         p.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   integratedTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return errors.New("untrusted signing certificate: " + err.Error())
+	}
+
+	if err := p.matchIdentity(cert); err != nil {
+		return err
+	}
+
+	return verifySignature(cert.PublicKey, payload, sig)
+}
+
+// bundleTime returns the integrated time of the transparency log bundle,
+// after verifying its signed entry timestamp with the Rekor keys and that
+// its entry is for the signature of payload with cert.
+func (p *SignaturePolicy) bundleTime(bundle string, payload, sig []byte, cert *x509.Certificate) (time.Time, error) {
+	if bundle == "" {
+		return time.Time{}, errors.New("keyless signature without a transparency log bundle")
+	}
+
+	var b struct {
+		SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+		Payload              struct {
+			Body           string `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogIndex       int64  `json:"logIndex"`
+			LogID          string `json:"logID"`
+		} `json:"Payload"`
+	}
+	if err := json.Unmarshal([]byte(bundle), &b); err != nil {
+		return time.Time{}, errors.New("invalid transparency log bundle: " + err.Error())
+	}
+
+	// the entry timestamp signs the payload as canonical JSON, with sorted
+	// keys
+	canonical, err := json.Marshal(map[string]any{
+		"body":           b.Payload.Body,
+		"integratedTime": b.Payload.IntegratedTime,
+		"logIndex":       b.Payload.LogIndex,
+		"logID":          b.Payload.LogID,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var verified bool
+	for _, key := range p.RekorKeys {
+		if verifySignature(key, canonical, b.SignedEntryTimestamp) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return time.Time{}, errors.New("invalid transparency log entry timestamp")
+	}
+
+	if err := checkEntryBody(b.Payload.Body, payload, sig, cert); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(b.Payload.IntegratedTime, 0), nil
+}
+
+// checkEntryBody checks that the base64 encoded body of a transparency log
+// entry is a hashedrekord of the signature of payload with cert.
+func checkEntryBody(body string, payload, sig []byte, cert *x509.Certificate) error {
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return errors.New("invalid transparency log entry body: " + err.Error())
+	}
+
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(decoded, &entry); err != nil {
+		return errors.New("invalid transparency log entry body: " + err.Error())
+	}
+	if entry.Kind != "hashedrekord" {
+		return errors.New("unsupported transparency log entry kind " + entry.Kind)
+	}
+
+	digest := sha256.Sum256(payload)
+	if entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(digest[:]) {
+		return errors.New("transparency log entry is for another payload")
+	}
+	if !bytes.Equal(entry.Spec.Signature.Content, sig) {
+		return errors.New("transparency log entry is for another signature")
+	}
+
+	block, _ := pem.Decode(entry.Spec.Signature.PublicKey.Content)
+	if block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+		return errors.New("transparency log entry is for another certificate")
+	}
+
+	return nil
+}
+
+func (p *SignaturePolicy) matchIdentity(cert *x509.Certificate) error {
+	issuer, err := certIssuer(cert)
+	if err != nil {
+		return err
+	}
+
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+
+	for _, identity := range p.Identities {
+		if identity.Issuer != issuer {
+			continue
+		}
+		for _, subject := range subjects {
+			if identity.Subject == nil || identity.Subject.MatchString(subject) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("certificate identity " + strings.Join(subjects, ",") + " from " + issuer + " isn't trusted")
+}
+
+// certIssuer returns the OIDC issuer of a Fulcio certificate.
+func certIssuer(cert *x509.Certificate) (string, error) {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(fulcioIssuerV2OID):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err != nil {
+				return "", errors.New("invalid certificate issuer: " + err.Error())
+			}
+			return issuer, nil
+		case ext.Id.Equal(fulcioIssuerOID):
+			return string(ext.Value), nil
+		}
+	}
+
+	return "", errors.New("certificate without an OIDC issuer")
+}
+
+// verifySignature verifies sig of payload with key, ECDSA and RSA
+// signatures are made over the SHA-256 digest of the payload.
+func verifySignature(key crypto.PublicKey, payload, sig []byte) error {
+	digest := sha256.Sum256(payload)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid ecdsa signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, nil)
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, sig) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	}
+
+	return errors.New("unsupported public key type")
+}
@@ -0,0 +1,346 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+)
+
+func simpleSigningPayload(digest v1.Hash) []byte {
+	return []byte(`{"critical":{"identity":{"docker-reference":"x"},"image":{"docker-manifest-digest":"` + digest.String() + `"},"type":"cosign container image signature"},"optional":null}`)
+}
+
+func signPayload(t *testing.T, key *ecdsa.PrivateKey, payload []byte) string {
+	t.Helper()
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// pushSignedImage pushes a random image to repo:tag of the registry at host,
+// signed with key if it's not nil.
+func pushSignedImage(t *testing.T, host, repo string, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(host + "/" + repo + ":v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	if key == nil {
+		return
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := simpleSigningPayload(digest)
+	sigImg, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, "application/vnd.dev.cosign.simplesigning.v1+json"),
+		Annotations: map[string]string{cosignSignatureAnnotation: signPayload(t, key, payload)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigRef := ref.Context().Tag(digest.Algorithm + "-" + digest.Hex + ".sig")
+	if err := remote.Write(sigRef, sigImg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientSignature(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pushSignedImage(t, u.Host, "rancher/signed", signingKey)
+	pushSignedImage(t, u.Host, "rancher/unsigned", nil)
+
+	tests := []struct {
+		name  string
+		image string
+		key   crypto.PublicKey
+		want  string
+	}{
+		{name: "verified", image: "rancher/signed:v1", key: &signingKey.PublicKey, want: SignatureVerified},
+		{name: "wrong key", image: "rancher/signed:v1", key: &otherKey.PublicKey, want: SignatureInvalid},
+		{name: "unsigned", image: "rancher/unsigned:v1", key: &signingKey.PublicKey, want: SignatureUnsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(u.Host, false)
+			client.SetSignaturePolicy(&SignaturePolicy{PublicKeys: []crypto.PublicKey{tt.key}})
+
+			ref, err := name.ParseReference(tt.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := client.Image(context.Background(), ref)
+			if err != nil {
+				t.Fatalf("Image() error = %v", err)
+			}
+			if img.Signature.Status != tt.want {
+				t.Errorf("Image() signature = %+v, want %s", img.Signature, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyKeyless(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := asn1.Marshal("https://token.actions.githubusercontent.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow, err := url.Parse("https://github.com/rancher/rke2/.github/workflows/release.yml@refs/tags/v1.30.2+rke2r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Now().Add(-30 * time.Minute)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       issued,
+		NotAfter:        issued.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{workflow},
+		ExtraExtensions: []pkix.Extension{{Id: fulcioIssuerV2OID, Value: issuer}},
+	}, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}))
+
+	digest := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+	payload := simpleSigningPayload(digest)
+
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := signPayload(t, leafKey, payload)
+
+	// entryBody returns a hashedrekord entry body of the signature sig of
+	// payload with cert.
+	entryBody := func(payload []byte, sig, cert string) string {
+		digest := sha256.Sum256(payload)
+		b, err := json.Marshal(map[string]any{
+			"apiVersion": "0.0.1",
+			"kind":       "hashedrekord",
+			"spec": map[string]any{
+				"data": map[string]any{"hash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(digest[:])}},
+				"signature": map[string]any{
+					"content":   sig,
+					"publicKey": map[string]any{"content": base64.StdEncoding.EncodeToString([]byte(cert))},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	bundle := func(integrated time.Time, body string) string {
+		entry := map[string]any{
+			"body":           body,
+			"integratedTime": integrated.Unix(),
+			"logIndex":       1,
+			"logID":          "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d",
+		}
+		canonical, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set, err := base64.StdEncoding.DecodeString(signPayload(t, rekorKey, canonical))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(map[string]any{"SignedEntryTimestamp": set, "Payload": entry})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	tests := []struct {
+		name       string
+		identity   KeylessIdentity
+		integrated time.Time
+		wantErr    bool
+	}{
+		{
+			name:       "trusted identity",
+			identity:   KeylessIdentity{Issuer: "https://token.actions.githubusercontent.com", Subject: regexp.MustCompile(`^https://github.com/rancher/`)},
+			integrated: issued.Add(time.Minute),
+		},
+		{
+			name:       "untrusted subject",
+			identity:   KeylessIdentity{Issuer: "https://token.actions.githubusercontent.com", Subject: regexp.MustCompile(`^https://github.com/k3s-io/`)},
+			integrated: issued.Add(time.Minute),
+			wantErr:    true,
+		},
+		{
+			name:       "untrusted issuer",
+			identity:   KeylessIdentity{Issuer: "https://accounts.google.com"},
+			integrated: issued.Add(time.Minute),
+			wantErr:    true,
+		},
+		{
+			name:       "signed after the certificate expired",
+			identity:   KeylessIdentity{Issuer: "https://token.actions.githubusercontent.com"},
+			integrated: issued.Add(20 * time.Minute),
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &SignaturePolicy{Roots: roots, Identities: []KeylessIdentity{tt.identity}, RekorKeys: []crypto.PublicKey{&rekorKey.PublicKey}}
+			annotations := map[string]string{
+				cosignSignatureAnnotation:   sig,
+				cosignCertificateAnnotation: certPEM,
+				cosignBundleAnnotation:      bundle(tt.integrated, entryBody(payload, sig, certPEM)),
+			}
+			if err := policy.verify(payload, annotations, digest); (err != nil) != tt.wantErr {
+				t.Errorf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("other digest", func(t *testing.T) {
+		policy := &SignaturePolicy{Roots: roots, Identities: []KeylessIdentity{{Issuer: "https://token.actions.githubusercontent.com"}}, RekorKeys: []crypto.PublicKey{&rekorKey.PublicKey}}
+		other := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}
+		annotations := map[string]string{
+			cosignSignatureAnnotation:   sig,
+			cosignCertificateAnnotation: certPEM,
+			cosignBundleAnnotation:      bundle(issued.Add(time.Minute), entryBody(payload, sig, certPEM)),
+		}
+		if err := policy.verify(payload, annotations, other); err == nil {
+			t.Error("verify() error = nil, want digest mismatch")
+		}
+	})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundleTests := []struct {
+		name      string
+		rekorKeys []crypto.PublicKey
+		bundle    string
+	}{
+		{
+			name:   "no rekor keys",
+			bundle: bundle(issued.Add(time.Minute), entryBody(payload, sig, certPEM)),
+		},
+		{
+			name:      "untrusted entry timestamp",
+			rekorKeys: []crypto.PublicKey{&otherKey.PublicKey},
+			bundle:    bundle(issued.Add(time.Minute), entryBody(payload, sig, certPEM)),
+		},
+		{
+			name:      "entry of another payload",
+			rekorKeys: []crypto.PublicKey{&rekorKey.PublicKey},
+			bundle:    bundle(issued.Add(time.Minute), entryBody([]byte("other"), sig, certPEM)),
+		},
+		{
+			name:      "entry of another signature",
+			rekorKeys: []crypto.PublicKey{&rekorKey.PublicKey},
+			bundle:    bundle(issued.Add(time.Minute), entryBody(payload, signPayload(t, leafKey, payload), certPEM)),
+		},
+		{
+			name:      "entry of another certificate",
+			rekorKeys: []crypto.PublicKey{&rekorKey.PublicKey},
+			bundle:    bundle(issued.Add(time.Minute), entryBody(payload, sig, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})))),
+		},
+	}
+	for _, tt := range bundleTests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &SignaturePolicy{Roots: roots, Identities: []KeylessIdentity{{Issuer: "https://token.actions.githubusercontent.com"}}, RekorKeys: tt.rekorKeys}
+			annotations := map[string]string{
+				cosignSignatureAnnotation:   sig,
+				cosignCertificateAnnotation: certPEM,
+				cosignBundleAnnotation:      tt.bundle,
+			}
+			if err := policy.verify(payload, annotations, digest); err == nil {
+				t.Error("verify() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"context"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Filesystem returns the flattened filesystem of the image of ref for
+// platform as a tarball, with the files deleted by upper layers removed.
+// The layers are only pulled as the tarball is read.
+func (c *Client) Filesystem(ctx context.Context, ref name.Reference, platform Platform) (io.ReadCloser, error) {
+	tagRef, err := c.reference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := append(c.options(ctx), remote.WithPlatform(v1.Platform{
+		OS:           platform.OS,
+		Architecture: platform.Architecture,
+		OSVersion:    platform.OSVersion,
+	}))
+	img, err := remote.Image(tagRef, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return mutate.Extract(img), nil
+}
@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/rancher/ecm-distro-tools/internal/tartest"
+)
+
+// fileImage returns an image for platform with a layer per file, the later
+// layers overwriting the earlier ones.
+func fileImage(t *testing.T, platform Platform, files ...[2]string) v1.Image {
+	t.Helper()
+
+	img := empty.Image
+	for _, file := range files {
+		layerTar := tartest.Tarball(t, map[string][]byte{file[0]: []byte(file[1])}, nil, false)
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(layerTar)), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img, err = mutate.AppendLayers(img, layer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS = platform.OS
+	cfg.Architecture = platform.Architecture
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestClientFilesystem(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amd64 := Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := Platform{OS: "linux", Architecture: "arm64"}
+
+	idx := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex),
+		mutate.IndexAddendum{
+			Add:        fileImage(t, amd64, [2]string{"etc/os-release", "ID=sles\n"}, [2]string{"etc/os-release", "ID=alpine\n"}),
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		},
+		mutate.IndexAddendum{
+			Add:        fileImage(t, arm64, [2]string{"etc/os-release", "ID=debian\n"}),
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+		},
+	)
+	ref, err := name.ParseReference(u.Host + "/rancher/files:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		platform Platform
+		want     string
+	}{
+		{platform: amd64, want: "ID=alpine\n"},
+		{platform: arm64, want: "ID=debian\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform.String(), func(t *testing.T) {
+			client := NewClient(u.Host, false)
+
+			image, err := name.ParseReference("rancher/files:v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc, err := client.Filesystem(context.Background(), image, tt.platform)
+			if err != nil {
+				t.Fatalf("Filesystem() error = %v", err)
+			}
+			defer rc.Close()
+
+			tr := tar.NewReader(rc)
+			var files int
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				files++
+				content, err := io.ReadAll(tr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if header.Name != "etc/os-release" || string(content) != tt.want {
+					t.Errorf("Filesystem() file %s = %q, want etc/os-release %q", header.Name, content, tt.want)
+				}
+			}
+			if files != 1 {
+				t.Errorf("Filesystem() has %d files, want the os-release of the top layer only", files)
+			}
+		})
+	}
+}
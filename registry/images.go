@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+// Digest returns the digest of the image of ref, or an empty one if it
+// doesn't exist. Images the registry denies access to don't exist either,
+// registries answer 401 for the repositories they don't have even with
+// valid credentials.
+func (c *Client) Digest(ctx context.Context, ref name.Reference) (string, error) {
+	tagRef, err := c.reference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := remote.Head(tagRef, c.options(ctx)...)
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && (transportErr.StatusCode == http.StatusNotFound || transportErr.StatusCode == http.StatusUnauthorized) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// parseImage parses an image with its tag and without a registry, e.g.
+// rancher/rancher:v2.9.0.
+func parseImage(image string) (name.Tag, error) {
+	if !strings.Contains(image, ":") {
+		return name.Tag{}, errors.New("malformed image name, missing ':' " + image)
+	}
+	return name.NewTag(image)
+}
+
+// MissingImages returns the images of checkImages, e.g.
+// rancher/rancher:v2.9.0, that don't exist in the registry, sorted. The
+// images of the repositories of ignoreImages, e.g. rancher/rancher, aren't
+// checked, empty lines are skipped, and at most concurrencyLimit images are
+// checked at once.
+func (c *Client) MissingImages(ctx context.Context, concurrencyLimit int, checkImages, ignoreImages []string) ([]string, error) {
+	ignore := make(map[string]bool, len(ignoreImages))
+	for _, image := range ignoreImages {
+		if strings.Contains(image, ":") {
+			return nil, errors.New("malformed image name, the repo and image name shouldn't contain versions: " + image)
+		}
+		repo, err := name.NewRepository(image)
+		if err != nil {
+			return nil, err
+		}
+		ignore[repo.RepositoryStr()] = true
+	}
+
+	refs := make(map[string]name.Tag, len(checkImages))
+	for _, image := range checkImages {
+		if strings.TrimSpace(image) == "" {
+			continue
+		}
+		ref, err := parseImage(image)
+		if err != nil {
+			return nil, err
+		}
+		if !ignore[ref.RepositoryStr()] {
+			refs[image] = ref
+		}
+	}
+
+	var missing []string
+	var mu sync.Mutex
+
+	// the limit prevents accidentally doing a DOS attack against the registry
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrencyLimit)
+
+	for image, ref := range refs {
+		g.Go(func() error {
+			digest, err := c.Digest(ctx, ref)
+			if err != nil {
+				return errors.New("failed to check if image " + image + " exists: " + err.Error())
+			}
+			if digest == "" {
+				mu.Lock()
+				missing = append(missing, image)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(missing)
+
+	return missing, nil
+}
+
+// ImagesLocations checks which of checkImages are missing from target and
+// in which of the registries of sources they can be found, to know where to
+// sync them from. The images are listed under the first source that has
+// them, and under "missing" if none of them does.
+func ImagesLocations(ctx context.Context, target *Client, sources []*Client, concurrencyLimit int, checkImages, ignoreImages []string) (map[string][]string, error) {
+	locations := make(map[string][]string)
+
+	missing, err := target.MissingImages(ctx, concurrencyLimit, checkImages, ignoreImages)
+	if err != nil {
+		return nil, errors.New("failed to check missing images from " + target.registry + ": " + err.Error())
+	}
+
+	for _, source := range sources {
+		missingFromSource, err := source.MissingImages(ctx, concurrencyLimit, missing, ignoreImages)
+		if err != nil {
+			return nil, errors.New("failed to check missing images from " + source.registry + ": " + err.Error())
+		}
+
+		found := make([]string, 0)
+		for _, image := range missing {
+			if !slices.Contains(missingFromSource, image) {
+				found = append(found, image)
+			}
+		}
+		locations[source.registry] = found
+
+		missing = missingFromSource
+	}
+
+	if missing == nil {
+		missing = make([]string, 0)
+	}
+	locations["missing"] = missing
+
+	return locations, nil
+}
+
+// ImageDigests returns the digests of images, e.g. rancher/rancher:v2.9.0,
+// keyed by their reference in the registry, e.g.
+// registry.rancher.com/rancher/rancher:v2.9.0. Empty lines are skipped, and
+// the digest of the images that don't exist is empty.
+func (c *Client) ImageDigests(ctx context.Context, images []string) (map[string]string, error) {
+	digests := make(map[string]string)
+
+	for _, image := range images {
+		if strings.TrimSpace(image) == "" {
+			continue
+		}
+		ref, err := parseImage(image)
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := c.Digest(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		digests[c.registry+"/"+ref.RepositoryStr()+":"+ref.TagStr()] = digest
+	}
+
+	return digests, nil
+}
@@ -0,0 +1,234 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// pushImages pushes a random image to the registry at host for each image.
+func pushImages(t *testing.T, host string, images ...string) map[string]string {
+	t.Helper()
+
+	digests := make(map[string]string)
+	for _, image := range images {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, err := name.ParseReference(host + "/" + image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests[image] = digest.String()
+	}
+	return digests
+}
+
+// tokenRegistry serves a registry which requires a bearer token from its
+// /token endpoint, and advertises another one. The images are pushed to the
+// same registry without authentication at push.
+func tokenRegistry(t *testing.T) (registry, push *httptest.Server) {
+	t.Helper()
+
+	handler := ggcrregistry.New()
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token" && r.URL.Query().Get("service") == "test registry":
+			w.Write([]byte(`{"token": "secret"}`))
+		case r.URL.Path == "/token":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Header.Get("Authorization") != "Bearer secret" || strings.Contains(r.URL.Path, "/rancher/denied/"):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/advertised",service="other"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(registry.Close)
+
+	push = httptest.NewServer(handler)
+	t.Cleanup(push.Close)
+
+	return registry, push
+}
+
+func newTestClient(t *testing.T, registry string, server *httptest.Server) *Client {
+	t.Helper()
+
+	client := NewClient(registry, false)
+	if err := client.SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestMissingImages(t *testing.T) {
+	server, push := tokenRegistry(t)
+	u, err := url.Parse(push.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushImages(t, u.Host, "rancher/rancher:v2.9.0", "rancher/rancher-agent:v2.9.0")
+
+	client := newTestClient(t, "registry.example.com", server)
+	client.SetTokenService(server.URL+"/token", "test registry")
+
+	checkImages := []string{
+		"rancher/rancher:v2.9.0",
+		"rancher/rancher-agent:v2.9.0",
+		"rancher/rancher-agent:v2.9.1",
+		"rancher/denied:v1",
+		"rancher/shell:v0.2.1",
+		"",
+	}
+	missing, err := client.MissingImages(context.Background(), 2, checkImages, []string{"rancher/shell"})
+	if err != nil {
+		t.Fatalf("MissingImages() error = %v", err)
+	}
+	want := []string{"rancher/denied:v1", "rancher/rancher-agent:v2.9.1"}
+	if strings.Join(missing, ",") != strings.Join(want, ",") {
+		t.Errorf("MissingImages() = %v, want %v", missing, want)
+	}
+
+	if _, err := client.MissingImages(context.Background(), 2, []string{"rancher/rancher"}, nil); err == nil {
+		t.Error("MissingImages() error = nil for an image without a tag")
+	}
+	if _, err := client.MissingImages(context.Background(), 2, checkImages, []string{"rancher/shell:v0.2.1"}); err == nil {
+		t.Error("MissingImages() error = nil for an ignored image with a tag")
+	}
+
+	// without the token service, the token is requested from the endpoint
+	// advertised by the registry, which denies it
+	missing, err = newTestClient(t, "registry.example.com", server).MissingImages(context.Background(), 2, checkImages, []string{"rancher/shell"})
+	if err != nil {
+		t.Fatalf("MissingImages() error = %v", err)
+	}
+	if len(missing) != 4 {
+		t.Errorf("MissingImages() = %v without the token service, want every image", missing)
+	}
+}
+
+func TestImagesLocations(t *testing.T) {
+	target := httptest.NewServer(ggcrregistry.New())
+	defer target.Close()
+	mirror := httptest.NewServer(ggcrregistry.New())
+	defer mirror.Close()
+	docker := httptest.NewServer(ggcrregistry.New())
+	defer docker.Close()
+
+	for server, images := range map[*httptest.Server][]string{
+		target: {"rancher/rancher:v2.9.0"},
+		mirror: {"rancher/rancher-agent:v2.9.0", "rancher/rancher:v2.9.0"},
+		docker: {"rancher/rancher-agent:v2.9.0", "rancher/shell:v0.2.1"},
+	} {
+		u, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pushImages(t, u.Host, images...)
+	}
+
+	checkImages := []string{"rancher/rancher:v2.9.0", "rancher/rancher-agent:v2.9.0", "rancher/shell:v0.2.1", "rancher/fleet:v0.10.0"}
+	sources := []*Client{newTestClient(t, "mirror.example.com", mirror), newTestClient(t, "docker.io", docker)}
+
+	locations, err := ImagesLocations(context.Background(), newTestClient(t, "registry.rancher.com", target), sources, 2, checkImages, nil)
+	if err != nil {
+		t.Fatalf("ImagesLocations() error = %v", err)
+	}
+
+	want := map[string]string{
+		"mirror.example.com": "rancher/rancher-agent:v2.9.0",
+		"docker.io":          "rancher/shell:v0.2.1",
+		"missing":            "rancher/fleet:v0.10.0",
+	}
+	if len(locations) != len(want) {
+		t.Errorf("ImagesLocations() = %v, want %v", locations, want)
+	}
+	for registry, images := range want {
+		if got := strings.Join(locations[registry], ","); got != images {
+			t.Errorf("ImagesLocations()[%s] = %s, want %s", registry, got, images)
+		}
+	}
+}
+
+func TestImageDigests(t *testing.T) {
+	server := httptest.NewServer(ggcrregistry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed := pushImages(t, u.Host, "rancher/rancher:v2.9.0", "library/busybox:1.36")
+
+	client := newTestClient(t, "docker.io", server)
+	digests, err := client.ImageDigests(context.Background(), []string{"rancher/rancher:v2.9.0", "busybox:1.36", "rancher/fleet:v0.10.0", " "})
+	if err != nil {
+		t.Fatalf("ImageDigests() error = %v", err)
+	}
+
+	want := map[string]string{
+		"docker.io/rancher/rancher:v2.9.0": pushed["rancher/rancher:v2.9.0"],
+		"docker.io/library/busybox:1.36":   pushed["library/busybox:1.36"],
+		"docker.io/rancher/fleet:v0.10.0":  "",
+	}
+	if len(digests) != len(want) {
+		t.Errorf("ImageDigests() = %v, want %v", digests, want)
+	}
+	for image, digest := range want {
+		if got, ok := digests[image]; !ok || got != digest {
+			t.Errorf("ImageDigests()[%s] = %q, want %q", image, got, digest)
+		}
+	}
+}
+
+func TestSetBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		image    string
+		insecure bool
+		wantErr  bool
+	}{
+		{baseURL: "https://index.docker.io", image: "index.docker.io/rancher/rancher:v2.9.0"},
+		{baseURL: "http://localhost:5000", image: "localhost:5000/rancher/rancher:v2.9.0", insecure: true},
+		{baseURL: "registry.rancher.com", wantErr: true},
+		{baseURL: "ftp://registry.rancher.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			client := NewClient("docker.io", false)
+			if err := client.SetBaseURL(tt.baseURL); (err != nil) != tt.wantErr {
+				t.Fatalf("SetBaseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			ref, err := client.reference(name.MustParseReference("rancher/rancher:v2.9.0"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref.Name() != tt.image {
+				t.Errorf("reference() = %s, want %s", ref.Name(), tt.image)
+			}
+			if insecure := ref.Scheme() == "http"; insecure != tt.insecure {
+				t.Errorf("reference() scheme = %s, want insecure %v", ref.Scheme(), tt.insecure)
+			}
+		})
+	}
+}
@@ -4,7 +4,14 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
@@ -13,45 +20,203 @@ import (
 type Platform struct {
 	OS           string
 	Architecture string
+	// OSVersion is the os.version of the Windows images of an index, e.g.
+	// 10.0.17763.5820 for ltsc2019.
+	OSVersion string
 }
 
 func (p Platform) String() string {
+	if p.OSVersion != "" {
+		return p.OS + "/" + p.Architecture + ":" + p.OSVersion
+	}
 	return p.OS + "/" + p.Architecture
 }
 
+// Matches reports whether p is the platform want. The OS version is only
+// compared if want has one, and a build like 10.0.17763 matches any of its
+// revisions.
+func (p Platform) Matches(want Platform) bool {
+	if p.OS != want.OS || p.Architecture != want.Architecture {
+		return false
+	}
+	return want.OSVersion == "" || p.OSVersion == want.OSVersion || strings.HasPrefix(p.OSVersion, want.OSVersion+".")
+}
+
 type Image struct {
 	Platforms map[Platform]bool
 	Exists    bool
+	// Digest is the digest of the index of a multi-arch image, or of the
+	// manifest of a single arch one.
+	Digest string
+	// PlatformDigests are the manifest digests of each platform.
+	PlatformDigests map[Platform]string
+	// Signature is only verified if the client has a signature policy.
+	Signature Signature
+	// Attestations are only listed if the client checks them.
+	Attestations map[Platform]Attestations
+}
+
+// HasPlatform reports whether the image was published for a platform
+// matching p.
+func (img Image) HasPlatform(p Platform) bool {
+	for platform, ok := range img.Platforms {
+		if ok && platform.Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryStatusCodes are the responses requests are retried on, rate limits
+// and server errors.
+var retryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// defaultBackoff retries 4 times, 1s, 2s, 4s and 8s after each failure.
+var defaultBackoff = remote.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
 }
 
 type Client struct {
 	registry string
+	// host is where the API of the registry is served, the registry itself
+	// unless its base URL is set.
+	host         string
+	insecure     bool
+	authURL      string
+	service      string
+	auth         authn.Authenticator
+	backoff      remote.Backoff
+	policy       *SignaturePolicy
+	attestations bool
 }
 
+// NewClient returns a client for registry which authenticates with the
+// credentials of the docker config, if there are any. With debug, the
+// requests are logged to stderr.
 func NewClient(registry string, debug bool) *Client {
-	return &Client{registry}
+	if debug {
+		logs.Debug.SetOutput(os.Stderr)
+	}
+
+	return &Client{registry: registry, host: registry, backoff: defaultBackoff}
+}
+
+// SetBaseURL makes the client look up the images of the registry at
+// baseURL, e.g. https://index.docker.io for docker.io, or http://localhost:5000
+// for an insecure local registry.
+func (c *Client) SetBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("invalid registry base url " + baseURL + ", expected http(s)://host")
+	}
+
+	c.host = u.Host
+	c.insecure = u.Scheme == "http"
+
+	return nil
+}
+
+// SetTokenService makes the client request its bearer tokens from authURL
+// for service, instead of the token endpoint the registry advertises.
+func (c *Client) SetTokenService(authURL, service string) {
+	c.authURL = authURL
+	c.service = service
+}
+
+// SetCredentials makes the client authenticate with username and password
+// instead of the docker config credentials.
+func (c *Client) SetCredentials(username, password string) {
+	c.auth = &authn.Basic{Username: username, Password: password}
+}
+
+// options returns the options of the requests to the registry.
+func (c *Client) options(ctx context.Context) []remote.Option {
+	opts := []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithRetryBackoff(c.backoff),
+		remote.WithRetryStatusCodes(retryStatusCodes...),
+	}
+	if c.authURL != "" {
+		opts = append(opts, remote.WithTransport(&tokenService{
+			authURL: c.authURL,
+			service: c.service,
+			next:    remote.DefaultTransport,
+		}))
+	}
+	if c.auth != nil {
+		return append(opts, remote.WithAuth(c.auth))
+	}
+
+	return append(opts, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+}
+
+// tokenService rewrites the bearer challenges of a registry to request the
+// tokens from authURL for service.
+type tokenService struct {
+	authURL string
+	service string
+	next    http.RoundTripper
+}
+
+func (t *tokenService) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	if challenge := res.Header.Get("WWW-Authenticate"); strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		challenge = `Bearer realm="` + t.authURL + `"`
+		if t.service != "" {
+			challenge += `,service="` + t.service + `"`
+		}
+		res.Header.Set("WWW-Authenticate", challenge)
+	}
+
+	return res, nil
 }
 
-func replaceRegistry(registry string, ref name.Reference) (name.Tag, error) {
-	newRef, err := name.NewRepository(registry + "/" + ref.Context().RepositoryStr())
+func replaceRegistry(registry string, ref name.Reference, opts ...name.Option) (name.Tag, error) {
+	newRef, err := name.NewRepository(registry+"/"+ref.Context().RepositoryStr(), opts...)
 	if err != nil {
 		return name.Tag{}, err
 	}
 
-	return name.NewTag(newRef.String() + ":" + ref.Identifier())
+	return name.NewTag(newRef.String()+":"+ref.Identifier(), opts...)
+}
+
+// reference returns ref in the registry of the client.
+func (c *Client) reference(ref name.Reference) (name.Tag, error) {
+	if c.insecure {
+		return replaceRegistry(c.host, ref, name.Insecure)
+	}
+	return replaceRegistry(c.host, ref)
 }
 
 func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 	info := Image{
-		Platforms: make(map[Platform]bool),
+		Platforms:       make(map[Platform]bool),
+		PlatformDigests: make(map[Platform]string),
 	}
 
-	tagRef, err := replaceRegistry(c.registry, ref)
+	tagRef, err := c.reference(ref)
 	if err != nil {
 		return info, err
 	}
 
-	desc, err := remote.Get(tagRef)
+	desc, err := remote.Get(tagRef, c.options(ctx)...)
 	if err != nil {
 		var transportErr *transport.Error
 		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
@@ -61,6 +226,7 @@ func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 	}
 
 	info.Exists = true
+	info.Digest = desc.Digest.String()
 
 	if desc.MediaType.IsIndex() {
 		if err := c.handleMultiArchImage(desc, &info); err != nil {
@@ -72,6 +238,16 @@ func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 		}
 	}
 
+	if c.policy != nil {
+		info.Signature = c.Signature(ctx, ref)
+	}
+
+	if c.attestations {
+		if info.Attestations, err = c.Attestations(ctx, ref); err != nil {
+			return info, err
+		}
+	}
+
 	return info, nil
 }
 
@@ -87,11 +263,16 @@ func (c *Client) handleMultiArchImage(desc *remote.Descriptor, info *Image) erro
 	}
 
 	for _, m := range manifest.Manifests {
+		if m.Annotations[buildkitReferenceTypeAnnotation] == buildkitAttestationManifest || m.Platform == nil {
+			continue
+		}
 		platform := Platform{
 			OS:           m.Platform.OS,
 			Architecture: m.Platform.Architecture,
+			OSVersion:    m.Platform.OSVersion,
 		}
 		info.Platforms[platform] = true
+		info.PlatformDigests[platform] = m.Digest.String()
 	}
 
 	return nil
@@ -111,8 +292,45 @@ func (c *Client) handleSingleArchImage(desc *remote.Descriptor, info *Image) err
 	platform := Platform{
 		OS:           cfg.OS,
 		Architecture: cfg.Architecture,
+		OSVersion:    cfg.OSVersion,
 	}
 	info.Platforms[platform] = true
+	info.PlatformDigests[platform] = desc.Digest.String()
 
 	return nil
 }
+
+// DigestMismatches compares the digests of the same image in two
+// registries. It returns the platforms they both have with a different
+// manifest digest, sorted, and "index" if only the digests of the images
+// differ, e.g. when an index was rebuilt from the same manifests.
+func DigestMismatches(a, b Image) []string {
+	if a.Digest == b.Digest {
+		return nil
+	}
+
+	var mismatches []string
+	for platform, digest := range a.PlatformDigests {
+		if other, ok := b.PlatformDigests[platform]; ok && other != digest {
+			mismatches = append(mismatches, platform.String())
+		}
+	}
+	if len(mismatches) == 0 {
+		return []string{"index"}
+	}
+	sort.Strings(mismatches)
+
+	return mismatches
+}
+
+// MissingPlatforms returns the platforms of want that the image wasn't
+// published for.
+func MissingPlatforms(img Image, want []Platform) []Platform {
+	var missing []Platform
+	for _, p := range want {
+		if !img.HasPlatform(p) {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
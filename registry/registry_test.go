@@ -1,9 +1,19 @@
 package registry
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 func TestReplaceRegistry(t *testing.T) {
@@ -49,3 +59,152 @@ func TestReplaceRegistry(t *testing.T) {
 		})
 	}
 }
+
+func TestMissingPlatforms(t *testing.T) {
+	amd64 := Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := Platform{OS: "linux", Architecture: "arm64"}
+
+	img := Image{Platforms: map[Platform]bool{amd64: true}, Exists: true}
+
+	missing := MissingPlatforms(img, []Platform{amd64, arm64})
+	if len(missing) != 1 || missing[0] != arm64 {
+		t.Errorf("MissingPlatforms() = %v, want [%v]", missing, arm64)
+	}
+}
+
+func TestDigestMismatches(t *testing.T) {
+	amd64 := Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := Platform{OS: "linux", Architecture: "arm64"}
+
+	oss := Image{
+		Exists:          true,
+		Digest:          "sha256:01",
+		PlatformDigests: map[Platform]string{amd64: "sha256:02", arm64: "sha256:03"},
+	}
+
+	tests := []struct {
+		name  string
+		prime Image
+		want  []string
+	}{
+		{
+			name:  "same index",
+			prime: oss,
+		},
+		{
+			name: "rebuilt platform",
+			prime: Image{
+				Exists:          true,
+				Digest:          "sha256:04",
+				PlatformDigests: map[Platform]string{amd64: "sha256:02", arm64: "sha256:05"},
+			},
+			want: []string{"linux/arm64"},
+		},
+		{
+			name: "rebuilt index",
+			prime: Image{
+				Exists:          true,
+				Digest:          "sha256:04",
+				PlatformDigests: map[Platform]string{amd64: "sha256:02"},
+			},
+			want: []string{"index"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DigestMismatches(oss, tt.prime)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("DigestMismatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientImageRetriesAndAuth(t *testing.T) {
+	registry := ggcrregistry.New()
+
+	var rateLimited atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/" && rateLimited.Add(1) <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if username, password, ok := r.BasicAuth(); ok && (username != "user" || password != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/rancher/retried:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimited.Store(2)
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{name: "docker config"},
+		{name: "credentials", username: "user", password: "secret"},
+		{name: "wrong credentials", username: "user", password: "wrong", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimited.Store(0)
+
+			client := NewClient(u.Host, false)
+			client.backoff = remote.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+			if tt.username != "" {
+				client.SetCredentials(tt.username, tt.password)
+			}
+
+			got, err := client.Image(context.Background(), ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Image() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Exists {
+				t.Error("Image() exists = false, want true after the rate limited requests are retried")
+			}
+		})
+	}
+}
+
+func TestPlatformMatches(t *testing.T) {
+	ltsc2019 := Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.5820"}
+
+	tests := []struct {
+		name string
+		want Platform
+		ok   bool
+	}{
+		{name: "any version", want: Platform{OS: "windows", Architecture: "amd64"}, ok: true},
+		{name: "build", want: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"}, ok: true},
+		{name: "exact version", want: ltsc2019, ok: true},
+		{name: "other build", want: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348"}},
+		{name: "build prefix", want: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.1776"}},
+		{name: "other arch", want: Platform{OS: "windows", Architecture: "arm64"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ltsc2019.Matches(tt.want); got != tt.ok {
+				t.Errorf("Matches(%s) = %v, want %v", tt.want, got, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package release
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/v90/github"
+	"golang.org/x/mod/semver"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	AssetOK         = "ok"
+	AssetMissing    = "missing"
+	AssetExtra      = "extra"
+	AssetCorrupted  = "corrupted"
+	AssetUnverified = "unverified"
+)
+
+//go:embed assets/*.yaml
+var assetManifests embed.FS
+
+// ExpectedAsset is an asset of the manifest, with an {arch} placeholder in
+// the name expanded for each of the archs.
+type ExpectedAsset struct {
+	Name  string   `json:"name"`
+	Archs []string `json:"archs,omitempty"`
+}
+
+// assetManifest is the list of assets released from a minor on.
+type assetManifest struct {
+	Minor  string          `json:"minor"`
+	Assets []ExpectedAsset `json:"assets"`
+}
+
+// AssetCheck is the result of verifying a single release asset.
+type AssetCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Failed reports whether the check should fail the verification. Assets
+// whose digest couldn't be verified only fail it if strict is set.
+func (c AssetCheck) Failed(strict bool) bool {
+	return c.Status != AssetOK && (strict || c.Status != AssetUnverified)
+}
+
+// ExpectedAssets returns the names of the assets the release of product
+// (k3s or rke2) at tag should have, according to the manifest of its minor.
+func ExpectedAssets(product, tag string) ([]string, error) {
+	b, err := assetManifests.ReadFile("assets/" + product + ".yaml")
+	if err != nil {
+		return nil, errors.New("no asset manifest for " + product)
+	}
+
+	var manifests []assetManifest
+	if err := yaml.Unmarshal(b, &manifests); err != nil {
+		return nil, errors.New("invalid " + product + " asset manifest: " + err.Error())
+	}
+
+	return expectedAssets(manifests, tag)
+}
+
+func expectedAssets(manifests []assetManifest, tag string) ([]string, error) {
+	minor := semver.MajorMinor(tag)
+	if minor == "" {
+		return nil, errors.New("invalid tag: " + tag)
+	}
+
+	var manifest *assetManifest
+	for i, m := range manifests {
+		if semver.Compare(m.Minor, minor) > 0 {
+			continue
+		}
+		if manifest == nil || semver.Compare(m.Minor, manifest.Minor) > 0 {
+			manifest = &manifests[i]
+		}
+	}
+	if manifest == nil {
+		return nil, errors.New("no asset manifest for " + minor)
+	}
+
+	var names []string
+	for _, asset := range manifest.Assets {
+		if len(asset.Archs) == 0 {
+			names = append(names, asset.Name)
+			continue
+		}
+		for _, arch := range asset.Archs {
+			names = append(names, strings.ReplaceAll(asset.Name, "{arch}", arch))
+		}
+	}
+
+	return names, nil
+}
+
+// isChecksumFile reports whether name is one of the sha256sum-*.txt assets.
+func isChecksumFile(name string) bool {
+	matched, _ := path.Match("sha256sum-*.txt", name)
+	return matched
+}
+
+// CheckAssets compares the assets of the release in fsys with the expected
+// ones by name, and checks that each asset isn't empty and matches its digest
+// in the sha256sum files of the release. The digest of an asset is taken from
+// its GitHub release asset if fsys provides it, otherwise the asset is
+// downloaded and hashed. Assets that aren't listed in the checksum files, or
+// couldn't be hashed, are unverified.
+func CheckAssets(fsys fs.FS, expected []string) ([]AssetCheck, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.New("failed to list release assets: " + err.Error())
+	}
+
+	present := make(map[string]fs.FileInfo, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		present[entry.Name()] = info
+	}
+
+	sums := make(map[string]string)
+	for _, entry := range entries {
+		if !isChecksumFile(entry.Name()) {
+			continue
+		}
+		if err := readChecksums(fsys, entry.Name(), sums); err != nil {
+			return nil, errors.New("failed to read " + entry.Name() + ": " + err.Error())
+		}
+	}
+
+	names := make(map[string]bool, len(expected)+len(present))
+	for _, name := range expected {
+		names[name] = true
+	}
+	for name := range present {
+		names[name] = true
+	}
+	for name := range sums {
+		names[name] = true
+	}
+
+	isExpected := make(map[string]bool, len(expected))
+	for _, name := range expected {
+		isExpected[name] = true
+	}
+
+	checks := make([]AssetCheck, 0, len(names))
+	for name := range names {
+		check := AssetCheck{Name: name, Status: AssetOK, Expected: sums[name]}
+		info, ok := present[name]
+		if ok {
+			check.Actual = assetDigest(info)
+			if check.Actual == "" && check.Expected != "" && isExpected[name] && info.Size() > 0 {
+				digest, err := fileDigest(fsys, name)
+				if err != nil {
+					check.Error = "failed to hash asset: " + err.Error()
+				}
+				check.Actual = digest
+			}
+		}
+
+		switch {
+		case !ok:
+			check.Status = AssetMissing
+		case !isExpected[name]:
+			check.Status = AssetExtra
+		case info.Size() == 0:
+			check.Status = AssetCorrupted
+			check.Error = "empty asset"
+		case check.Expected != "" && check.Actual != "" && check.Actual != check.Expected:
+			check.Status = AssetCorrupted
+		case (check.Expected == "" || check.Actual == "") && !isChecksumFile(name):
+			check.Status = AssetUnverified
+		}
+		checks = append(checks, check)
+	}
+	slices.SortFunc(checks, func(a, b AssetCheck) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return checks, nil
+}
+
+// assetDigest returns the sha256 digest GitHub computed when an asset was
+// uploaded, or an empty one if it's unknown.
+func assetDigest(info fs.FileInfo) string {
+	asset, ok := info.Sys().(*github.ReleaseAsset)
+	if !ok {
+		return ""
+	}
+
+	digest, ok := strings.CutPrefix(asset.GetDigest(), "sha256:")
+	if !ok {
+		return ""
+	}
+	return digest
+}
+
+// fileDigest returns the sha256 digest of the file name of fsys.
+func fileDigest(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readChecksums adds the digests of a sha256sum file to sums, keyed by the
+// asset name.
+func readChecksums(fsys fs.FS, name string, sums map[string]string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return errors.New("invalid line: " + scanner.Text())
+		}
+		// sha256sum marks files hashed in binary mode with a leading *
+		asset := path.Base(strings.TrimPrefix(fields[1], "*"))
+		if digest, ok := sums[asset]; ok && digest != fields[0] {
+			return errors.New("conflicting digests for " + asset)
+		}
+		sums[asset] = fields[0]
+	}
+
+	return scanner.Err()
+}
+
+// WriteAssetChecks writes the checks as a table, or as JSON if format is
+// json. An error is returned if any asset is missing, extra or corrupted, or
+// unverified if strict is set.
+func WriteAssetChecks(w io.Writer, checks []AssetCheck, format string, strict bool) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			return err
+		}
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "asset\tstatus\texpected\tactual")
+		fmt.Fprintln(tw, "-----\t------\t--------\t------")
+
+		for _, check := range checks {
+			actual := shortDigest(check.Actual)
+			if check.Error != "" {
+				actual = check.Error
+			}
+			tw.Write([]byte(strings.Join([]string{
+				check.Name,
+				check.Status,
+				shortDigest(check.Expected),
+				actual,
+			}, "\t") + "\n"))
+		}
+
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unsupported output format: " + format)
+	}
+
+	var failed int
+	for _, check := range checks {
+		if check.Failed(strict) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(checks)) + " assets failed verification")
+	}
+
+	return nil
+}
+
+func shortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
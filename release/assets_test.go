@@ -0,0 +1,135 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-github/v90/github"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExpectedAssets(t *testing.T) {
+	manifests := []assetManifest{
+		{Minor: "v1.28", Assets: []ExpectedAsset{{Name: "k3s"}, {Name: "k3s-{arch}", Archs: []string{"arm64", "armhf"}}}},
+		{Minor: "v1.31", Assets: []ExpectedAsset{{Name: "k3s"}, {Name: "k3s-{arch}", Archs: []string{"s390x"}}}},
+	}
+	tests := []struct {
+		tag     string
+		want    []string
+		wantErr bool
+	}{
+		{tag: "v1.28.5+k3s1", want: []string{"k3s", "k3s-arm64", "k3s-armhf"}},
+		{tag: "v1.30.2+k3s1", want: []string{"k3s", "k3s-arm64", "k3s-armhf"}},
+		{tag: "v1.31.0-rc1+k3s1", want: []string{"k3s", "k3s-s390x"}},
+		{tag: "v1.27.9+k3s1", wantErr: true},
+		{tag: "1.30.2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := expectedAssets(manifests, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expectedAssets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expectedAssets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedAssetManifests(t *testing.T) {
+	for _, product := range []string{"k3s", "rke2"} {
+		names, err := ExpectedAssets(product, "v1.31.1")
+		if err != nil {
+			t.Fatalf("ExpectedAssets(%s) error = %v", product, err)
+		}
+		for _, name := range []string{"install.sh", "sha256sum-amd64.txt"} {
+			if !slices.Contains(names, name) {
+				t.Errorf("ExpectedAssets(%s) = %v, missing %s", product, names, name)
+			}
+		}
+	}
+}
+
+// undigestedOnlyFS fails to open the assets that have a GitHub digest,
+// which shouldn't be downloaded.
+type undigestedOnlyFS struct {
+	fstest.MapFS
+}
+
+func (f undigestedOnlyFS) Open(name string) (fs.File, error) {
+	if file, ok := f.MapFS[name]; ok && file.Sys != nil {
+		return nil, errors.New("unexpected download of " + name)
+	}
+	return f.MapFS.Open(name)
+}
+
+func TestCheckAssets(t *testing.T) {
+	fsys := undigestedOnlyFS{fstest.MapFS{
+		"k3s":                         {Data: []byte("k3s amd64"), Sys: &github.ReleaseAsset{Digest: github.Ptr("sha256:" + sha256Hex("k3s amd64"))}},
+		"k3s-arm64":                   {Data: []byte("tampered"), Sys: &github.ReleaseAsset{Digest: github.Ptr("sha256:" + sha256Hex("tampered"))}},
+		"k3s-airgap-images-arm64.tar": {},
+		"k3s-images.txt":              {Data: []byte("rancher/mirrored-pause:3.6")},
+		"k3s-s390x":                   {Data: []byte("k3s s390x")},
+		"k3s-riscv64":                 {Data: []byte("tampered")},
+		"notes.txt":                   {Data: []byte("extra")},
+		"sha256sum-amd64.txt":         {Data: []byte(sha256Hex("k3s amd64") + "  k3s\n" + sha256Hex("k3s-airgap") + "  k3s-airgap-images-amd64.tar\n")},
+		"sha256sum-arm64.txt":         {Data: []byte(sha256Hex("k3s arm64") + " *dist/artifacts/k3s-arm64\n" + sha256Hex("k3s-airgap") + "  k3s-airgap-images-arm64.tar\n")},
+		"sha256sum-s390x.txt":         {Data: []byte(sha256Hex("k3s s390x") + "  k3s-s390x\n" + sha256Hex("k3s riscv64") + "  k3s-riscv64\n")},
+	}}
+	expected := []string{"k3s", "k3s-arm64", "k3s-armhf", "k3s-airgap-images-arm64.tar", "k3s-images.txt", "k3s-s390x", "k3s-riscv64", "sha256sum-amd64.txt", "sha256sum-arm64.txt", "sha256sum-s390x.txt"}
+
+	checks, err := CheckAssets(fsys, expected)
+	if err != nil {
+		t.Fatalf("CheckAssets() error = %v", err)
+	}
+
+	want := map[string]string{
+		"k3s":                         AssetOK,
+		"k3s-airgap-images-amd64.tar": AssetMissing,
+		"k3s-arm64":                   AssetCorrupted,
+		"k3s-airgap-images-arm64.tar": AssetCorrupted,
+		"k3s-armhf":                   AssetMissing,
+		"k3s-images.txt":              AssetUnverified,
+		"k3s-s390x":                   AssetOK,
+		"k3s-riscv64":                 AssetCorrupted,
+		"notes.txt":                   AssetExtra,
+		"sha256sum-amd64.txt":         AssetOK,
+		"sha256sum-arm64.txt":         AssetOK,
+		"sha256sum-s390x.txt":         AssetOK,
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("CheckAssets() returned %d checks, want %d: %+v", len(checks), len(want), checks)
+	}
+	for _, check := range checks {
+		if check.Status != want[check.Name] {
+			t.Errorf("%s: status = %s, want %s", check.Name, check.Status, want[check.Name])
+		}
+		if check.Status == AssetUnverified && (check.Failed(false) || !check.Failed(true)) {
+			t.Errorf("%s: unverified asset should only fail when strict", check.Name)
+		}
+	}
+
+	if err := WriteAssetChecks(io.Discard, checks, "json", false); err == nil {
+		t.Error("WriteAssetChecks() error = nil, want failures reported")
+	}
+}
+
+func TestReadChecksumsConflict(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sha256sum.txt": {Data: []byte(sha256Hex("a") + "  k3s\n" + sha256Hex("b") + "  k3s\n")},
+	}
+	if err := readChecksums(fsys, "sha256sum.txt", make(map[string]string)); err == nil {
+		t.Error("readChecksums() error = nil, want conflicting digests error")
+	}
+}
@@ -6,24 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/google/go-github/v90/github"
 	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"golang.org/x/mod/semver"
 )
 
 // CreateRelease will create a new tag and a new release with given params.
 func CreateRelease(ctx context.Context, client *github.Client, opts *repository.CreateReleaseOpts, rc bool, releaseType, previousTag, releaseNotesAlert string, dryRun bool) error {
-	if !semver.IsValid(opts.Tag) {
-		return errors.New("tag isn't a valid semver: " + opts.Tag)
-	}
-
-	latestPreRelease, err := release.LatestPreRelease(ctx, client, opts.Owner, opts.Repo, opts.Tag, releaseType)
+	baseVersion, err := version.Parse(opts.Tag)
 	if err != nil {
-		return err
+		return errors.New("tag isn't a valid semver: " + opts.Tag)
 	}
 
 	opts.Name = opts.Tag
@@ -31,20 +27,16 @@ func CreateRelease(ctx context.Context, client *github.Client, opts *repository.
 	opts.ReleaseNotes = ""
 
 	if rc {
-		latestRCNumber := 1
-		if latestPreRelease != nil {
-			// v2.9.0-rc.N / -alpha.N
-			_, trimmedRCNumber, found := strings.Cut(*latestPreRelease, "-"+releaseType+".")
-			if !found {
-				return errors.New("failed to parse rc number from " + *latestPreRelease)
-			}
-			currentRCNumber, err := strconv.Atoi(trimmedRCNumber)
-			if err != nil {
-				return err
-			}
-			latestRCNumber = currentRCNumber + 1
+		// v2.9.0-rc.N / -alpha.N
+		latestPreRelease, err := release.LatestPreRelease(ctx, client, opts.Owner, opts.Repo, baseVersion, releaseType, version.CLI)
+		if err != nil {
+			return err
+		}
+		tagVersion, err := version.CLI.Next(baseVersion, releaseType, latestPreRelease)
+		if err != nil {
+			return err
 		}
-		opts.Tag = fmt.Sprintf("%s-%s.%d", opts.Tag, releaseType, latestRCNumber)
+		opts.Tag = tagVersion.String()
 	} else {
 		fmt.Printf("release.GenReleaseNotes(ctx, %s, %s, %s, %s, client)", opts.Owner, opts.Repo, opts.Branch, previousTag)
 		buff, err := release.GenReleaseNotes(ctx, opts.Owner, opts.Repo, opts.Branch, previousTag, releaseNotesAlert, client)
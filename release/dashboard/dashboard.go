@@ -5,41 +5,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/google/go-github/v90/github"
 	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"golang.org/x/mod/semver"
 )
 
 // CreateDashboardRelease will create a new tag and a new release with given params.
 func CreateDashboardRelease(ctx context.Context, client *github.Client, opts *repository.CreateReleaseOpts, rc, dryRun bool, releaseType, previousTag, releaseAlert string) error {
-	if !semver.IsValid(opts.Tag) {
-		return errors.New("tag isn't a valid semver: " + opts.Tag)
-	}
-
-	latestPreRelease, err := release.LatestPreRelease(ctx, client, opts.Owner, opts.Repo, opts.Tag, releaseType)
+	baseVersion, err := version.Parse(opts.Tag)
 	if err != nil {
-		return err
+		return errors.New("tag isn't a valid semver: " + opts.Tag)
 	}
 
 	if rc {
-		latestRCNumber := 1
-		if latestPreRelease != nil {
-			// v2.9.0-rcN / -alphaN
-			_, trimmedRCNumber, found := strings.Cut(*latestPreRelease, "-"+releaseType)
-			if !found {
-				return errors.New("failed to parse rc number from " + *latestPreRelease)
-			}
-			currentRCNumber, err := strconv.Atoi(trimmedRCNumber)
-			if err != nil {
-				return err
-			}
-			latestRCNumber = currentRCNumber + 1
+		// v2.9.0-rcN / -alphaN
+		latestPreRelease, err := release.LatestPreRelease(ctx, client, opts.Owner, opts.Repo, baseVersion, releaseType, version.Dashboard)
+		if err != nil {
+			return err
+		}
+		tagVersion, err := version.Dashboard.Next(baseVersion, releaseType, latestPreRelease)
+		if err != nil {
+			return err
 		}
-		opts.Tag = fmt.Sprintf("%s-%s%d", opts.Tag, releaseType, latestRCNumber)
+		opts.Tag = tagVersion.String()
 	}
 
 	opts.Name = opts.Tag
@@ -90,30 +82,22 @@ func ReleaseBranchFromTag(tag string) (string, error) {
 
 // CreateUIRelease will create a new tag and a new release with given params.
 func CreateUIRelease(ctx context.Context, client *github.Client, opts *repository.CreateReleaseOpts, preRelease, dryRun bool, releaseType, previousTag, releaseNotesAlert string) error {
-	if !semver.IsValid(opts.Tag) {
-		return errors.New("tag isn't a valid semver: " + opts.Tag)
-	}
-
-	latestPreRelease, err := release.LatestPreRelease(ctx, client, opts.Owner, opts.Repo, opts.Tag, releaseType)
+	baseVersion, err := version.Parse(opts.Tag)
 	if err != nil {
-		return err
+		return errors.New("tag isn't a valid semver: " + opts.Tag)
 	}
 
 	if preRelease {
-		latestRCNumber := 1
-		if latestPreRelease != nil {
-			// v2.9.0-rcN / -alphaN
-			_, trimmedRCNumber, found := strings.Cut(*latestPreRelease, "-"+releaseType)
-			if !found {
-				return errors.New("failed to parse rc number from " + *latestPreRelease)
-			}
-			currentRCNumber, err := strconv.Atoi(trimmedRCNumber)
-			if err != nil {
-				return err
-			}
-			latestRCNumber = currentRCNumber + 1
+		// v2.9.0-rcN / -alphaN
+		latestPreRelease, err := release.LatestPreRelease(ctx, client, opts.Owner, opts.Repo, baseVersion, releaseType, version.Dashboard)
+		if err != nil {
+			return err
+		}
+		tagVersion, err := version.Dashboard.Next(baseVersion, releaseType, latestPreRelease)
+		if err != nil {
+			return err
 		}
-		opts.Tag = fmt.Sprintf("%s-%s%d", opts.Tag, releaseType, latestRCNumber)
+		opts.Tag = tagVersion.String()
 	}
 
 	opts.Name = opts.Tag
@@ -9,8 +9,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/sirupsen/logrus"
 )
 
@@ -25,9 +25,6 @@ var cutoff = time.Now().Add(-time.Hour * 24 * 2)
 // buildSuffixRE matches the trailing "-buildYYYYMMDD" suffix appended by this tool.
 var buildSuffixRE = regexp.MustCompile(`-build\d+$`)
 
-// k3sPrereleaseRE matches the only allowed prerelease string: -k3sN (e.g. k3s1, k3s2).
-var k3sPrereleaseRE = regexp.MustCompile(`^k3s\d+$`)
-
 // Sync checks the releases of upstream repository (owner, repo)
 // with the given repo, and creates the missing latest tags from upstream.
 func Sync(ctx context.Context, client *github.Client, owner, repo, upstreamOwner, upstreamRepo, tagPrefix string, dryrun bool) error {
@@ -204,8 +201,8 @@ func validateTagFormat(tagName, tagPrefix string) bool {
 		versionStr = tagName
 	}
 
-	// semver library to validate the version string, if it contains a prefix (besides 'v' it fails).
-	v, err := semver.NewVersion(versionStr)
+	// if the version string contains a prefix (besides 'v') parsing fails.
+	v, err := version.Parse(versionStr)
 	if err != nil {
 		// If parsing fails, it's not a valid semantic version.
 		return false
@@ -219,7 +216,7 @@ func validateTagFormat(tagName, tagPrefix string) bool {
 	// - v3.21.1-typha    <------ will be skipped
 	// - v3.21.1-pod2daemon <- will be skipped
 	// - v3.24.2-0.dev    <------ will be skipped
-	if pre := v.Prerelease(); pre != "" && !k3sPrereleaseRE.MatchString(pre) {
+	if v.IsPreRelease() && (v.PreRelease.Label != "k3s" || v.PreRelease.Number == 0 || v.PreRelease.Dotted || v.PreRelease.Extra != "") {
 		return false
 	}
 
@@ -0,0 +1,113 @@
+package inspect
+
+import (
+	"io/fs"
+	"slices"
+	"sort"
+
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+const (
+	ImageAdded   = "added"
+	ImageRemoved = "removed"
+	ImageBumped  = "bumped"
+)
+
+// ImageChange is an image added, removed or re-tagged between two releases
+// for a platform. OldTag is empty for added images and NewTag for removed
+// ones.
+type ImageChange struct {
+	Platform   reg.Platform
+	Repository string
+	OldTag     string
+	NewTag     string
+}
+
+// Kind returns whether the image was added, removed or bumped.
+func (c ImageChange) Kind() string {
+	switch {
+	case c.OldTag == "":
+		return ImageAdded
+	case c.NewTag == "":
+		return ImageRemoved
+	}
+	return ImageBumped
+}
+
+// Diff compares the image lists of two releases of product, read from the
+// assets of the old and new releases. The changes are sorted by platform,
+// in the order of the product platforms, and then by repository. When a
+// repository has several tags in a release, the removed and added ones are
+// paired up in order as bumps.
+func Diff(product Product, oldAssets, newAssets fs.FS) ([]ImageChange, error) {
+	oldImages, err := NewReleaseInspector(oldAssets, product, nil, nil, false).imageMap()
+	if err != nil {
+		return nil, err
+	}
+	newImages, err := NewReleaseInspector(newAssets, product, nil, nil, false).imageMap()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ImageChange
+	for _, platform := range product.Platforms() {
+		oldTags := platformTags(oldImages, platform)
+		newTags := platformTags(newImages, platform)
+
+		var repos []string
+		for repo := range oldTags {
+			repos = append(repos, repo)
+		}
+		for repo := range newTags {
+			if _, ok := oldTags[repo]; !ok {
+				repos = append(repos, repo)
+			}
+		}
+		sort.Strings(repos)
+
+		for _, repo := range repos {
+			removed := missingTags(oldTags[repo], newTags[repo])
+			added := missingTags(newTags[repo], oldTags[repo])
+
+			for i := 0; i < max(len(removed), len(added)); i++ {
+				change := ImageChange{Platform: platform, Repository: repo}
+				if i < len(removed) {
+					change.OldTag = removed[i]
+				}
+				if i < len(added) {
+					change.NewTag = added[i]
+				}
+				changes = append(changes, change)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// platformTags returns the tags of each repository of the images expected
+// for platform.
+func platformTags(images map[string]ReleaseImage, platform reg.Platform) map[string][]string {
+	tags := make(map[string][]string)
+	for _, image := range images {
+		if !image.Expects(platform) {
+			continue
+		}
+		repo := image.Reference.Context().RepositoryStr()
+		tags[repo] = append(tags[repo], image.Reference.Identifier())
+	}
+	return tags
+}
+
+// missingTags returns the tags of a that aren't in b, sorted.
+func missingTags(a, b []string) []string {
+	var missing []string
+	for _, tag := range a {
+		if !slices.Contains(b, tag) {
+			missing = append(missing, tag)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
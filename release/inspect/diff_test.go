@@ -0,0 +1,51 @@
+package inspect
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDiff(t *testing.T) {
+	oldAssets := fstest.MapFS{
+		"k3s-images.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/mirrored-pause:3.6\ndocker.io/rancher/klipper-helm:v0.8.2-build20230815\ndocker.io/rancher/mirrored-library-traefik:2.10.5\ndocker.io/rancher/mirrored-metrics-server:v0.6.3"),
+		},
+	}
+	newAssets := fstest.MapFS{
+		"k3s-images.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/mirrored-pause:3.6\ndocker.io/rancher/klipper-helm:v0.8.3-build20240228\ndocker.io/rancher/mirrored-library-traefik:2.10.7\ndocker.io/rancher/mirrored-library-busybox:1.36.1"),
+		},
+	}
+
+	changes, err := Diff(K3s, oldAssets, newAssets)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	want := []ImageChange{
+		{Repository: "rancher/klipper-helm", OldTag: "v0.8.2-build20230815", NewTag: "v0.8.3-build20240228"},
+		{Repository: "rancher/mirrored-library-busybox", NewTag: "1.36.1"},
+		{Repository: "rancher/mirrored-library-traefik", OldTag: "2.10.5", NewTag: "2.10.7"},
+		{Repository: "rancher/mirrored-metrics-server", OldTag: "v0.6.3"},
+	}
+	// k3s lists the same images for every platform
+	var expected []ImageChange
+	for _, platform := range K3s.Platforms() {
+		for _, change := range want {
+			change.Platform = platform
+			expected = append(expected, change)
+		}
+	}
+
+	if !slices.Equal(changes, expected) {
+		t.Errorf("Diff() = %+v, want %+v", changes, expected)
+	}
+
+	kinds := []string{ImageBumped, ImageAdded, ImageBumped, ImageRemoved}
+	for i, change := range changes[:len(want)] {
+		if change.Kind() != kinds[i] {
+			t.Errorf("%s kind = %s, want %s", change.Repository, change.Kind(), kinds[i])
+		}
+	}
+}
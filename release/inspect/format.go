@@ -0,0 +1,280 @@
+package inspect
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formatter renders a report.
+type Formatter func(w io.Writer, r Report) error
+
+// Formatters are the formatters of the report, by output format name.
+var Formatters = map[string]Formatter{
+	"table":    FormatTable,
+	"csv":      FormatCSV,
+	"json":     FormatJSON,
+	"markdown": FormatMarkdown,
+	"junit":    FormatJUnit,
+}
+
+// FormatNames returns the names of the formatters, sorted.
+func FormatNames() []string {
+	names := make([]string, 0, len(Formatters))
+	for name := range Formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format renders the report with the formatter of format.
+func Format(w io.Writer, format string, r Report) error {
+	formatter, ok := Formatters[format]
+	if !ok {
+		return errors.New("invalid output format " + format + ", expected one of " + strings.Join(FormatNames(), ", "))
+	}
+	return formatter(w, r)
+}
+
+// symbol is the status of a check in the table and markdown formats, with
+// the detail of failures, or the detail of an info check.
+func symbol(check Check) string {
+	switch check.Status {
+	case StatusInfo:
+		return check.Detail
+	case StatusOK:
+		return "✓"
+	case StatusFailed:
+		if check.Detail != "" {
+			return "✗ " + check.Detail
+		}
+		return "✗"
+	case StatusError:
+		return "error"
+	case StatusUnknown:
+		return "?"
+	}
+	return "-"
+}
+
+// summary is the first line of the table and markdown formats.
+func summary(r Report) string {
+	if incomplete := r.Incomplete(); incomplete > 0 {
+		return strconv.Itoa(incomplete) + " incomplete images"
+	}
+	return "all images OK"
+}
+
+// FormatTable renders the report as a table, followed by the errors looking
+// up the images.
+func FormatTable(w io.Writer, r Report) error {
+	fmt.Fprintln(w, summary(r))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	header := append([]string{"image"}, r.Columns...)
+	dashes := make([]string, len(header))
+	for i, h := range header {
+		dashes[i] = strings.Repeat("-", len(h))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	fmt.Fprintln(tw, strings.Join(dashes, "\t"))
+
+	var errs []string
+	for _, image := range r.Images {
+		values := []string{image.Image}
+		for _, check := range image.Checks {
+			values = append(values, symbol(check))
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t")+"\t")
+
+		for _, err := range image.Errors() {
+			errs = append(errs, image.Image+": "+err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "errors:")
+		for _, err := range errs {
+			fmt.Fprintln(w, err)
+		}
+	}
+
+	return nil
+}
+
+// FormatCSV renders the report as CSV, with Y and N for the checks that
+// passed or failed, ? for the ones that weren't checked and the detail of
+// the info ones.
+func FormatCSV(w io.Writer, r Report) error {
+	fmt.Fprintln(w, strings.Join(append([]string{"image"}, r.Columns...), ","))
+
+	for _, image := range r.Images {
+		values := []string{image.Image}
+		for _, check := range image.Checks {
+			switch check.Status {
+			case StatusOK:
+				values = append(values, "Y")
+			case StatusFailed:
+				values = append(values, "N")
+			case StatusError:
+				values = append(values, "error")
+			case StatusUnknown:
+				values = append(values, "?")
+			case StatusInfo:
+				values = append(values, check.Detail)
+			default:
+				values = append(values, "")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(values, ","))
+	}
+
+	return nil
+}
+
+// FormatJSON renders the report as indented JSON, for automation.
+func FormatJSON(w io.Writer, r Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// FormatMarkdown renders the report as a GitHub flavoured markdown table,
+// for PR comments.
+func FormatMarkdown(w io.Writer, r Report) error {
+	fmt.Fprintln(w, "## "+r.Product+" "+r.Version+" images")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, summary(r))
+	fmt.Fprintln(w)
+
+	header := append([]string{"image"}, r.Columns...)
+	separators := make([]string, len(header))
+	for i := range separators {
+		separators[i] = "---"
+	}
+	fmt.Fprintln(w, "| "+strings.Join(header, " | ")+" |")
+	fmt.Fprintln(w, "|"+strings.Join(separators, "|")+"|")
+
+	var errs []string
+	for _, image := range r.Images {
+		values := []string{"`" + image.Image + "`"}
+		for _, check := range image.Checks {
+			values = append(values, symbol(check))
+		}
+		fmt.Fprintln(w, "| "+strings.Join(values, " | ")+" |")
+
+		for _, err := range image.Errors() {
+			errs = append(errs, "`"+image.Image+"`: "+err)
+		}
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "### Errors")
+		fmt.Fprintln(w)
+		for _, err := range errs {
+			fmt.Fprintln(w, "- "+err)
+		}
+	}
+
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// FormatJUnit renders the report as JUnit XML, with a test case per image.
+// Images fail if a required check failed and error if one couldn't be
+// looked up, the other failed checks are only listed in their output.
+func FormatJUnit(w io.Writer, r Report) error {
+	suite := junitTestSuite{
+		Name:  r.Product + " " + r.Version,
+		Tests: len(r.Images),
+	}
+
+	for _, image := range r.Images {
+		tc := junitTestCase{ClassName: r.Product, Name: image.Image}
+
+		var failed, errored, other []string
+		for _, check := range image.Checks {
+			if check.Status != StatusFailed && check.Status != StatusError {
+				continue
+			}
+			line := check.Name + ": " + check.Status
+			if check.Detail != "" {
+				line += ": " + check.Detail
+			}
+			switch {
+			case !check.Required:
+				other = append(other, line)
+			case check.Status == StatusError:
+				errored = append(errored, line)
+			default:
+				failed = append(failed, line)
+			}
+		}
+
+		if len(errored) > 0 {
+			suite.Errors++
+			tc.Error = &junitMessage{
+				Message: strconv.Itoa(len(errored)) + " checks errored",
+				Text:    strings.Join(append(errored, failed...), "\n"),
+			}
+		} else if len(failed) > 0 {
+			suite.Failures++
+			tc.Failure = &junitMessage{
+				Message: strconv.Itoa(len(failed)) + " checks failed",
+				Text:    strings.Join(failed, "\n"),
+			}
+		}
+		tc.SystemOut = strings.Join(other, "\n")
+
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,120 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func testReport() Report {
+	return Report{
+		Product: "rke2",
+		Version: "v1.30.2+rke2r1",
+		Columns: []string{"oss", "prime", "parity"},
+		Images: []ImageReport{
+			{
+				Image: "rancher/rke2-cloud-provider:v1.30.2-rke2r1",
+				OSS:   RegistryImage{Exists: true},
+				Prime: &RegistryImage{Error: "toomanyrequests"},
+				Checks: []Check{
+					{Name: "oss", Status: StatusOK, Required: true},
+					{Name: "prime", Status: StatusError, Detail: "toomanyrequests", Required: true},
+					{Name: "parity", Status: StatusSkipped},
+				},
+			},
+			{
+				Image: "rancher/rke2-runtime:v1.30.2-rke2r1",
+				OSS:   RegistryImage{Exists: true},
+				Prime: &RegistryImage{Exists: true},
+				Checks: []Check{
+					{Name: "oss", Status: StatusOK, Required: true},
+					{Name: "prime", Status: StatusOK, Required: true},
+					{Name: "parity", Status: StatusFailed, Detail: "linux/arm64"},
+				},
+			},
+			{
+				Image: "rancher/rke2-runtime-windows:v1.30.2-rke2r1",
+				Prime: &RegistryImage{},
+				Checks: []Check{
+					{Name: "oss", Status: StatusFailed, Required: true},
+					{Name: "prime", Status: StatusFailed, Required: true},
+					{Name: "parity", Status: StatusSkipped},
+				},
+			},
+		},
+	}
+}
+
+func TestFormatMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := FormatMarkdown(&buf, testReport()); err != nil {
+		t.Fatalf("FormatMarkdown() error = %v", err)
+	}
+
+	expected := "## rke2 v1.30.2+rke2r1 images\n" +
+		"\n" +
+		"2 incomplete images\n" +
+		"\n" +
+		"| image | oss | prime | parity |\n" +
+		"|---|---|---|---|\n" +
+		"| `rancher/rke2-cloud-provider:v1.30.2-rke2r1` | ✓ | error | - |\n" +
+		"| `rancher/rke2-runtime:v1.30.2-rke2r1` | ✓ | ✓ | ✗ linux/arm64 |\n" +
+		"| `rancher/rke2-runtime-windows:v1.30.2-rke2r1` | ✗ | ✗ | - |\n" +
+		"\n" +
+		"### Errors\n" +
+		"\n" +
+		"- `rancher/rke2-cloud-provider:v1.30.2-rke2r1`: prime: toomanyrequests\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("FormatMarkdown() output = %q, want %q", got, expected)
+	}
+}
+
+func TestFormatJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := FormatJUnit(&buf, testReport()); err != nil {
+		t.Fatalf("FormatJUnit() error = %v", err)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("FormatJUnit() output isn't valid XML: %v", err)
+	}
+	if len(suites.Suites) != 1 {
+		t.Fatalf("FormatJUnit() has %d test suites, want 1", len(suites.Suites))
+	}
+	suite := suites.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Errors != 1 {
+		t.Errorf("FormatJUnit() tests, failures, errors = %d, %d, %d, want 3, 1, 1", suite.Tests, suite.Failures, suite.Errors)
+	}
+
+	cases := suite.TestCases
+	if cases[0].Error == nil || !strings.Contains(cases[0].Error.Text, "prime: error: toomanyrequests") {
+		t.Errorf("cloud provider error = %+v", cases[0].Error)
+	}
+	if cases[1].Failure != nil || cases[1].Error != nil || cases[1].SystemOut != "parity: failed: linux/arm64" {
+		t.Errorf("runtime = %+v, want a passed test with the parity failure in its output", cases[1])
+	}
+	if cases[2].Failure == nil || cases[2].Failure.Text != "oss: failed\nprime: failed" {
+		t.Errorf("windows runtime failure = %+v", cases[2].Failure)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Format(&buf, "json", testReport()); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Format() json output isn't valid: %v", err)
+	}
+	if report.Incomplete() != 2 {
+		t.Errorf("json report has %d incomplete images, want 2", report.Incomplete())
+	}
+
+	if err := Format(&buf, "yaml", testReport()); err == nil {
+		t.Error("Format() error = nil for an invalid format")
+	}
+}
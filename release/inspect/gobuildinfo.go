@@ -0,0 +1,276 @@
+package inspect
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"golang.org/x/sync/errgroup"
+)
+
+// FilesystemClient reads the flattened filesystem of the images of a
+// registry.
+type FilesystemClient interface {
+	Filesystem(ctx context.Context, ref name.Reference, platform reg.Platform) (io.ReadCloser, error)
+}
+
+// Module is a Go module a binary was built with.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// GoBinary is the build info of a Go binary of an image.
+type GoBinary struct {
+	Path      string   `json:"path"`
+	GoVersion string   `json:"go_version"`
+	Main      Module   `json:"main"`
+	Deps      []Module `json:"deps"`
+	// FIPS is set for binaries built with the boringcrypto or the Go
+	// native FIPS 140 module.
+	FIPS bool `json:"fips"`
+}
+
+// Module returns the version of the module at path the binary was built
+// with, either its main module or one of its dependencies.
+func (b GoBinary) Module(path string) (Module, bool) {
+	if b.Main.Path == path {
+		return b.Main, true
+	}
+	for _, dep := range b.Deps {
+		if dep.Path == path {
+			return dep, true
+		}
+	}
+	return Module{}, false
+}
+
+// ImageBinaries are the Go binaries of a platform of an image. Error is set
+// if the image couldn't be read.
+type ImageBinaries struct {
+	Image    string     `json:"image"`
+	Platform string     `json:"platform"`
+	Binaries []GoBinary `json:"binaries"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// GoBinaries reads the build info of the Go binaries of every platform of
+// the images of the release of version, from the filesystems of client.
+// The results are sorted by image and platform.
+func (r *ReleaseInspector) GoBinaries(ctx context.Context, version string, client FilesystemClient) ([]ImageBinaries, error) {
+	results, err := scanFilesystems(ctx, r, version, client, func(image string, platform reg.Platform, filesystem io.Reader, err error) ImageBinaries {
+		result := ImageBinaries{Image: image, Platform: platform.String()}
+		if err == nil {
+			result.Binaries, err = ReadGoBinaries(filesystem)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Image != results[j].Image {
+			return results[i].Image < results[j].Image
+		}
+		return results[i].Platform < results[j].Platform
+	})
+
+	return results, nil
+}
+
+// GoBinariesReport builds the report of the Go binaries of the images of
+// the release of version, a row per binary. With module, only the binaries
+// built with it are reported, with its version instead of the main module.
+func (r *ReleaseInspector) GoBinariesReport(version string, results []ImageBinaries, module string) Report {
+	report := Report{
+		Product: r.product.Name,
+		Version: version,
+		Columns: []string{"platform", "binary", "go", "module", "version", "fips"},
+	}
+	if module != "" {
+		report.Columns = []string{"platform", "binary", "go", module, "fips"}
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			report.Images = append(report.Images, scanErrorReport(result.Image, result.Platform, result.Error, report.Columns))
+			continue
+		}
+		for _, binary := range result.Binaries {
+			checks := []Check{
+				infoCheck("platform", result.Platform),
+				infoCheck("binary", binary.Path),
+				infoCheck("go", binary.GoVersion),
+			}
+			if module != "" {
+				found, ok := binary.Module(module)
+				if !ok {
+					continue
+				}
+				checks = append(checks, infoCheck(module, found.Version))
+			} else {
+				checks = append(checks, infoCheck("module", binary.Main.Path), infoCheck("version", binary.Main.Version))
+			}
+			fips := "N"
+			if binary.FIPS {
+				fips = "Y"
+			}
+			checks = append(checks, infoCheck("fips", fips))
+
+			report.Images = append(report.Images, ImageReport{Image: result.Image, OSS: RegistryImage{Exists: true}, Checks: checks})
+		}
+	}
+
+	return report
+}
+
+// scanFilesystems returns the results of scan for the filesystem of every
+// platform of the images of the release of version, or the error getting
+// it, with at most concurrencyLimit filesystems read at once.
+func scanFilesystems[T any](ctx context.Context, r *ReleaseInspector, version string, client FilesystemClient, scan func(image string, platform reg.Platform, filesystem io.Reader, err error) T) ([]T, error) {
+	images, err := r.releaseImages(version)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []T
+	var mu sync.Mutex
+
+	var g errgroup.Group
+	g.SetLimit(r.concurrencyLimit)
+
+	for key, image := range images {
+		for _, platform := range image.Platforms {
+			g.Go(func() error {
+				var result T
+				rc, err := client.Filesystem(ctx, image.Reference, platform)
+				if err != nil {
+					result = scan(key, platform, nil, err)
+				} else {
+					result = scan(key, platform, rc, nil)
+					rc.Close()
+				}
+
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+
+				return nil
+			})
+		}
+	}
+
+	return results, g.Wait()
+}
+
+// ReadGoBinaries returns the build info of the ELF and PE Go binaries of a
+// tarball, sorted by path. Files that aren't executables are skipped
+// without being read, executables are spilled to a temporary file to be
+// read without holding them in memory.
+func ReadGoBinaries(r io.Reader) ([]GoBinary, error) {
+	tmp, err := os.CreateTemp("", "gobinary-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var binaries []GoBinary
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		magic := make([]byte, 4)
+		if _, err := io.ReadFull(tr, magic); err != nil {
+			continue
+		}
+		if !bytes.Equal(magic, []byte("\x7fELF")) && !bytes.HasPrefix(magic, []byte("MZ")) {
+			continue
+		}
+
+		size, err := spill(tmp, io.MultiReader(bytes.NewReader(magic), tr))
+		if err != nil {
+			return nil, err
+		}
+		info, err := buildinfo.Read(io.NewSectionReader(tmp, 0, size))
+		if err != nil {
+			// not a Go binary
+			continue
+		}
+
+		binaries = append(binaries, goBinary("/"+strings.TrimPrefix(header.Name, "/"), info))
+	}
+
+	sort.Slice(binaries, func(i, j int) bool {
+		return binaries[i].Path < binaries[j].Path
+	})
+
+	return binaries, nil
+}
+
+// spill replaces the content of f with the content of r and returns its
+// size.
+func spill(f *os.File, r io.Reader) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(f, r)
+}
+
+func goBinary(path string, info *debug.BuildInfo) GoBinary {
+	binary := GoBinary{
+		Path:      path,
+		GoVersion: info.GoVersion,
+		Main:      Module{Path: info.Main.Path, Version: info.Main.Version},
+		FIPS:      strings.Contains(info.GoVersion, "boringcrypto"),
+	}
+
+	for _, dep := range info.Deps {
+		module := Module{Path: dep.Path, Version: dep.Version}
+		if dep.Replace != nil {
+			module.Version = dep.Replace.Version
+		}
+		binary.Deps = append(binary.Deps, module)
+	}
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "GOEXPERIMENT", "-tags":
+			if strings.Contains(setting.Value, "boringcrypto") {
+				binary.FIPS = true
+			}
+		case "GOFIPS140":
+			if setting.Value != "" && setting.Value != "off" {
+				binary.FIPS = true
+			}
+		}
+	}
+
+	return binary
+}
@@ -0,0 +1,151 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/ecm-distro-tools/internal/tartest"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+// imageFilesystem returns a tarball with the test binary, which is a Go
+// binary, at path and a few other files.
+func imageFilesystem(t *testing.T, path string) []byte {
+	t.Helper()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tartest.Tarball(t, map[string][]byte{
+		"etc/os-release": []byte("ID=sles\n"),
+		path:             binary,
+		// an ELF header without any build info
+		"usr/lib/libc.so.6": []byte("\x7fELF\x02\x01\x01"),
+		"usr/bin/empty":     nil,
+	}, nil, false)
+}
+
+// filesystemClient returns the same filesystem for every image, and fails
+// for the images containing failing.
+type filesystemClient struct {
+	filesystem []byte
+	failing    string
+}
+
+func (c filesystemClient) Filesystem(_ context.Context, ref name.Reference, _ reg.Platform) (io.ReadCloser, error) {
+	if c.failing != "" && strings.Contains(ref.String(), c.failing) {
+		return nil, errors.New("MANIFEST_UNKNOWN")
+	}
+	return io.NopCloser(bytes.NewReader(c.filesystem)), nil
+}
+
+func TestReadGoBinaries(t *testing.T) {
+	binaries, err := ReadGoBinaries(bytes.NewReader(imageFilesystem(t, "bin/containerd")))
+	if err != nil {
+		t.Fatalf("ReadGoBinaries() error = %v", err)
+	}
+	if len(binaries) != 1 {
+		t.Fatalf("ReadGoBinaries() = %+v, want the test binary", binaries)
+	}
+
+	binary := binaries[0]
+	if binary.Path != "/bin/containerd" {
+		t.Errorf("binary path = %s, want /bin/containerd", binary.Path)
+	}
+	if binary.GoVersion != runtime.Version() {
+		t.Errorf("binary go version = %s, want %s", binary.GoVersion, runtime.Version())
+	}
+	if binary.Main.Path != "github.com/rancher/ecm-distro-tools" {
+		t.Errorf("binary main module = %s, want github.com/rancher/ecm-distro-tools", binary.Main.Path)
+	}
+	if _, ok := binary.Module("github.com/google/go-containerregistry"); !ok {
+		t.Error("binary module github.com/google/go-containerregistry not found")
+	}
+	if _, ok := binary.Module("github.com/rancher/not-a-dependency"); ok {
+		t.Error("binary module github.com/rancher/not-a-dependency found")
+	}
+}
+
+func TestGoBinaries(t *testing.T) {
+	assets := fstest.MapFS{
+		"k3s-images.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/klipper-helm:v0.8.3-build20240228\ndocker.io/rancher/mirrored-pause:3.6"),
+		},
+	}
+	client := filesystemClient{filesystem: imageFilesystem(t, "usr/bin/helm_v3"), failing: "mirrored-pause"}
+
+	inspector := NewReleaseInspector(assets, K3s, nil, nil, false)
+	results, err := inspector.GoBinaries(context.Background(), "v1.30.2+k3s1", client)
+	if err != nil {
+		t.Fatalf("GoBinaries() error = %v", err)
+	}
+
+	// every image for amd64, arm and arm64
+	if len(results) != 6 {
+		t.Fatalf("GoBinaries() returned %d results, want 6", len(results))
+	}
+	for i, result := range results {
+		failing := strings.Contains(result.Image, "mirrored-pause")
+		if failing != (result.Error != "") {
+			t.Errorf("%s %s error = %q", result.Image, result.Platform, result.Error)
+		}
+		if !failing && (len(result.Binaries) != 1 || result.Binaries[0].Path != "/usr/bin/helm_v3") {
+			t.Errorf("%s %s binaries = %+v", result.Image, result.Platform, result.Binaries)
+		}
+		if i > 0 && results[i-1].Image > result.Image {
+			t.Errorf("GoBinaries() results aren't sorted by image")
+		}
+	}
+
+	if _, err := inspector.GoBinaries(context.Background(), "v1.30.2+rke2r1", client); err == nil {
+		t.Error("GoBinaries() error = nil for a rke2 release")
+	}
+}
+
+func TestGoBinariesReport(t *testing.T) {
+	results := []ImageBinaries{
+		{
+			Image:    "rancher/klipper-helm:v0.8.3-build20240228",
+			Platform: "linux/amd64",
+			Binaries: []GoBinary{
+				{Path: "/usr/bin/helm_v3", GoVersion: "go1.22.4", Main: Module{Path: "helm.sh/helm/v3", Version: "v3.15.2"}, Deps: []Module{{Path: "golang.org/x/net", Version: "v0.26.0"}}},
+				{Path: "/usr/bin/entry", GoVersion: "go1.22.4 X:boringcrypto", Main: Module{Path: "github.com/k3s-io/klipper-helm"}, FIPS: true},
+			},
+		},
+		{Image: "rancher/mirrored-pause:3.6", Platform: "linux/arm64", Error: "MANIFEST_UNKNOWN"},
+	}
+	inspector := NewReleaseInspector(nil, K3s, nil, nil, false)
+
+	report := inspector.GoBinariesReport("v1.30.2+k3s1", results, "")
+	if len(report.Images) != 3 || report.Incomplete() != 1 {
+		t.Fatalf("GoBinariesReport() = %+v, want 3 rows with 1 error", report)
+	}
+	if fips := report.Images[1].Checks[len(report.Columns)-1]; fips.Detail != "Y" {
+		t.Errorf("GoBinariesReport() fips = %+v, want Y", fips)
+	}
+
+	report = inspector.GoBinariesReport("v1.30.2+k3s1", results, "golang.org/x/net")
+	if len(report.Images) != 2 {
+		t.Fatalf("GoBinariesReport() with module = %+v, want the helm binary and the error", report)
+	}
+	if version := report.Images[0].Checks[3]; version.Name != "golang.org/x/net" || version.Detail != "v0.26.0" {
+		t.Errorf("GoBinariesReport() module version = %+v, want v0.26.0", version)
+	}
+	if errs := report.Images[1].Errors(); len(errs) != 1 || !strings.Contains(errs[0], "linux/arm64: MANIFEST_UNKNOWN") {
+		t.Errorf("GoBinariesReport() errors = %v", errs)
+	}
+}
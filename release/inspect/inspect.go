@@ -0,0 +1,214 @@
+// Package inspect checks that the images listed in the assets of a k3s,
+// rke2 or Rancher release are published to the OSS and Prime registries.
+package inspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	ver "github.com/rancher/ecm-distro-tools/release/version"
+	"golang.org/x/sync/errgroup"
+)
+
+// RegistryClient defines the interface for interacting with container registries
+type RegistryClient interface {
+	Image(ctx context.Context, ref name.Reference) (reg.Image, error)
+}
+
+// ReleaseImage is an image listed in the image lists of a release, with the
+// platforms of every list it's in.
+type ReleaseImage struct {
+	Reference name.Reference
+	Platforms []reg.Platform
+	// WindowsBuilds are the Windows builds the image is expected to have a
+	// manifest for.
+	WindowsBuilds []WindowsBuild
+}
+
+// Expects reports whether the image is listed for platform.
+func (i ReleaseImage) Expects(platform reg.Platform) bool {
+	return slices.Contains(i.Platforms, platform)
+}
+
+// DefaultConcurrencyLimit is the number of images checked at once.
+const DefaultConcurrencyLimit = 10
+
+// Image contains the manifest info of an image in the oss and prime registries
+type Image struct {
+	ReleaseImage
+	OSSImage   reg.Image
+	PrimeImage reg.Image
+	// OSSErr and PrimeErr are set if the image couldn't be looked up, in
+	// which case its existence is unknown.
+	OSSErr   error
+	PrimeErr error
+}
+
+type ReleaseInspector struct {
+	assets               fs.FS
+	product              Product
+	oss                  RegistryClient
+	prime                RegistryClient
+	concurrencyLimit     int
+	windowsBuilds        []WindowsBuild
+	requiredAttestations []string
+	debug                bool
+}
+
+func NewReleaseInspector(fs fs.FS, product Product, oss, prime RegistryClient, debug bool) *ReleaseInspector {
+	return &ReleaseInspector{
+		assets:           fs,
+		product:          product,
+		oss:              oss,
+		prime:            prime,
+		concurrencyLimit: DefaultConcurrencyLimit,
+		windowsBuilds:    DefaultWindowsBuilds,
+		debug:            debug,
+	}
+}
+
+// SetConcurrencyLimit sets the number of images checked at once.
+func (r *ReleaseInspector) SetConcurrencyLimit(limit int) {
+	r.concurrencyLimit = max(limit, 1)
+}
+
+// SetWindowsBuilds sets the Windows builds the images of the image lists
+// with WindowsBuilds are expected for.
+func (r *ReleaseInspector) SetWindowsBuilds(builds []WindowsBuild) {
+	r.windowsBuilds = builds
+}
+
+func (r *ReleaseInspector) InspectRelease(ctx context.Context, version string) ([]Image, error) {
+	requiredImages, err := r.releaseImages(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.checkImages(ctx, requiredImages)
+}
+
+// releaseImages checks version is a release of the product and returns the
+// images of its image lists.
+func (r *ReleaseInspector) releaseImages(version string) (map[string]ReleaseImage, error) {
+	v, err := ver.Parse(version)
+	if err != nil {
+		return nil, err
+	}
+	if !r.product.accepts(v) {
+		return nil, errors.New(version + " isn't a " + r.product.Name + " release")
+	}
+
+	return r.imageMap()
+}
+
+// imageMap reads the image lists of the product and coalesces them into one
+// map to collect images for all platforms.
+func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
+	// download image lists for release
+	lists := make([][]string, len(r.product.ImageLists))
+
+	g := new(errgroup.Group)
+
+	for i, list := range r.product.ImageLists {
+		g.Go(func() (err error) {
+			lists[i], err = r.readImageList(list.Name)
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// merge all images into a map
+	imageMap := make(map[string]ReleaseImage)
+	for i, images := range lists {
+		for _, image := range images {
+			if image == "" {
+				continue
+			}
+
+			ref, err := name.ParseReference(image)
+			if err != nil {
+				continue
+			}
+
+			key := ref.Context().RepositoryStr() + ":" + ref.Identifier()
+			info := imageMap[key]
+			info.Reference = ref
+
+			for _, platform := range r.product.ImageLists[i].Platforms {
+				if !info.Expects(platform) {
+					info.Platforms = append(info.Platforms, platform)
+				}
+			}
+			if r.product.ImageLists[i].WindowsBuilds {
+				info.WindowsBuilds = r.windowsBuilds
+			}
+
+			imageMap[key] = info
+		}
+	}
+
+	return imageMap, nil
+}
+
+// readImageList reads an image list file and returns its contents
+func (r *ReleaseInspector) readImageList(filename string) ([]string, error) {
+	file, err := r.assets.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSpace(string(content)), "\n"), nil
+}
+
+// checkImages checks if the required images exist in the OSS and Prime
+// registries, with at most concurrencyLimit images checked at once.
+func (r *ReleaseInspector) checkImages(ctx context.Context, requiredImages map[string]ReleaseImage) ([]Image, error) {
+	results := make([]Image, 0, len(requiredImages))
+	var mu sync.Mutex
+
+	var g errgroup.Group
+	g.SetLimit(r.concurrencyLimit)
+
+	for _, required := range requiredImages {
+		g.Go(func() error {
+			result := Image{ReleaseImage: required}
+			result.OSSImage, result.OSSErr = r.oss.Image(ctx, required.Reference)
+			if r.prime != nil {
+				result.PrimeImage, result.PrimeErr = r.prime.Image(ctx, required.Reference)
+			}
+			if r.debug {
+				for _, err := range []error{result.OSSErr, result.PrimeErr} {
+					if err != nil {
+						fmt.Println(required.Reference.String() + ": " + err.Error())
+					}
+				}
+			}
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+	g.Wait()
+
+	return results, nil
+}
@@ -0,0 +1,260 @@
+package inspect
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+func newMockFS() fs.FS {
+	return fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": &fstest.MapFile{
+			Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1\nrancher/rke2-cloud-provider:v1.23.4-rke2r1"),
+		},
+		"rke2-images-all.linux-arm64.txt": &fstest.MapFile{
+			Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1"),
+		},
+		"rke2-images.windows-amd64.txt": &fstest.MapFile{
+			Data: []byte("rancher/rke2-runtime-windows:v1.23.4-rke2r1"),
+		},
+	}
+}
+
+func TestImageMap(t *testing.T) {
+	inspector := NewReleaseInspector(newMockFS(), RKE2, nil, nil, false)
+
+	imageMap, err := inspector.imageMap()
+	if err != nil {
+		t.Fatalf("imageMap() error = %v", err)
+	}
+
+	expectedImages := map[string]struct {
+		amd64 bool
+		arm64 bool
+		win   bool
+	}{
+		"rancher/rke2-runtime:v1.23.4-rke2r1": {
+			amd64: true,
+			arm64: true,
+			win:   false,
+		},
+		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
+			amd64: true,
+			arm64: false,
+			win:   false,
+		},
+		"rancher/rke2-runtime-windows:v1.23.4-rke2r1": {
+			amd64: false,
+			arm64: false,
+			win:   true,
+		},
+	}
+
+	for imageName, expected := range expectedImages {
+		image, ok := imageMap[imageName]
+		if !ok {
+			t.Errorf("imageMap() missing expected image %s", imageName)
+			continue
+		}
+
+		if image.Expects(LinuxAmd64) != expected.amd64 {
+			t.Errorf("image %s: got amd64 = %v, want %v", imageName, image.Expects(LinuxAmd64), expected.amd64)
+		}
+		if image.Expects(LinuxArm64) != expected.arm64 {
+			t.Errorf("image %s: got arm64 = %v, want %v", imageName, image.Expects(LinuxArm64), expected.arm64)
+		}
+		if image.Expects(WindowsAmd64) != expected.win {
+			t.Errorf("image %s: got windows = %v, want %v", imageName, image.Expects(WindowsAmd64), expected.win)
+		}
+		if (len(image.WindowsBuilds) > 0) != expected.win {
+			t.Errorf("image %s: got windows builds = %v, want builds %v", imageName, image.WindowsBuilds, expected.win)
+		}
+	}
+}
+
+func TestReadImageList(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "read rke2-images-all.linux-amd64.txt",
+			filename: "rke2-images-all.linux-amd64.txt",
+			want:     []string{"rancher/rke2-runtime:v1.23.4-rke2r1", "rancher/rke2-cloud-provider:v1.23.4-rke2r1"},
+		},
+		{
+			name:     "read nonexistent file",
+			filename: "fake.txt",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector := NewReleaseInspector(newMockFS(), RKE2, nil, nil, false)
+
+			got, err := inspector.readImageList(tt.filename)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readImageList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err != nil {
+				return
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("readImageList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestK3sImageMap(t *testing.T) {
+	assets := fstest.MapFS{
+		"k3s-images.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/klipper-helm:v0.8.4-build20240523\ndocker.io/rancher/mirrored-pause:3.6\n"),
+		},
+	}
+	inspector := NewReleaseInspector(assets, K3s, nil, nil, false)
+
+	imageMap, err := inspector.imageMap()
+	if err != nil {
+		t.Fatalf("imageMap() error = %v", err)
+	}
+
+	image, ok := imageMap["rancher/mirrored-pause:3.6"]
+	if !ok {
+		t.Fatalf("imageMap() missing rancher/mirrored-pause:3.6: %v", imageMap)
+	}
+	for _, platform := range []reg.Platform{LinuxAmd64, LinuxArm64, LinuxArm} {
+		if !image.Expects(platform) {
+			t.Errorf("image rancher/mirrored-pause:3.6 not expected for %s", platform)
+		}
+	}
+	if image.Expects(WindowsAmd64) {
+		t.Errorf("image rancher/mirrored-pause:3.6 expected for %s", WindowsAmd64)
+	}
+}
+
+func TestProductFor(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{version: "v1.30.2+rke2r1", want: "rke2"},
+		{version: "v1.30.2-rc1+rke2r1", want: "rke2"},
+		{version: "v1.30.2+k3s1", want: "k3s"},
+		{version: "v1.30.2", wantErr: true},
+		{version: "v2.9.0-rc1", want: "rancher"},
+		{version: "v2.9.2", want: "rancher"},
+		{version: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ProductFor(tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProductFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Name != tt.want {
+				t.Errorf("ProductFor() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestRancherImageMap(t *testing.T) {
+	assets := fstest.MapFS{
+		"rancher-images.txt": &fstest.MapFile{
+			Data: []byte("rancher/rancher:v2.9.2\nrancher/rancher-agent:v2.9.2\n"),
+		},
+		"rancher-windows-images.txt": &fstest.MapFile{
+			Data: []byte("rancher/rancher-agent:v2.9.2\nrancher/wins:v0.4.20\n"),
+		},
+	}
+	inspector := NewReleaseInspector(assets, RancherPrime, nil, nil, false)
+
+	imageMap, err := inspector.imageMap()
+	if err != nil {
+		t.Fatalf("imageMap() error = %v", err)
+	}
+
+	tests := []struct {
+		image string
+		want  []reg.Platform
+	}{
+		{image: "rancher/rancher:v2.9.2", want: []reg.Platform{LinuxAmd64, LinuxArm64}},
+		{image: "rancher/rancher-agent:v2.9.2", want: []reg.Platform{LinuxAmd64, LinuxArm64, WindowsAmd64}},
+		{image: "rancher/wins:v0.4.20", want: []reg.Platform{WindowsAmd64}},
+	}
+	for _, tt := range tests {
+		image, ok := imageMap[tt.image]
+		if !ok {
+			t.Errorf("imageMap() missing expected image %s", tt.image)
+			continue
+		}
+		if !slices.Equal(image.Platforms, tt.want) {
+			t.Errorf("image %s: got platforms %v, want %v", tt.image, image.Platforms, tt.want)
+		}
+	}
+}
+
+// errClient fails to look up the images in failing, and reports the others
+// as existing.
+type errClient struct {
+	failing string
+}
+
+func (c errClient) Image(ctx context.Context, ref name.Reference) (reg.Image, error) {
+	if strings.Contains(ref.String(), c.failing) {
+		return reg.Image{}, errors.New("toomanyrequests")
+	}
+	return reg.Image{Exists: true, Platforms: map[reg.Platform]bool{}}, nil
+}
+
+func TestInspectReleaseErrors(t *testing.T) {
+	inspector := NewReleaseInspector(newMockFS(), RKE2, errClient{failing: "rke2-runtime-windows"}, nil, false)
+	inspector.SetConcurrencyLimit(1)
+
+	results, err := inspector.InspectRelease(context.Background(), "v1.23.4+rke2r1")
+	if err != nil {
+		t.Fatalf("InspectRelease() error = %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("InspectRelease() returned %d images, want 3", len(results))
+	}
+	for _, result := range results {
+		failed := strings.Contains(result.Reference.String(), "rke2-runtime-windows")
+		if (result.OSSErr != nil) != failed {
+			t.Errorf("%s OSSErr = %v, want error %v", result.Reference, result.OSSErr, failed)
+		}
+		if result.PrimeErr != nil {
+			t.Errorf("%s PrimeErr = %v, want nil without a prime registry", result.Reference, result.PrimeErr)
+		}
+	}
+}
+
+func TestSetWindowsBuilds(t *testing.T) {
+	builds := []WindowsBuild{{Name: "ltsc2025", OSVersion: "10.0.26100"}}
+
+	inspector := NewReleaseInspector(newMockFS(), RKE2, nil, nil, false)
+	inspector.SetWindowsBuilds(builds)
+
+	imageMap, err := inspector.imageMap()
+	if err != nil {
+		t.Fatalf("imageMap() error = %v", err)
+	}
+	if got := imageMap["rancher/rke2-runtime-windows:v1.23.4-rke2r1"].WindowsBuilds; !slices.Equal(got, builds) {
+		t.Errorf("windows builds = %v, want %v", got, builds)
+	}
+}
@@ -0,0 +1,307 @@
+package inspect
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+const (
+	PackageManagerAPK  = "apk"
+	PackageManagerDpkg = "dpkg"
+	PackageManagerRPM  = "rpm"
+)
+
+// Package is a package installed in an image.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ImageOS is the base OS and the packages of a platform of an image. The
+// distro is empty for images without an os-release, e.g. scratch ones, and
+// the package manager for images without a package database.
+// PackagesUnknown is set if the package database can't be read. Error is
+// set if the image couldn't be read.
+type ImageOS struct {
+	Image           string    `json:"image"`
+	Platform        string    `json:"platform"`
+	Distro          string    `json:"distro,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	Name            string    `json:"name,omitempty"`
+	PackageManager  string    `json:"package_manager,omitempty"`
+	Packages        []Package `json:"packages,omitempty"`
+	PackagesUnknown bool      `json:"packages_unknown,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Package returns the installed package named name.
+func (i ImageOS) Package(name string) (Package, bool) {
+	for _, pkg := range i.Packages {
+		if pkg.Name == name {
+			return pkg, true
+		}
+	}
+	return Package{}, false
+}
+
+// ImagesOS reads the os-release and package database of every platform of
+// the images of the release of version, from the filesystems of client.
+// The results are sorted by image and platform.
+func (r *ReleaseInspector) ImagesOS(ctx context.Context, version string, client FilesystemClient) ([]ImageOS, error) {
+	results, err := scanFilesystems(ctx, r, version, client, func(image string, platform reg.Platform, filesystem io.Reader, err error) ImageOS {
+		var result ImageOS
+		if err == nil {
+			result, err = ReadImageOS(filesystem)
+		}
+		result.Image = image
+		result.Platform = platform.String()
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Image != results[j].Image {
+			return results[i].Image < results[j].Image
+		}
+		return results[i].Platform < results[j].Platform
+	})
+
+	return results, nil
+}
+
+// ImagesOSReport builds the report of the base OS of the images of the
+// release of version, a row per platform of an image. With pkg, only the
+// images with it installed are reported, with its version instead of the
+// number of packages.
+func (r *ReleaseInspector) ImagesOSReport(version string, results []ImageOS, pkg string) Report {
+	report := Report{
+		Product: r.product.Name,
+		Version: version,
+		Columns: []string{"platform", "distro", "version", "packages"},
+	}
+	if pkg != "" {
+		report.Columns[len(report.Columns)-1] = pkg
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			report.Images = append(report.Images, scanErrorReport(result.Image, result.Platform, result.Error, report.Columns))
+			continue
+		}
+
+		distro := result.Distro
+		if distro == "" {
+			distro = "-"
+		}
+		checks := []Check{
+			infoCheck("platform", result.Platform),
+			infoCheck("distro", distro),
+			infoCheck("version", result.Version),
+		}
+		switch {
+		case result.PackagesUnknown:
+			checks = append(checks, Check{Name: report.Columns[len(report.Columns)-1], Status: StatusUnknown})
+		case pkg != "":
+			found, ok := result.Package(pkg)
+			if !ok {
+				continue
+			}
+			checks = append(checks, infoCheck(pkg, found.Version))
+		case result.PackageManager == "":
+			checks = append(checks, infoCheck("packages", "-"))
+		default:
+			checks = append(checks, infoCheck("packages", strconv.Itoa(len(result.Packages))+" "+result.PackageManager))
+		}
+
+		report.Images = append(report.Images, ImageReport{Image: result.Image, OSS: RegistryImage{Exists: true}, Checks: checks})
+	}
+
+	return report
+}
+
+// ReadImageOS reads the os-release and the apk, dpkg or rpm package
+// database of the flattened filesystem of an image. rpm databases are only
+// read in the ndb format of SUSE images, the packages of the sqlite and
+// Berkeley DB ones are unknown.
+func ReadImageOS(r io.Reader) (ImageOS, error) {
+	var osRelease, usrOSRelease, apk, dpkg, rpmNDB []byte
+	var dpkgStatusD [][]byte
+	var rpmUnsupported bool
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImageOS{}, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(header.Name, "./"), "/")
+		var dst *[]byte
+		switch {
+		case name == "etc/os-release":
+			dst = &osRelease
+		case name == "usr/lib/os-release":
+			dst = &usrOSRelease
+		case name == "lib/apk/db/installed":
+			dst = &apk
+		case name == "var/lib/dpkg/status":
+			dst = &dpkg
+		case strings.HasPrefix(name, "var/lib/dpkg/status.d/"):
+			// distroless images have a status file per package
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return ImageOS{}, err
+			}
+			dpkgStatusD = append(dpkgStatusD, content)
+			continue
+		case name == "var/lib/rpm/Packages.db", name == "usr/lib/sysimage/rpm/Packages.db":
+			dst = &rpmNDB
+		case name == "var/lib/rpm/rpmdb.sqlite", name == "usr/lib/sysimage/rpm/rpmdb.sqlite",
+			name == "var/lib/rpm/Packages", name == "usr/lib/sysimage/rpm/Packages":
+			rpmUnsupported = true
+			continue
+		default:
+			continue
+		}
+
+		if *dst, err = io.ReadAll(tr); err != nil {
+			return ImageOS{}, err
+		}
+	}
+
+	var result ImageOS
+
+	// etc/os-release is usually a link to usr/lib/os-release
+	if osRelease == nil {
+		osRelease = usrOSRelease
+	}
+	fields := parseOSRelease(osRelease)
+	result.Distro = fields["ID"]
+	result.Version = fields["VERSION_ID"]
+	result.Name = fields["PRETTY_NAME"]
+
+	var err error
+	switch {
+	case apk != nil:
+		result.PackageManager = PackageManagerAPK
+		result.Packages = parseAPKInstalled(apk)
+	case dpkg != nil || dpkgStatusD != nil:
+		result.PackageManager = PackageManagerDpkg
+		result.Packages = parseDpkgStatus(append(dpkgStatusD, dpkg)...)
+	case rpmNDB != nil:
+		result.PackageManager = PackageManagerRPM
+		result.Packages, err = readRPMNDB(rpmNDB)
+	case rpmUnsupported:
+		result.PackageManager = PackageManagerRPM
+		result.PackagesUnknown = true
+	}
+
+	sort.Slice(result.Packages, func(i, j int) bool {
+		return result.Packages[i].Name < result.Packages[j].Name
+	})
+
+	return result, err
+}
+
+// parseOSRelease returns the fields of an os-release file.
+func parseOSRelease(content []byte) map[string]string {
+	fields := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		fields[key] = value
+	}
+
+	return fields
+}
+
+// parseAPKInstalled returns the packages of an apk installed database, with
+// a P: name and V: version line per package.
+func parseAPKInstalled(content []byte) []Package {
+	var packages []Package
+	var pkg Package
+
+	for _, line := range strings.Split(string(content), "\n") {
+		switch {
+		case strings.HasPrefix(line, "P:"):
+			pkg.Name = line[2:]
+		case strings.HasPrefix(line, "V:"):
+			pkg.Version = line[2:]
+		case line == "":
+			if pkg.Name != "" {
+				packages = append(packages, pkg)
+			}
+			pkg = Package{}
+		}
+	}
+	if pkg.Name != "" {
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+// parseDpkgStatus returns the installed packages of dpkg status files, with
+// a paragraph per package.
+func parseDpkgStatus(contents ...[]byte) []Package {
+	var packages []Package
+
+	for _, content := range contents {
+		for _, paragraph := range strings.Split(string(content), "\n\n") {
+			var pkg Package
+			installed := true
+			for _, line := range strings.Split(paragraph, "\n") {
+				key, value, ok := strings.Cut(line, ":")
+				if !ok {
+					continue
+				}
+				value = strings.TrimSpace(value)
+				switch key {
+				case "Package":
+					pkg.Name = value
+				case "Version":
+					pkg.Version = value
+				case "Status":
+					installed = strings.HasSuffix(value, " installed")
+				}
+			}
+			if pkg.Name != "" && installed {
+				packages = append(packages, pkg)
+			}
+		}
+	}
+
+	return packages
+}
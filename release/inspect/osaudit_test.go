@@ -0,0 +1,255 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rancher/ecm-distro-tools/internal/tartest"
+)
+
+// rpmHeader returns an rpm header blob for a package.
+func rpmHeader(name, version, release string, epoch uint32) []byte {
+	var data bytes.Buffer
+	var index []byte
+	entry := func(tag, kind uint32, value []byte) {
+		index = binary.BigEndian.AppendUint32(index, tag)
+		index = binary.BigEndian.AppendUint32(index, kind)
+		index = binary.BigEndian.AppendUint32(index, uint32(data.Len()))
+		index = binary.BigEndian.AppendUint32(index, 1)
+		data.Write(value)
+	}
+	entry(rpmTagName, rpmTypeString, append([]byte(name), 0))
+	entry(rpmTagVersion, rpmTypeString, append([]byte(version), 0))
+	entry(rpmTagRelease, rpmTypeString, append([]byte(release), 0))
+	if epoch != 0 {
+		// int32 values are aligned
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+		entry(rpmTagEpoch, rpmTypeInt32, binary.BigEndian.AppendUint32(nil, epoch))
+	}
+
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(index)/16))
+	blob = binary.BigEndian.AppendUint32(blob, uint32(data.Len()))
+	blob = append(blob, index...)
+	return append(blob, data.Bytes()...)
+}
+
+// rpmNDB returns an ndb database with a page of slots, followed by the
+// blobs of the headers.
+func rpmNDB(headers ...[]byte) []byte {
+	db := make([]byte, ndbPageSize)
+	binary.LittleEndian.PutUint32(db, ndbHeaderMagic)
+	binary.LittleEndian.PutUint32(db[12:], 1)
+	for offset := 2 * ndbSlotSize; offset < ndbPageSize; offset += ndbSlotSize {
+		binary.LittleEndian.PutUint32(db[offset:], ndbSlotMagic)
+	}
+
+	for i, header := range headers {
+		slot := db[(2+i)*ndbSlotSize:]
+		binary.LittleEndian.PutUint32(slot[4:], uint32(i+1))
+		binary.LittleEndian.PutUint32(slot[8:], uint32(len(db)/ndbBlobAlignment))
+
+		blob := binary.LittleEndian.AppendUint32(nil, ndbBlobMagic)
+		blob = binary.LittleEndian.AppendUint32(blob, uint32(i+1))
+		blob = binary.LittleEndian.AppendUint32(blob, 0)
+		blob = binary.LittleEndian.AppendUint32(blob, uint32(len(header)))
+		blob = append(blob, header...)
+		for len(blob)%ndbBlobAlignment != 0 {
+			blob = append(blob, 0)
+		}
+		db = append(db, blob...)
+	}
+
+	return db
+}
+
+func TestReadImageOS(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string][]byte
+		links    map[string]string
+		want     ImageOS
+		packages []Package
+		wantErr  bool
+	}{
+		{
+			name: "alpine",
+			files: map[string][]byte{
+				"etc/os-release":       []byte("NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.20.1\nPRETTY_NAME=\"Alpine Linux v3.20\"\n"),
+				"lib/apk/db/installed": []byte("C:Q1abc=\nP:musl\nV:1.2.5-r0\nA:x86_64\n\nP:libssl3\nV:3.3.1-r0\n\n"),
+			},
+			want:     ImageOS{Distro: "alpine", Version: "3.20.1", Name: "Alpine Linux v3.20", PackageManager: PackageManagerAPK},
+			packages: []Package{{Name: "libssl3", Version: "3.3.1-r0"}, {Name: "musl", Version: "1.2.5-r0"}},
+		},
+		{
+			name: "distroless",
+			files: map[string][]byte{
+				"etc/os-release":                 []byte("ID=debian\nVERSION_ID=\"12\"\nPRETTY_NAME=\"Distroless\"\n"),
+				"var/lib/dpkg/status.d/libc6":    []byte("Package: libc6\nVersion: 2.36-9+deb12u7\nArchitecture: amd64\n"),
+				"var/lib/dpkg/status.d/openssl":  []byte("Package: openssl\nVersion: 3.0.13-1~deb12u1\n"),
+				"var/lib/dpkg/status.d/netbase":  []byte("Package: netbase\nVersion: 6.4\n"),
+				"var/lib/dpkg/status.d/.ignored": nil,
+			},
+			want: ImageOS{Distro: "debian", Version: "12", Name: "Distroless", PackageManager: PackageManagerDpkg},
+			packages: []Package{
+				{Name: "libc6", Version: "2.36-9+deb12u7"},
+				{Name: "netbase", Version: "6.4"},
+				{Name: "openssl", Version: "3.0.13-1~deb12u1"},
+			},
+		},
+		{
+			name: "debian removed packages",
+			files: map[string][]byte{
+				"var/lib/dpkg/status": []byte("Package: bash\nStatus: install ok installed\nVersion: 5.2.15-2+b7\n\nPackage: vim\nStatus: deinstall ok config-files\nVersion: 9.0\n"),
+			},
+			want:     ImageOS{PackageManager: PackageManagerDpkg},
+			packages: []Package{{Name: "bash", Version: "5.2.15-2+b7"}},
+		},
+		{
+			name: "sle bci",
+			files: map[string][]byte{
+				"usr/lib/os-release": []byte("NAME=\"SLES\"\nVERSION_ID=\"15.6\"\nID=\"sles\"\nPRETTY_NAME=\"SUSE Linux Enterprise Server 15 SP6\"\n"),
+				"usr/lib/sysimage/rpm/Packages.db": rpmNDB(
+					rpmHeader("openssl-3", "3.1.4", "150600.5.7.1", 0),
+					rpmHeader("glibc", "2.38", "150600.14.5.1", 0),
+					rpmHeader("perl", "5.26.1", "150300.17.14.1", 2),
+				),
+			},
+			links: map[string]string{"etc/os-release": "../usr/lib/os-release"},
+			want:  ImageOS{Distro: "sles", Version: "15.6", Name: "SUSE Linux Enterprise Server 15 SP6", PackageManager: PackageManagerRPM},
+			packages: []Package{
+				{Name: "glibc", Version: "2.38-150600.14.5.1"},
+				{Name: "openssl-3", Version: "3.1.4-150600.5.7.1"},
+				{Name: "perl", Version: "2:5.26.1-150300.17.14.1"},
+			},
+		},
+		{
+			name: "rpm sqlite",
+			files: map[string][]byte{
+				"etc/os-release":           []byte("ID=rhel\nVERSION_ID=9.4\n"),
+				"var/lib/rpm/rpmdb.sqlite": []byte("SQLite format 3\x00"),
+			},
+			want: ImageOS{Distro: "rhel", Version: "9.4", PackageManager: PackageManagerRPM, PackagesUnknown: true},
+		},
+		{
+			name:  "scratch",
+			files: map[string][]byte{"bin/kube-proxy": []byte("\x7fELF")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadImageOS(bytes.NewReader(tartest.Tarball(t, tt.files, tt.links, false)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadImageOS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			packages := got.Packages
+			got.Packages = nil
+			if got.Distro != tt.want.Distro || got.Version != tt.want.Version || got.Name != tt.want.Name || got.PackageManager != tt.want.PackageManager || got.PackagesUnknown != tt.want.PackagesUnknown {
+				t.Errorf("ReadImageOS() = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(packages, tt.packages) {
+				t.Errorf("ReadImageOS() packages = %v, want %v", packages, tt.packages)
+			}
+		})
+	}
+}
+
+func TestImagesOS(t *testing.T) {
+	assets := fstest.MapFS{
+		"k3s-images.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/klipper-helm:v0.8.3-build20240228\ndocker.io/rancher/mirrored-pause:3.6"),
+		},
+	}
+	filesystem := tartest.Tarball(t, map[string][]byte{
+		"etc/os-release":       []byte("ID=alpine\nVERSION_ID=3.20.1\n"),
+		"lib/apk/db/installed": []byte("P:libssl3\nV:3.3.1-r0\n"),
+	}, nil, false)
+	client := filesystemClient{filesystem: filesystem, failing: "mirrored-pause"}
+
+	inspector := NewReleaseInspector(assets, K3s, nil, nil, false)
+	results, err := inspector.ImagesOS(context.Background(), "v1.30.2+k3s1", client)
+	if err != nil {
+		t.Fatalf("ImagesOS() error = %v", err)
+	}
+
+	// every image for amd64, arm and arm64
+	if len(results) != 6 {
+		t.Fatalf("ImagesOS() returned %d results, want 6", len(results))
+	}
+	for i, result := range results {
+		failing := strings.Contains(result.Image, "mirrored-pause")
+		if failing != (result.Error != "") {
+			t.Errorf("%s %s error = %q", result.Image, result.Platform, result.Error)
+		}
+		if pkg, ok := result.Package("libssl3"); !failing && (result.Distro != "alpine" || !ok || pkg.Version != "3.3.1-r0") {
+			t.Errorf("%s %s = %+v", result.Image, result.Platform, result)
+		}
+		if i > 0 && results[i-1].Image > result.Image {
+			t.Errorf("ImagesOS() results aren't sorted by image")
+		}
+	}
+}
+
+func TestImagesOSReport(t *testing.T) {
+	results := []ImageOS{
+		{Image: "rancher/klipper-helm:v0.8.3-build20240228", Platform: "linux/amd64", Distro: "alpine", Version: "3.20.1", PackageManager: PackageManagerAPK, Packages: []Package{{Name: "libssl3", Version: "3.3.1-r0"}, {Name: "musl", Version: "1.2.5-r0"}}},
+		{Image: "rancher/mirrored-coredns-coredns:1.10.1", Platform: "linux/amd64"},
+		{Image: "rancher/mirrored-library-rhel:9.4", Platform: "linux/amd64", Distro: "rhel", Version: "9.4", PackageManager: PackageManagerRPM, PackagesUnknown: true},
+		{Image: "rancher/mirrored-pause:3.6", Platform: "linux/amd64", Error: "MANIFEST_UNKNOWN"},
+	}
+	inspector := NewReleaseInspector(nil, K3s, nil, nil, false)
+
+	tests := []struct {
+		name string
+		pkg  string
+		want [][]string
+	}{
+		{
+			name: "packages",
+			want: [][]string{
+				{"linux/amd64", "alpine", "3.20.1", "2 apk"},
+				{"linux/amd64", "-", "", "-"},
+				{"linux/amd64", "rhel", "9.4", "?"},
+				{"linux/amd64", "error", "error", "error"},
+			},
+		},
+		{
+			name: "package version",
+			pkg:  "libssl3",
+			want: [][]string{
+				{"linux/amd64", "alpine", "3.20.1", "3.3.1-r0"},
+				{"linux/amd64", "rhel", "9.4", "?"},
+				{"linux/amd64", "error", "error", "error"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := inspector.ImagesOSReport("v1.30.2+k3s1", results, tt.pkg)
+			if len(report.Images) != len(tt.want) {
+				t.Fatalf("ImagesOSReport() = %+v, want %d rows", report, len(tt.want))
+			}
+			for i, image := range report.Images {
+				var got []string
+				for _, check := range image.Checks {
+					got = append(got, symbol(check))
+				}
+				if !slices.Equal(got, tt.want[i]) {
+					t.Errorf("ImagesOSReport() row %d = %v, want %v", i, got, tt.want[i])
+				}
+			}
+			if errs := report.Images[len(report.Images)-1].Errors(); !slices.Equal(errs, []string{"linux/amd64: MANIFEST_UNKNOWN"}) {
+				t.Errorf("ImagesOSReport() errors = %v", errs)
+			}
+			if report.Incomplete() != 1 {
+				t.Errorf("ImagesOSReport() incomplete = %d, want 1", report.Incomplete())
+			}
+		})
+	}
+}
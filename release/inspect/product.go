@@ -0,0 +1,146 @@
+package inspect
+
+import (
+	"errors"
+	"strings"
+
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release/version"
+)
+
+var (
+	LinuxAmd64   = reg.Platform{OS: "linux", Architecture: "amd64"}
+	LinuxArm64   = reg.Platform{OS: "linux", Architecture: "arm64"}
+	LinuxArm     = reg.Platform{OS: "linux", Architecture: "arm"}
+	WindowsAmd64 = reg.Platform{OS: "windows", Architecture: "amd64"}
+)
+
+// ImageList is an image list asset of a release, and the platforms the
+// images it lists are expected to be published for.
+type ImageList struct {
+	Name      string
+	Platforms []reg.Platform
+	// WindowsBuilds is set if the images are expected for every Windows
+	// build the inspector checks.
+	WindowsBuilds bool
+}
+
+// WindowsBuild is a Windows Server release Windows images are built for,
+// and the os.version prefix of its manifests.
+type WindowsBuild struct {
+	Name      string
+	OSVersion string
+}
+
+// Platform returns the windows/amd64 platform of the build.
+func (b WindowsBuild) Platform() reg.Platform {
+	return reg.Platform{OS: WindowsAmd64.OS, Architecture: WindowsAmd64.Architecture, OSVersion: b.OSVersion}
+}
+
+// DefaultWindowsBuilds are the Windows Server LTSC releases supported by
+// rke2.
+var DefaultWindowsBuilds = []WindowsBuild{
+	{Name: "ltsc2019", OSVersion: "10.0.17763"},
+	{Name: "ltsc2022", OSVersion: "10.0.20348"},
+}
+
+// Product describes the GitHub repo a product is released from and the
+// image lists attached to its releases.
+type Product struct {
+	Name  string
+	Owner string
+	Repo  string
+	// Metadata is the prefix of the build metadata of the product versions,
+	// e.g. k3s for v1.30.2+k3s1. It's empty for products without one.
+	Metadata   string
+	ImageLists []ImageList
+}
+
+var (
+	RKE2 = Product{
+		Name:     "rke2",
+		Owner:    "rancher",
+		Repo:     "rke2",
+		Metadata: "rke2",
+		ImageLists: []ImageList{
+			{Name: "rke2-images-all.linux-amd64.txt", Platforms: []reg.Platform{LinuxAmd64}},
+			{Name: "rke2-images-all.linux-arm64.txt", Platforms: []reg.Platform{LinuxArm64}},
+			{Name: "rke2-images.windows-amd64.txt", Platforms: []reg.Platform{WindowsAmd64}, WindowsBuilds: true},
+		},
+	}
+	// K3s publishes a single image list for the airgap tarballs of every
+	// arch.
+	K3s = Product{
+		Name:     "k3s",
+		Owner:    "k3s-io",
+		Repo:     "k3s",
+		Metadata: "k3s",
+		ImageLists: []ImageList{
+			{Name: "k3s-images.txt", Platforms: []reg.Platform{LinuxAmd64, LinuxArm64, LinuxArm}},
+		},
+	}
+	Rancher = Product{
+		Name:       "rancher",
+		Owner:      "rancher",
+		Repo:       "rancher",
+		ImageLists: rancherImageLists,
+	}
+	// RancherPrime releases are published to their own repo, with the same
+	// image lists as the Rancher ones.
+	RancherPrime = Product{
+		Name:       "rancher-prime",
+		Owner:      "rancher",
+		Repo:       "rancher-prime",
+		ImageLists: rancherImageLists,
+	}
+
+	rancherImageLists = []ImageList{
+		{Name: "rancher-images.txt", Platforms: []reg.Platform{LinuxAmd64, LinuxArm64}},
+		{Name: "rancher-windows-images.txt", Platforms: []reg.Platform{WindowsAmd64}},
+	}
+)
+
+// ProductFor returns the product of a release from the build metadata of
+// its version, e.g. k3s for v1.30.2+k3s1, rke2 for v1.30.2+rke2r1 and
+// rancher for v2.9.2, which doesn't have any.
+func ProductFor(v string) (Product, error) {
+	parsed, err := version.Parse(v)
+	if err != nil {
+		return Product{}, err
+	}
+
+	for _, product := range []Product{RKE2, K3s, Rancher} {
+		if product.accepts(parsed) {
+			return product, nil
+		}
+	}
+
+	return Product{}, errors.New("unsupported release " + v + ": expected a k3s, rke2 or rancher version")
+}
+
+// accepts reports whether v is a version of the product.
+func (p Product) accepts(v version.Version) bool {
+	if p.Metadata == "" {
+		return v.Metadata.IsZero() && v.Major == 2
+	}
+	return strings.HasPrefix(v.Metadata.Label, p.Metadata)
+}
+
+// Platforms returns every platform the images of the product are expected
+// for, in the order of its image lists.
+func (p Product) Platforms() []reg.Platform {
+	var platforms []reg.Platform
+	seen := make(map[reg.Platform]bool)
+
+	for _, list := range p.ImageLists {
+		for _, platform := range list.Platforms {
+			if seen[platform] {
+				continue
+			}
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+
+	return platforms
+}
@@ -0,0 +1,387 @@
+package inspect
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusError   = "error"
+	StatusUnknown = "unknown"
+	StatusSkipped = "skipped"
+	StatusInfo    = "info"
+)
+
+// Check is the result of one of the checks of an image. Required checks
+// make the image incomplete if they fail or error, the others are only
+// reported. Info checks only report their detail, e.g. the Go version of a
+// binary.
+type Check struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Required bool   `json:"required"`
+}
+
+// Failed reports whether a required check failed or errored.
+func (c Check) Failed() bool {
+	return c.Required && (c.Status == StatusFailed || c.Status == StatusError)
+}
+
+// RegistryImage is the lookup of an image in a registry.
+type RegistryImage struct {
+	Exists bool   `json:"exists"`
+	Digest string `json:"digest,omitempty"`
+	// Platforms are the manifest digests of each platform of the image.
+	Platforms map[string]string `json:"platforms,omitempty"`
+	Signature string            `json:"signature,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// ImageReport is the result of the inspection of an image. Its checks are
+// in the order of the report columns. Error is set if the filesystem of the
+// image couldn't be scanned.
+type ImageReport struct {
+	Image  string         `json:"image"`
+	OSS    RegistryImage  `json:"oss"`
+	Prime  *RegistryImage `json:"prime,omitempty"`
+	Checks []Check        `json:"checks"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Complete reports whether none of the required checks of the image failed.
+func (i ImageReport) Complete() bool {
+	for _, check := range i.Checks {
+		if check.Failed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Errors returns the errors looking up the image, prefixed by the registry,
+// or scanning it.
+func (i ImageReport) Errors() []string {
+	var errs []string
+	if i.Error != "" {
+		errs = append(errs, i.Error)
+	}
+	if i.OSS.Error != "" {
+		errs = append(errs, "oss: "+i.OSS.Error)
+	}
+	if i.Prime != nil && i.Prime.Error != "" {
+		errs = append(errs, "prime: "+i.Prime.Error)
+	}
+	return errs
+}
+
+// Report is the result of the inspection of a release, rendered by the
+// formatters.
+type Report struct {
+	Product string        `json:"product"`
+	Version string        `json:"version"`
+	Columns []string      `json:"columns"`
+	Images  []ImageReport `json:"images"`
+}
+
+// Incomplete counts the images with a failed required check.
+func (r Report) Incomplete() int {
+	var incomplete int
+	for _, image := range r.Images {
+		if !image.Complete() {
+			incomplete++
+		}
+	}
+	return incomplete
+}
+
+// SetRequiredAttestations makes the images of the report incomplete if they
+// are missing one of the kinds of attestations.
+func (r *ReleaseInspector) SetRequiredAttestations(kinds []string) {
+	r.requiredAttestations = kinds
+}
+
+// Report builds the report of the images inspected for version. The images
+// are sorted by name, and checked for every platform of the product and
+// every Windows build any of them is expected for.
+func (r *ReleaseInspector) Report(version string, results []Image) Report {
+	platforms := r.product.Platforms()
+
+	var builds []WindowsBuild
+	for _, result := range results {
+		for _, build := range result.WindowsBuilds {
+			if !slices.Contains(builds, build) {
+				builds = append(builds, build)
+			}
+		}
+	}
+
+	report := Report{
+		Product: r.product.Name,
+		Version: version,
+		Columns: []string{"oss", "prime", "sig", "parity", reg.AttestationSBOM, reg.AttestationProvenance},
+	}
+	for _, platform := range platforms {
+		report.Columns = append(report.Columns, platformColumn(platform))
+	}
+	for _, build := range builds {
+		report.Columns = append(report.Columns, build.Name)
+	}
+
+	for _, result := range results {
+		image := ImageReport{
+			Image: result.Reference.Context().RepositoryStr() + ":" + result.Reference.Identifier(),
+			OSS:   registryImage(result.OSSImage, result.OSSErr),
+		}
+		if r.prime != nil {
+			prime := registryImage(result.PrimeImage, result.PrimeErr)
+			image.Prime = &prime
+		}
+
+		image.Checks = []Check{
+			existsCheck("oss", result.OSSImage, result.OSSErr),
+			r.primeExistsCheck(result),
+			r.signatureCheck(result),
+			r.parityCheck(result),
+			r.attestationCheck(result, reg.AttestationSBOM),
+			r.attestationCheck(result, reg.AttestationProvenance),
+		}
+		for _, platform := range platforms {
+			image.Checks = append(image.Checks, r.platformCheck(result, platform))
+		}
+		for _, build := range builds {
+			image.Checks = append(image.Checks, r.windowsBuildCheck(result, build))
+		}
+
+		report.Images = append(report.Images, image)
+	}
+
+	sort.Slice(report.Images, func(i, j int) bool {
+		return report.Images[i].Image < report.Images[j].Image
+	})
+
+	return report
+}
+
+func infoCheck(name, value string) Check {
+	return Check{Name: name, Status: StatusInfo, Detail: value}
+}
+
+// scanErrorReport is the report of a platform of an image whose filesystem
+// couldn't be read, the platform is the first of the columns and the others
+// are errors.
+func scanErrorReport(image, platform, err string, columns []string) ImageReport {
+	report := ImageReport{
+		Image:  image,
+		Error:  platform + ": " + err,
+		Checks: []Check{infoCheck(columns[0], platform)},
+	}
+	for _, column := range columns[1:] {
+		report.Checks = append(report.Checks, Check{Name: column, Status: StatusError, Detail: err, Required: true})
+	}
+	return report
+}
+
+// platformColumn is the column name of a platform, e.g. amd64 or win.
+func platformColumn(platform reg.Platform) string {
+	if platform.OS == "windows" {
+		return "win"
+	}
+	return platform.Architecture
+}
+
+func registryImage(img reg.Image, err error) RegistryImage {
+	ri := RegistryImage{
+		Exists:    img.Exists,
+		Digest:    img.Digest,
+		Signature: img.Signature.Status,
+	}
+	if err != nil {
+		ri.Error = err.Error()
+	}
+	if len(img.Platforms) > 0 {
+		ri.Platforms = make(map[string]string)
+		for platform := range img.Platforms {
+			ri.Platforms[platform.String()] = img.PlatformDigests[platform]
+		}
+	}
+	return ri
+}
+
+// existsCheck is an error if the image couldn't be looked up, instead of
+// reporting it as missing.
+func existsCheck(name string, img reg.Image, err error) Check {
+	check := Check{Name: name, Required: true}
+	switch {
+	case err != nil:
+		check.Status = StatusError
+		check.Detail = err.Error()
+	case img.Exists:
+		check.Status = StatusOK
+	default:
+		check.Status = StatusFailed
+	}
+	return check
+}
+
+// primeExistsCheck is skipped if there's no Prime registry.
+func (r *ReleaseInspector) primeExistsCheck(result Image) Check {
+	if r.prime == nil {
+		return Check{Name: "prime", Status: StatusSkipped}
+	}
+	return existsCheck("prime", result.PrimeImage, result.PrimeErr)
+}
+
+// lookupErr returns the error looking up the image in either registry.
+func lookupErr(result Image) error {
+	if result.OSSErr != nil {
+		return result.OSSErr
+	}
+	return result.PrimeErr
+}
+
+// found returns the copies of the image in the registries it exists in.
+func (r *ReleaseInspector) found(result Image) []reg.Image {
+	var images []reg.Image
+	if result.OSSImage.Exists {
+		images = append(images, result.OSSImage)
+	}
+	if r.prime != nil && result.PrimeImage.Exists {
+		images = append(images, result.PrimeImage)
+	}
+	return images
+}
+
+// signatureCheck combines the signature status of the image in the
+// registries it exists in: unknown if it wasn't verified, and failed if any
+// signature is invalid, couldn't be verified or is missing.
+func (r *ReleaseInspector) signatureCheck(result Image) Check {
+	check := Check{Name: "sig", Status: StatusUnknown}
+
+	var statuses []string
+	for _, img := range r.found(result) {
+		statuses = append(statuses, img.Signature.Status)
+	}
+
+	switch {
+	case len(statuses) == 0 || slices.Contains(statuses, ""):
+	case slices.Contains(statuses, reg.SignatureInvalid):
+		check.Status, check.Detail = StatusFailed, reg.SignatureInvalid
+	case slices.Contains(statuses, reg.SignatureError):
+		check.Status, check.Detail = StatusFailed, reg.SignatureError
+	case slices.Contains(statuses, reg.SignatureUnsigned):
+		check.Status, check.Detail = StatusFailed, reg.SignatureUnsigned
+	default:
+		check.Status = StatusOK
+	}
+	return check
+}
+
+// parityCheck compares the digests of the image in the OSS and Prime
+// registries, it's skipped unless the image exists in both.
+func (r *ReleaseInspector) parityCheck(result Image) Check {
+	check := Check{Name: "parity", Status: StatusSkipped}
+	if r.prime == nil || !result.OSSImage.Exists || !result.PrimeImage.Exists {
+		return check
+	}
+
+	if mismatches := reg.DigestMismatches(result.OSSImage, result.PrimeImage); len(mismatches) > 0 {
+		check.Status = StatusFailed
+		check.Detail = strings.Join(mismatches, ",")
+		return check
+	}
+	check.Status = StatusOK
+	return check
+}
+
+// attestationCheck is ok if the attestation of kind was found for every
+// expected platform of the image in the registries it exists in, and
+// unknown if the attestations weren't listed. The platforms without one are
+// the detail of a failure.
+func (r *ReleaseInspector) attestationCheck(result Image, kind string) Check {
+	check := Check{Name: kind, Status: StatusUnknown, Required: slices.Contains(r.requiredAttestations, kind)}
+
+	var missing []string
+	for _, img := range r.found(result) {
+		if img.Attestations == nil {
+			continue
+		}
+		check.Status = StatusOK
+		for _, platform := range result.Platforms {
+			if !img.Attestations[platform].Has(kind) && !slices.Contains(missing, platform.String()) {
+				missing = append(missing, platform.String())
+			}
+		}
+	}
+	if len(missing) > 0 {
+		check.Status = StatusFailed
+		check.Detail = strings.Join(missing, ",")
+	}
+	return check
+}
+
+// platformCheck reports whether the image is published for the platform in
+// every registry. Windows images are only checked for existence, their
+// builds are checked by windowsBuildCheck.
+func (r *ReleaseInspector) platformCheck(result Image, platform reg.Platform) Check {
+	check := Check{Name: platformColumn(platform), Required: true}
+
+	switch {
+	case !result.Expects(platform):
+		check.Status = StatusSkipped
+		check.Required = false
+	case lookupErr(result) != nil:
+		check.Status = StatusError
+		check.Detail = lookupErr(result).Error()
+	case r.hasPlatform(result, platform):
+		check.Status = StatusOK
+	default:
+		check.Status = StatusFailed
+	}
+	return check
+}
+
+func (r *ReleaseInspector) hasPlatform(result Image, platform reg.Platform) bool {
+	images := []reg.Image{result.OSSImage}
+	if r.prime != nil {
+		images = append(images, result.PrimeImage)
+	}
+
+	for _, img := range images {
+		if platform.OS == WindowsAmd64.OS && platform.OSVersion == "" {
+			if !img.Exists {
+				return false
+			}
+			continue
+		}
+		if !img.HasPlatform(platform) {
+			return false
+		}
+	}
+	return true
+}
+
+// windowsBuildCheck is skipped if the image isn't expected for the build, and
+// ok if every registry has a manifest for it.
+func (r *ReleaseInspector) windowsBuildCheck(result Image, build WindowsBuild) Check {
+	check := Check{Name: build.Name, Required: true}
+
+	switch {
+	case !slices.Contains(result.WindowsBuilds, build):
+		check.Status = StatusSkipped
+		check.Required = false
+	case lookupErr(result) != nil:
+		check.Status = StatusError
+		check.Detail = lookupErr(result).Error()
+	case r.hasPlatform(result, build.Platform()):
+		check.Status = StatusOK
+	default:
+		check.Status = StatusFailed
+	}
+	return check
+}
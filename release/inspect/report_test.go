@@ -0,0 +1,139 @@
+package inspect
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+// mapClient returns the images of a map, and missing images for the others.
+type mapClient map[string]reg.Image
+
+func (m mapClient) Image(_ context.Context, ref name.Reference) (reg.Image, error) {
+	return m[ref.Context().RepositoryStr()+":"+ref.Identifier()], nil
+}
+
+func TestAttestationCheck(t *testing.T) {
+	ref, err := name.ParseReference("rancher/rke2-runtime:v1.23.4-rke2r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := ReleaseImage{Reference: ref, Platforms: []reg.Platform{LinuxAmd64, LinuxArm64}}
+
+	tests := []struct {
+		name   string
+		oss    reg.Image
+		prime  reg.Image
+		want   string
+		detail string
+	}{
+		{
+			name: "not listed",
+			oss:  reg.Image{Exists: true},
+			want: StatusUnknown,
+		},
+		{
+			name: "every platform",
+			oss: reg.Image{Exists: true, Attestations: map[reg.Platform]reg.Attestations{
+				LinuxAmd64: {SBOM: true},
+				LinuxArm64: {SBOM: true},
+			}},
+			want: StatusOK,
+		},
+		{
+			name: "missing platform",
+			oss: reg.Image{Exists: true, Attestations: map[reg.Platform]reg.Attestations{
+				LinuxAmd64: {SBOM: true},
+			}},
+			want:   StatusFailed,
+			detail: "linux/arm64",
+		},
+		{
+			name: "missing in prime",
+			oss: reg.Image{Exists: true, Attestations: map[reg.Platform]reg.Attestations{
+				LinuxAmd64: {SBOM: true},
+				LinuxArm64: {SBOM: true},
+			}},
+			prime:  reg.Image{Exists: true, Attestations: map[reg.Platform]reg.Attestations{}},
+			want:   StatusFailed,
+			detail: "linux/amd64,linux/arm64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector := NewReleaseInspector(nil, RKE2, mapClient{}, mapClient{}, false)
+			inspector.SetRequiredAttestations([]string{reg.AttestationSBOM})
+
+			result := Image{ReleaseImage: release, OSSImage: tt.oss, PrimeImage: tt.prime}
+			check := inspector.attestationCheck(result, reg.AttestationSBOM)
+			if check.Status != tt.want || check.Detail != tt.detail {
+				t.Errorf("attestationCheck() = %s %q, want %s %q", check.Status, check.Detail, tt.want, tt.detail)
+			}
+			if check.Failed() != (tt.want == StatusFailed) {
+				t.Errorf("attestationCheck() failed = %v, want %v", check.Failed(), tt.want == StatusFailed)
+			}
+			if inspector.attestationCheck(result, reg.AttestationProvenance).Required {
+				t.Error("provenance attestation check is required")
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	images := mapClient{
+		"rancher/rke2-runtime:v1.23.4-rke2r1": {
+			Exists:    true,
+			Platforms: map[reg.Platform]bool{LinuxAmd64: true, LinuxArm64: true},
+			Signature: reg.Signature{Status: reg.SignatureUnsigned},
+		},
+		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
+			Exists:    true,
+			Platforms: map[reg.Platform]bool{LinuxAmd64: true},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		prime      RegistryClient
+		incomplete int
+	}{
+		// the windows image is missing
+		{name: "without prime", incomplete: 1},
+		{name: "with prime", prime: images, incomplete: 1},
+		{name: "missing in prime", prime: mapClient{}, incomplete: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector := NewReleaseInspector(newMockFS(), RKE2, images, tt.prime, false)
+
+			results, err := inspector.InspectRelease(context.Background(), "v1.23.4+rke2r1")
+			if err != nil {
+				t.Fatalf("InspectRelease() error = %v", err)
+			}
+			report := inspector.Report("v1.23.4+rke2r1", results)
+
+			if got := report.Incomplete(); got != tt.incomplete {
+				t.Errorf("Incomplete() = %d, want %d", got, tt.incomplete)
+			}
+			for _, image := range report.Images {
+				if len(image.Checks) != len(report.Columns) {
+					t.Errorf("%s has %d checks, want one per column %v", image.Image, len(image.Checks), report.Columns)
+				}
+				if (image.Prime != nil) != (tt.prime != nil) {
+					t.Errorf("%s prime = %v, want prime %v", image.Image, image.Prime, tt.prime != nil)
+				}
+			}
+
+			// unsigned images aren't incomplete
+			runtime := report.Images[len(report.Images)-1]
+			if runtime.Image != "rancher/rke2-runtime:v1.23.4-rke2r1" {
+				t.Fatalf("last image = %s, want the images sorted", runtime.Image)
+			}
+			if sig := runtime.Checks[2]; sig.Status != StatusFailed || sig.Detail != reg.SignatureUnsigned || sig.Failed() {
+				t.Errorf("runtime signature check = %+v, want an unsigned failure that isn't required", sig)
+			}
+		})
+	}
+}
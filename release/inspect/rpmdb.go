@@ -0,0 +1,120 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// rpm ndb databases, the Packages.db of SUSE images, are pages of 16 byte
+// slots indexing the blobs of the package headers.
+const (
+	ndbPageSize      = 4096
+	ndbSlotSize      = 16
+	ndbBlobAlignment = 16
+	ndbHeaderMagic   = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic     = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic     = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+)
+
+// readRPMNDB returns the packages of an rpm ndb database.
+func readRPMNDB(db []byte) ([]Package, error) {
+	if len(db) < ndbSlotSize || binary.LittleEndian.Uint32(db) != ndbHeaderMagic {
+		return nil, errors.New("not an rpm ndb database")
+	}
+	pages := int(binary.LittleEndian.Uint32(db[12:]))
+	if pages*ndbPageSize > len(db) {
+		return nil, errors.New("truncated rpm ndb database")
+	}
+
+	var packages []Package
+	// the first 2 slots hold the database header
+	for offset := 2 * ndbSlotSize; offset < pages*ndbPageSize; offset += ndbSlotSize {
+		slot := db[offset : offset+ndbSlotSize]
+		if binary.LittleEndian.Uint32(slot) != ndbSlotMagic {
+			return nil, errors.New("invalid rpm ndb slot at " + strconv.Itoa(offset))
+		}
+		if binary.LittleEndian.Uint32(slot[4:]) == 0 {
+			// free slot
+			continue
+		}
+
+		blob := int(binary.LittleEndian.Uint32(slot[8:])) * ndbBlobAlignment
+		if blob+16 > len(db) || binary.LittleEndian.Uint32(db[blob:]) != ndbBlobMagic {
+			return nil, errors.New("invalid rpm ndb blob at " + strconv.Itoa(blob))
+		}
+		length := int(binary.LittleEndian.Uint32(db[blob+12:]))
+		if blob+16+length > len(db) {
+			return nil, errors.New("truncated rpm ndb blob at " + strconv.Itoa(blob))
+		}
+
+		pkg, err := readRPMHeader(db[blob+16 : blob+16+length])
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+// readRPMHeader returns the name and epoch:version-release of the package
+// of an rpm header blob: the number of index entries and the length of the
+// data, the index entries and the data, big endian.
+func readRPMHeader(blob []byte) (Package, error) {
+	if len(blob) < 8 {
+		return Package{}, errors.New("truncated rpm header")
+	}
+	entries := int(binary.BigEndian.Uint32(blob))
+	dataLen := int(binary.BigEndian.Uint32(blob[4:]))
+	dataStart := 8 + entries*16
+	if dataStart+dataLen > len(blob) {
+		return Package{}, errors.New("truncated rpm header")
+	}
+	data := blob[dataStart : dataStart+dataLen]
+
+	values := make(map[uint32]string)
+	for i := 0; i < entries; i++ {
+		entry := blob[8+i*16:]
+		tag := binary.BigEndian.Uint32(entry)
+		kind := binary.BigEndian.Uint32(entry[4:])
+		offset := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+
+		switch {
+		case kind == rpmTypeString && (tag == rpmTagName || tag == rpmTagVersion || tag == rpmTagRelease):
+			value := data[offset:]
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+			values[tag] = string(value)
+		case kind == rpmTypeInt32 && tag == rpmTagEpoch && offset+4 <= len(data):
+			values[tag] = strconv.Itoa(int(binary.BigEndian.Uint32(data[offset:])))
+		}
+	}
+
+	if values[rpmTagName] == "" {
+		return Package{}, errors.New("rpm header without a name")
+	}
+
+	version := values[rpmTagVersion]
+	if release := values[rpmTagRelease]; release != "" {
+		version += "-" + release
+	}
+	if epoch := values[rpmTagEpoch]; epoch != "" && epoch != "0" {
+		version = epoch + ":" + version
+	}
+
+	return Package{Name: values[rpmTagName], Version: version}, nil
+}
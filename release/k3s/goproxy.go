@@ -0,0 +1,201 @@
+package k3s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v90/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// k3sKubernetesModule is the module of the k3s-io kubernetes fork, the
+// staging modules are nested under it.
+const k3sKubernetesModule = "github.com/k3s-io/kubernetes"
+
+// DefaultGoProxy is the proxy used when GOPROXY isn't set.
+const DefaultGoProxy = "https://proxy.golang.org"
+
+// ModuleCheck is the result of resolving a module version through a Go
+// module proxy.
+type ModuleCheck struct {
+	Path    string
+	Version string
+	Err     error
+}
+
+// GoProxy returns the first proxy URL in the GOPROXY environment variable,
+// or DefaultGoProxy if there isn't any.
+func GoProxy() string {
+	for _, proxy := range strings.FieldsFunc(os.Getenv("GOPROXY"), func(r rune) bool { return r == ',' || r == '|' }) {
+		if proxy != "direct" && proxy != "off" {
+			return proxy
+		}
+	}
+
+	return DefaultGoProxy
+}
+
+// CheckModuleProxy resolves the modules the k3s go.mod of the release branch
+// will reference once it's updated to the new kubernetes version, and
+// writes a report to w. An error is returned if any of them can't be
+// resolved, in which case go mod tidy would fail to update the references.
+func CheckModuleProxy(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, proxy string, w io.Writer) error {
+	fmt.Println("getting k3s go.mod from " + r.K3sRepoOwner + "/k3s@" + r.ReleaseBranch)
+	file, _, _, err := ghClient.Repositories.GetContents(ctx, r.K3sRepoOwner, "k3s", "go.mod", &github.RepositoryContentGetOptions{
+		Ref: r.ReleaseBranch,
+	})
+	if err != nil {
+		return errors.New("failed to get k3s go.mod: " + err.Error())
+	}
+	goMod, err := file.GetContent()
+	if err != nil {
+		return err
+	}
+
+	mods, err := referencedModules([]byte(goMod), r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("resolving %d modules through %s\n", len(mods), proxy)
+	client := &http.Client{Timeout: 30 * time.Second}
+	checks := resolveModules(ctx, client, proxy, mods)
+
+	return printModuleChecks(w, checks)
+}
+
+// referencedModules returns the modules which will be downloaded for the
+// go.mod updated by updateGoMod: the replacements and the requirements
+// which aren't replaced whose version it changes.
+func referencedModules(goMod []byte, r *ecmConfig.K3sRelease) ([]module.Version, error) {
+	f, err := modfile.Parse("go.mod", goMod, nil)
+	if err != nil {
+		return nil, errors.New("failed to parse go.mod: " + err.Error())
+	}
+	b, err := updateGoMod(goMod, r)
+	if err != nil {
+		return nil, errors.New("failed to update go.mod: " + err.Error())
+	}
+	updated, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		return nil, errors.New("failed to parse updated go.mod: " + err.Error())
+	}
+
+	current := make(map[module.Version]bool)
+	for _, replace := range f.Replace {
+		current[replace.New] = true
+	}
+	for _, require := range f.Require {
+		current[require.Mod] = true
+	}
+
+	var mods []module.Version
+	replaced := make(map[string]bool)
+
+	for _, replace := range updated.Replace {
+		replaced[replace.Old.Path] = true
+
+		// replacements with a local directory don't have a version
+		if replace.New.Version == "" || current[replace.New] {
+			continue
+		}
+		mods = append(mods, replace.New)
+	}
+
+	for _, require := range updated.Require {
+		if replaced[require.Mod.Path] || current[require.Mod] {
+			continue
+		}
+		mods = append(mods, require.Mod)
+	}
+
+	return mods, nil
+}
+
+// resolveModules requests the .info of each module version from the proxy.
+func resolveModules(ctx context.Context, client *http.Client, proxy string, mods []module.Version) []ModuleCheck {
+	proxy = strings.TrimSuffix(proxy, "/")
+
+	checks := make([]ModuleCheck, len(mods))
+	for i, mod := range mods {
+		checks[i] = ModuleCheck{Path: mod.Path, Version: mod.Version, Err: resolveModule(ctx, client, proxy, mod)}
+	}
+
+	return checks
+}
+
+func resolveModule(ctx context.Context, client *http.Client, proxy string, mod module.Version) error {
+	path, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return err
+	}
+	version, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, proxy+"/"+path+"/@v/"+version+".info", nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return errors.New(res.Status + ": " + strings.TrimSpace(string(body)))
+	}
+
+	var info struct {
+		Version string
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return errors.New("invalid info response: " + err.Error())
+	}
+	if info.Version != mod.Version {
+		return errors.New("resolved to " + info.Version)
+	}
+
+	return nil
+}
+
+func printModuleChecks(w io.Writer, checks []ModuleCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "module\tversion\terror")
+	fmt.Fprintln(tw, "------\t-------\t-----")
+
+	var failed int
+	for _, check := range checks {
+		var errMsg string
+		if check.Err != nil {
+			failed++
+			errMsg = check.Err.Error()
+		}
+		tw.Write([]byte(strings.Join([]string{check.Path, check.Version, errMsg}, "\t") + "\n"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(checks)) + " modules can't be resolved through the module proxy")
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package k3s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"golang.org/x/mod/module"
+)
+
+func TestReferencedModules(t *testing.T) {
+	const goMod = `module github.com/k3s-io/k3s
+
+go 1.22
+
+require (
+	github.com/spf13/pflag v1.0.5
+	k8s.io/api v0.30.1
+	k8s.io/kube-openapi v0.30.1
+	k8s.io/kubernetes v1.30.1
+)
+
+replace (
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.1-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.1-k3s1
+	github.com/spf13/pflag => github.com/spf13/pflag v1.0.6
+)
+`
+	r := &ecmConfig.K3sRelease{
+		OldK8sVersion: "v1.30.1",
+		NewK8sVersion: "v1.30.2",
+		OldSuffix:     "k3s1",
+		NewSuffix:     "k3s1",
+		OldK8sClient:  "v0.30.1",
+		NewK8sClient:  "v0.30.2",
+	}
+
+	got, err := referencedModules([]byte(goMod), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []module.Version{
+		{Path: "github.com/k3s-io/kubernetes/staging/src/k8s.io/api", Version: "v1.30.2-k3s1"},
+		{Path: "github.com/k3s-io/kubernetes", Version: "v1.30.2-k3s1"},
+		{Path: "k8s.io/kube-openapi", Version: "v0.30.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("referencedModules() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveModules(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/github.com/k3s-io/kubernetes/@v/v1.30.2-k3s1.info":
+			w.Write([]byte(`{"Version":"v1.30.2-k3s1","Time":"2024-06-12T00:00:00Z"}`))
+		case "/github.com/!burnt!sushi/toml/@v/v1.3.2.info":
+			w.Write([]byte(`{"Version":"v1.3.2","Time":"2024-06-12T00:00:00Z"}`))
+		default:
+			http.Error(w, "not found: unknown revision", http.StatusNotFound)
+		}
+	}))
+	defer proxy.Close()
+
+	mods := []module.Version{
+		{Path: "github.com/k3s-io/kubernetes", Version: "v1.30.2-k3s1"},
+		{Path: "github.com/BurntSushi/toml", Version: "v1.3.2"},
+		{Path: "github.com/k3s-io/kubernetes/staging/src/k8s.io/api", Version: "v1.30.2-k3s1"},
+	}
+
+	checks := resolveModules(context.Background(), proxy.Client(), proxy.URL+"/", mods)
+
+	for i, wantErr := range []bool{false, false, true} {
+		if (checks[i].Err != nil) != wantErr {
+			t.Errorf("%s@%s: error = %v, wantErr %v", checks[i].Path, checks[i].Version, checks[i].Err, wantErr)
+		}
+	}
+}
@@ -10,19 +10,16 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"text/template"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/google/go-github/v90/github"
 	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
 	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
-	ssh2 "golang.org/x/crypto/ssh"
 )
 
 const (
@@ -43,61 +40,17 @@ ARG UID=1000
 ARG GID=1000
 RUN addgroup -S -g $GID ecmgroup && adduser -S -G ecmgroup -u $UID user
 USER user`
-	updateK3sScriptName       = "update_k3s_references.sh"
-	updateK3sReferencesScript = `#!/bin/bash
-set -ex
-OS=$(uname -s)
-DRY_RUN={{ .K3s.DryRun }}
-BRANCH_NAME={{ .K3s.NewK8sVersion }}-{{ .K3s.NewSuffix }}
-cd {{ .K3s.Workspace }}
-# using ls | grep is not a good idea because it doesn't support non-alphanumeric filenames, but since we're only ever checking 'k3s' it isn't a problem https://www.shellcheck.net/wiki/SC2010
-ls | grep -w k3s || git clone "git@github.com:{{ .User.GithubUsername }}/k3s.git"
-cd {{ .K3s.Workspace }}/k3s
-git remote -v | grep -w upstream || git remote add upstream {{ .K3s.K3sUpstreamURL }}
-git fetch upstream
-git stash
-git branch -D "${BRANCH_NAME}" &>/dev/null || true
-git checkout -B "${BRANCH_NAME}" upstream/{{.K3s.ReleaseBranch}}
-git clean -xfd
-
-case ${OS} in
-Darwin)
-	sed -Ei '' "\|github.com/k3s-io/kubernetes| s|{{ replaceAll .K3s.OldK8sVersion "." "\\." }}-{{ .K3s.OldSuffix }}|{{ replaceAll .K3s.NewK8sVersion "." "\\." }}-{{ .K3s.NewSuffix }}|" go.mod
-	sed -Ei '' "s/k8s.io\/kubernetes v\S+/k8s.io\/kubernetes {{ replaceAll .K3s.NewK8sVersion "." "\\." }}/" go.mod
-	sed -Ei '' "s/{{ replaceAll .K3s.OldK8sClient "." "\\." }}/{{ replaceAll .K3s.NewK8sClient "." "\\." }}/g" go.mod # This should only change ~6 lines in go.mod
-	sed -Ei '' "s/golang:.*-/golang:{{ .K3s.NewGoVersion }}-/g" Dockerfile.*
-	sed -Ei '' "s/go-version:.*$/go-version:\ '{{ .K3s.NewGoVersion }}'/g" .github/workflows/integration.yaml .github/workflows/unitcoverage.yaml
-	;;
-Linux)
-	sed -Ei "\|github.com/k3s-io/kubernetes| s|{{ replaceAll .K3s.OldK8sVersion "." "\\." }}-{{ .K3s.OldSuffix }}|{{ replaceAll .K3s.NewK8sVersion "." "\\." }}-{{ .K3s.NewSuffix }}|" go.mod
-	sed -Ei "s/k8s.io\/kubernetes v\S+/k8s.io\/kubernetes {{ replaceAll .K3s.NewK8sVersion "." "\\." }}/" go.mod
-	sed -Ei "s/{{ replaceAll .K3s.OldK8sClient "." "\\." }}/{{ replaceAll .K3s.NewK8sClient "." "\\." }}/g" go.mod # This should only change ~6 lines in go.mod
-	sed -Ei "s/golang:.*-/golang:{{ .K3s.NewGoVersion }}-/g" Dockerfile.*
-	sed -Ei "s/go-version:.*$/go-version:\ '{{ .K3s.NewGoVersion }}'/g" .github/workflows/integration.yaml .github/workflows/unitcoverage.yaml
-	;;
-*)
-	>&2 echo "$(OS) not supported yet"
-	exit 1
-	;;
-esac
-
-go mod tidy
-
-git add go.mod go.sum Dockerfile.* .github/workflows/integration.yaml .github/workflows/unitcoverage.yaml
-	git commit --signoff -m "Update to {{ .K3s.NewK8sVersion }}"
-if [ "${DRY_RUN}" = false ]; then
-	git push --set-upstream origin "${BRANCH_NAME}" # run git remote -v for your origin
-fi`
 )
 
-type UpdateScriptVars struct {
-	K3s  *ecmConfig.K3sRelease
-	User *ecmConfig.User
-}
-
 // GenerateTags will clone the kubernetes repository, rebase it with the k3s-io fork and
-// generate tags to be pushed
-func GenerateTags(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath string) error {
+// generate tags to be pushed. The rebase and tags are done with go-git unless
+// useDocker is set, in which case git rebase and tag.sh in a Go container are
+// used instead.
+func GenerateTags(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath string, useDocker bool) error {
+	if err := rebaseInProgress(r); err != nil {
+		return err
+	}
+
 	fmt.Println("setting up k8s remotes")
 	if err := setupK8sRemotes(r, u, sshKeyPath); err != nil {
 		return errors.New("failed to clone and setup remotes for k8s repos: " + err.Error())
@@ -113,7 +66,12 @@ func GenerateTags(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3s
 
 	fmt.Println("rebasing and tagging")
 
-	tags, err := rebaseAndTag(ctx, ghClient, r, u)
+	var tags []Tag
+	if useDocker {
+		tags, err = rebaseAndTag(ctx, ghClient, r, u)
+	} else {
+		tags, err = nativeRebaseAndTag(ctx, ghClient, r, u)
+	}
 	if err != nil {
 		return errors.New("failed to rebase and tag: " + err.Error())
 	}
@@ -122,11 +80,6 @@ func GenerateTags(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3s
 	return writeTagsFile(r, tags)
 }
 
-func writeTagsFile(r *ecmConfig.K3sRelease, tags []string) error {
-	tagFile := filepath.Join(r.Workspace, "tags-"+r.NewK8sVersion)
-	return os.WriteFile(tagFile, []byte(strings.Join(tags, "\n")), 0o644)
-}
-
 // setupK8sRemotes will clone the kubernetes upstream repo and proceed with setting up remotes
 // for rancher and user's forks, then it will fetch branches and tags for all remotes
 func setupK8sRemotes(r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath string) error {
@@ -155,7 +108,7 @@ func setupK8sRemotes(r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath stri
 	}
 
 	fmt.Println("getting ssh auth")
-	gitAuth, err := getAuth(sshKeyPath)
+	gitAuth, err := release.GitSSHAuth(sshKeyPath)
 	if err != nil {
 		return err
 	}
@@ -219,12 +172,19 @@ func setupK8sRemotes(r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath stri
 	return nil
 }
 
-func rebaseAndTag(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) ([]string, error) {
+func rebaseAndTag(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) ([]Tag, error) {
 	rebaseOut, err := gitRebaseOnto(ctx, ghClient, r)
 	if err != nil {
-		return nil, err
+		return nil, dockerRebaseError(r, err)
 	}
 	fmt.Println(rebaseOut)
+
+	return dockerTag(r, u)
+}
+
+// dockerTag runs tag.sh in a Go container on the rebased kubernetes clone
+// and looks up the tags it created.
+func dockerTag(r *ecmConfig.K3sRelease, u *ecmConfig.User) ([]Tag, error) {
 	wrapperImageTag, err := buildGoWrapper(r)
 	if err != nil {
 		return nil, err
@@ -246,37 +206,11 @@ func rebaseAndTag(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3s
 			return nil, err
 		}
 	}
-	out, err := runTagScript(r, gitconfigFile, wrapperImageTag)
-	if err != nil {
-		return nil, err
-	}
-
-	tags := tagPushLines(out)
-	if len(tags) == 0 {
-		return nil, errors.New("failed to extract tag push lines")
-	}
-
-	return tags, nil
-}
-
-// getAuth is a utility function which is used to get the ssh authentication method for connecting to an ssh server.
-// the function takes a single parameter, privateKey, which is a string representing the path to a private key file.
-// If the privateKey is an empty string, the function uses the default private key located at $HOME/.ssh/id_rsa.
-// The function then creates a new ssh.AuthMethod using the ssh.NewPublicKeysFromFile function, passing in the "git" user, the privateKey path, and an empty password.
-// If this returns an error, the function returns nil and the error.
-// Finally, the function returns the publicKeys variable, which is now an ssh.AuthMethod, and a nil error.
-func getAuth(privateKey string) (ssh.AuthMethod, error) {
-	if privateKey == "" {
-		privateKey = os.Getenv("HOME") + "/.ssh/id_rsa"
-	}
-
-	publicKeys, err := ssh.NewPublicKeysFromFile("git", privateKey, "")
-	if err != nil {
+	if _, err := runTagScript(r, gitconfigFile, wrapperImageTag); err != nil {
 		return nil, err
 	}
-	publicKeys.HostKeyCallback = ssh2.InsecureIgnoreHostKey()
 
-	return publicKeys, nil
+	return resolveTags(filepath.Join(r.Workspace, "kubernetes"), r.NewK8sVersion+"-"+r.NewSuffix)
 }
 
 func gitRebaseOnto(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease) (string, error) {
@@ -343,12 +277,11 @@ func goVersion(r *ecmConfig.K3sRelease) (string, error) {
 		return "", err
 	}
 	verStr := strings.TrimSpace(string(dat))
-	ver, err := semver.NewVersion(verStr)
-	if err != nil {
+	if _, err := version.Parse(verStr); err != nil {
 		return "", errors.New("invalid '.go-version' content: " + verStr)
 	}
 
-	return ver.String(), nil
+	return verStr, nil
 }
 
 func buildGoWrapper(r *ecmConfig.K3sRelease) (string, error) {
@@ -435,43 +368,8 @@ func runTagScript(r *ecmConfig.K3sRelease, gitConfigFile, wrapperImageTag string
 	return ecmExec.RunCommand(k8sDir, "docker", args...)
 }
 
-func tagPushLines(out string) []string {
-	var tagCmds []string
-
-	fmt.Println("getting git push lines")
-	for _, line := range strings.Split(out, "\n") {
-		if strings.Contains(line, "git push $REMOTE") {
-			tagCmds = append(tagCmds, line)
-		}
-	}
-
-	return tagCmds
-}
-
-func tagsCmdsFromFile(r *ecmConfig.K3sRelease) ([]string, error) {
-	var tagCmds []string
-
-	tagFile := filepath.Join(r.Workspace, "tags-"+r.NewK8sVersion)
-	if _, err := os.Stat(tagFile); err != nil {
-		return nil, err
-	}
-
-	dat, err := os.ReadFile(tagFile)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, line := range strings.Split(string(dat), "\n") {
-		if strings.Contains(line, "git push $REMOTE") {
-			tagCmds = append(tagCmds, line)
-		}
-	}
-
-	return tagCmds, nil
-}
-
 func PushTags(ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath string) error {
-	tagsCmds, err := tagsCmdsFromFile(r)
+	tags, err := tagsFromFile(r)
 	if err != nil {
 		return errors.New("failed to extract tags from file: " + err.Error())
 	}
@@ -528,17 +426,16 @@ func PushTags(ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.Use
 	}
 
 	fmt.Println("getting ssh key auth")
-	gitAuth, err := getAuth(sshKeyPath)
+	gitAuth, err := release.GitSSHAuth(sshKeyPath)
 	if err != nil {
 		return err
 	}
 
 	fmt.Println("pushing tags")
-	for i, tagCmd := range tagsCmds {
-		tagCmdStr := tagCmd
-		tag := strings.Split(tagCmdStr, " ")[3]
+	for i, t := range tags {
+		tag := t.Name
 
-		fmt.Printf("pushing tag %d/%d: %s\n", i+1, len(tagsCmds), tag)
+		fmt.Printf("pushing tag %d/%d: %s\n", i+1, len(tags), tag)
 
 		if r.DryRun {
 			fmt.Printf("\ndry run, skipping tag creation\n")
@@ -562,8 +459,18 @@ func PushTags(ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.Use
 	return nil
 }
 
-func UpdateK3sReferences(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
-	if err := updateK3sReferencesAndPush(r, u); err != nil {
+// UpdateK3sReferences updates the k8s and Go references of the k3s release
+// branch and opens a PR. If goProxy is set, the new module references are
+// resolved through it first so an unresolvable tag is reported before any
+// change is made.
+func UpdateK3sReferences(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath, goProxy string) error {
+	if goProxy != "" {
+		if err := CheckModuleProxy(ctx, ghClient, r, goProxy, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if err := updateK3sReferencesAndPush(r, u, sshKeyPath); err != nil {
 		return err
 	}
 
@@ -575,30 +482,6 @@ func UpdateK3sReferences(ctx context.Context, ghClient *github.Client, r *ecmCon
 	return createK3sReferencesPR(ctx, ghClient, r, u)
 }
 
-func updateK3sReferencesAndPush(r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
-	if err := release.SetWorkspace(r.Workspace); err != nil {
-		return err
-	}
-
-	fmt.Println("getting k8s go version")
-
-	goVersion, err := goVersion(r)
-	if err != nil {
-		return err
-	}
-	r.NewGoVersion = goVersion
-
-	funcMap := template.FuncMap{"replaceAll": strings.ReplaceAll}
-	fmt.Println("creating update k3s references script template")
-	scriptVars := UpdateScriptVars{K3s: r, User: u}
-	updateScriptOut, err := ecmExec.RunTemplatedScript(r.Workspace, updateK3sScriptName, updateK3sReferencesScript, funcMap, scriptVars)
-	if err != nil {
-		return err
-	}
-	fmt.Println(updateScriptOut)
-	return nil
-}
-
 func createK3sReferencesPR(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
 	const repo = "k3s"
 
@@ -717,36 +600,15 @@ func cleanGitRepo(dir string) error {
 
 func CreateRelease(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease, opts *repository.CreateReleaseOpts, releaseNotesAlert string, rc bool) error {
 	fmt.Println("validating tag")
-	_, err := semver.NewVersion(opts.Tag)
-	if err != nil {
+	if _, err := version.Parse(opts.Tag); err != nil {
 		return errors.New("tag isn't a valid semver: " + opts.Tag)
 	}
 
-	name := r.NewK8sVersion + "+" + r.NewSuffix
-	oldName := r.OldK8sVersion + "+" + r.OldSuffix
-
-	latestRC, err := release.LatestRC(ctx, opts.Owner, opts.Repo, r.NewK8sVersion, r.NewSuffix, client)
+	name, latestRC, err := release.NextTag(ctx, client, opts.Owner, opts.Repo, r.NewK8sVersion, version.Distro(r.NewSuffix), rc)
 	if err != nil {
 		return err
 	}
-	if latestRC == nil && !rc {
-		return errors.New("couldn't find the latest RC")
-	}
-	if rc {
-		latestRCNumber := 1
-		if latestRC != nil {
-			trimmedRCNumber, _, found := strings.Cut(strings.TrimPrefix(*latestRC, r.NewK8sVersion+"-rc"), "+k3s")
-			if !found {
-				return errors.New("failed to parse rc number from " + *latestRC)
-			}
-			currentRCNumber, err := strconv.Atoi(trimmedRCNumber)
-			if err != nil {
-				return err
-			}
-			latestRCNumber = currentRCNumber + 1
-		}
-		name = r.NewK8sVersion + "-rc" + strconv.Itoa(latestRCNumber) + "+" + r.NewSuffix
-	}
+	oldName := r.OldK8sVersion + "+" + r.OldSuffix
 
 	opts.Name = name
 	opts.Tag = name
@@ -757,7 +619,7 @@ func CreateRelease(ctx context.Context, client *github.Client, r *ecmConfig.K3sR
 	fmt.Printf("create release options: %+v\n", *opts)
 
 	if !rc && opts.Repo == "k3s" {
-		buff, err := release.GenReleaseNotes(ctx, opts.Owner, opts.Repo, *latestRC, oldName, releaseNotesAlert, client)
+		buff, err := release.GenReleaseNotes(ctx, opts.Owner, opts.Repo, latestRC.String(), oldName, releaseNotesAlert, client)
 		if err != nil {
 			return err
 		}
@@ -777,36 +639,17 @@ func CreateRelease(ctx context.Context, client *github.Client, r *ecmConfig.K3sR
 	return nil
 }
 
-func CreateRef(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease, opts *repository.CreateRefOpts, rc bool) error {
+// CreateRef tags the next RC or the GA of a k3s release and returns the
+// created reference, or nil on a dry run.
+func CreateRef(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease, opts *repository.CreateRefOpts, rc bool) (*github.Reference, error) {
 	fmt.Println("validating tag")
-	_, err := semver.NewVersion(opts.Tag)
-	if err != nil {
-		return errors.New("tag isn't a valid semver: " + opts.Tag)
+	if _, err := version.Parse(opts.Tag); err != nil {
+		return nil, errors.New("tag isn't a valid semver: " + opts.Tag)
 	}
 
-	name := r.NewK8sVersion + "+" + r.NewSuffix
-
-	latestRC, err := release.LatestRC(ctx, opts.Owner, opts.Repo, r.NewK8sVersion, r.NewSuffix, client)
+	name, _, err := release.NextTag(ctx, client, opts.Owner, opts.Repo, r.NewK8sVersion, version.Distro(r.NewSuffix), rc)
 	if err != nil {
-		return err
-	}
-	if latestRC == nil && !rc {
-		return errors.New("couldn't find the latest RC")
-	}
-	if rc {
-		latestRCNumber := 1
-		if latestRC != nil {
-			trimmedRCNumber, _, found := strings.Cut(strings.TrimPrefix(*latestRC, r.NewK8sVersion+"-rc"), "+k3s")
-			if !found {
-				return errors.New("failed to parse rc number from " + *latestRC)
-			}
-			currentRCNumber, err := strconv.Atoi(trimmedRCNumber)
-			if err != nil {
-				return err
-			}
-			latestRCNumber = currentRCNumber + 1
-		}
-		name = r.NewK8sVersion + "-rc" + strconv.Itoa(latestRCNumber) + "+" + r.NewSuffix
+		return nil, err
 	}
 
 	opts.Tag = name
@@ -815,13 +658,13 @@ func CreateRef(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelea
 
 	if r.DryRun {
 		fmt.Println("dry run, skipping creating tag")
-		return nil
+		return nil, nil
 	}
 	createdRef, err := repository.CreateRef(ctx, client, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Println("ref created: " + *createdRef.URL)
-	return nil
+	return createdRef, nil
 }
@@ -0,0 +1,160 @@
+package k3s
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// hunk is a change of one side of a merge: the lines [o1, o2) of the base
+// are replaced by the lines [s1, s2) of the side.
+type hunk struct {
+	side   int
+	o1, o2 int
+	s1, s2 int
+}
+
+// splitLines splits content in lines keeping their line endings, so the
+// last line may not end with one.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffHunks returns the changes between base and side.
+func diffHunks(base, side []string, n int) []hunk {
+	m := difflib.NewMatcherWithJunk(base, side, false, nil)
+
+	var hunks []hunk
+	for _, op := range m.GetOpCodes() {
+		if op.Tag == 'e' {
+			continue
+		}
+		hunks = append(hunks, hunk{side: n, o1: op.I1, o2: op.I2, s1: op.J1, s2: op.J2})
+	}
+	return hunks
+}
+
+// merge3 merges the changes from base to ours and from base to theirs line
+// by line, the same as git's diff3 merge. Changes of both sides that overlap
+// or touch each other conflict unless they're identical, conflicts are
+// written with ours and theirs between markers, theirs labeled with label.
+// It reports whether there was any conflict.
+func merge3(base, ours, theirs []byte, label string) ([]byte, bool) {
+	o := splitLines(base)
+	sides := [2][]string{splitLines(ours), splitLines(theirs)}
+
+	hunks := append(diffHunks(o, sides[0], 0), diffHunks(o, sides[1], 1)...)
+	sort.SliceStable(hunks, func(i, j int) bool {
+		return hunks[i].o1 < hunks[j].o1
+	})
+
+	var b bytes.Buffer
+	var conflict bool
+
+	pos := 0
+	for i := 0; i < len(hunks); {
+		// group the hunks overlapping or touching the first one, adjacent
+		// changes conflict the same as with git
+		start, end := hunks[i].o1, hunks[i].o2
+		j := i + 1
+		for j < len(hunks) && hunks[j].o1 <= end {
+			end = max(end, hunks[j].o2)
+			j++
+		}
+		region := hunks[i:j]
+		i = j
+
+		writeLines(&b, o[pos:start])
+		pos = end
+
+		var changed [2]bool
+		for _, h := range region {
+			changed[h.side] = true
+		}
+		content := [2][]string{
+			regionLines(o, sides[0], region, 0, start, end),
+			regionLines(o, sides[1], region, 1, start, end),
+		}
+
+		switch {
+		case !changed[1]:
+			writeLines(&b, content[0])
+		case !changed[0]:
+			writeLines(&b, content[1])
+		case slices.Equal(content[0], content[1]):
+			writeLines(&b, content[0])
+		default:
+			conflict = true
+			writeConflictLines(&b, content[0], content[1], label)
+		}
+	}
+	writeLines(&b, o[pos:])
+
+	return b.Bytes(), conflict
+}
+
+// regionLines returns the lines [start, end) of base with the hunks of side
+// n applied.
+func regionLines(base, side []string, region []hunk, n, start, end int) []string {
+	var lines []string
+
+	pos := start
+	for _, h := range region {
+		if h.side != n {
+			continue
+		}
+		lines = append(lines, base[pos:h.o1]...)
+		lines = append(lines, side[h.s1:h.s2]...)
+		pos = h.o2
+	}
+	return append(lines, base[pos:end]...)
+}
+
+// writeConflictLines writes the lines that differ between ours and theirs
+// between conflict markers, their common leading and trailing lines are
+// written as is.
+func writeConflictLines(b *bytes.Buffer, ours, theirs []string, label string) {
+	prefix := 0
+	for prefix < len(ours) && prefix < len(theirs) && ours[prefix] == theirs[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ours)-prefix && suffix < len(theirs)-prefix && ours[len(ours)-1-suffix] == theirs[len(theirs)-1-suffix] {
+		suffix++
+	}
+
+	writeLines(b, ours[:prefix])
+	b.WriteString(conflictMarker + "HEAD\n")
+	writeLines(b, ours[prefix:len(ours)-suffix])
+	terminateLine(b)
+	b.WriteString("=======\n")
+	writeLines(b, theirs[prefix:len(theirs)-suffix])
+	terminateLine(b)
+	b.WriteString(">>>>>>> " + label + "\n")
+	writeLines(b, ours[len(ours)-suffix:])
+}
+
+func writeLines(b *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+}
+
+// terminateLine ends the last line written to b if it doesn't end with a
+// line ending, so a marker doesn't get appended to it.
+func terminateLine(b *bytes.Buffer) {
+	if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteByte('\n')
+	}
+}
@@ -0,0 +1,89 @@
+package k3s
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	const base = "a\nb\nc\nd\ne\nf\n"
+
+	tests := []struct {
+		name         string
+		base         string
+		ours         string
+		theirs       string
+		want         string
+		wantConflict bool
+	}{
+		{
+			name:   "changes on different lines",
+			base:   base,
+			ours:   "a\nB\nc\nd\ne\nf\n",
+			theirs: "a\nb\nc\nd\nE\nf\n",
+			want:   "a\nB\nc\nd\nE\nf\n",
+		},
+		{
+			name:   "only theirs changed",
+			base:   base,
+			ours:   base,
+			theirs: "a\nb\nc\nd\ne\nf\ng\n",
+			want:   "a\nb\nc\nd\ne\nf\ng\n",
+		},
+		{
+			name:   "same change on both sides",
+			base:   base,
+			ours:   "a\nb\nC\nd\ne\nf\n",
+			theirs: "a\nb\nC\nd\ne\nf\n",
+			want:   "a\nb\nC\nd\ne\nf\n",
+		},
+		{
+			name:         "changes on the same line",
+			base:         base,
+			ours:         "a\nb\nours\nd\ne\nf\n",
+			theirs:       "a\nb\ntheirs\nd\ne\nf\n",
+			want:         "a\nb\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> abc (fix)\nd\ne\nf\n",
+			wantConflict: true,
+		},
+		{
+			name:         "changes on adjacent lines",
+			base:         base,
+			ours:         "a\nb\nc\nD\ne\nf\n",
+			theirs:       "a\nb\nC\nd\ne\nf\n",
+			want:         "a\nb\n<<<<<<< HEAD\nc\nD\n=======\nC\nd\n>>>>>>> abc (fix)\ne\nf\n",
+			wantConflict: true,
+		},
+		{
+			name:         "repeated context",
+			base:         "x\ny\nz\nx\ny\nz\n",
+			ours:         "x\nY\nz\nx\ny\nz\n",
+			theirs:       "x\nT\nz\nx\ny\nz\n",
+			want:         "x\n<<<<<<< HEAD\nY\n=======\nT\n>>>>>>> abc (fix)\nz\nx\ny\nz\n",
+			wantConflict: true,
+		},
+		{
+			name:         "missing trailing newline",
+			base:         "a\nb",
+			ours:         "A\nb",
+			theirs:       "a\nB",
+			want:         "<<<<<<< HEAD\nA\nb\n=======\na\nB\n>>>>>>> abc (fix)\n",
+			wantConflict: true,
+		},
+		{
+			name:   "file created on both sides",
+			base:   "",
+			ours:   "a\n",
+			theirs: "a\n",
+			want:   "a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := merge3([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), "abc (fix)")
+			if conflict != tt.wantConflict {
+				t.Errorf("merge3() conflict = %v, want %v", conflict, tt.wantConflict)
+			}
+			if string(got) != tt.want {
+				t.Errorf("merge3() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package k3s
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	ecmExec "github.com/rancher/ecm-distro-tools/exec"
+)
+
+const conflictMarker = "<<<<<<< "
+
+// rebaseState is saved in the workspace when a rebase stops on a conflict,
+// so it can be continued or aborted by a later run.
+type rebaseState struct {
+	// Docker is set when the rebase was run with git, which then keeps the
+	// rest of the state itself.
+	Docker bool `json:"docker,omitempty"`
+	// OrigHead is the commit checked out before the rebase started.
+	OrigHead string `json:"origHead,omitempty"`
+	// OrigBranch is the branch checked out before the rebase started, if
+	// HEAD wasn't detached.
+	OrigBranch string `json:"origBranch,omitempty"`
+	// Head is the last commit replayed successfully.
+	Head string `json:"head,omitempty"`
+	// Commit is the commit that conflicted.
+	Commit string `json:"commit"`
+	// Remaining are the commits left to replay after Commit.
+	Remaining []string `json:"remaining,omitempty"`
+	Paths     []string `json:"paths"`
+}
+
+func rebaseStateFile(r *ecmConfig.K3sRelease) string {
+	return filepath.Join(r.Workspace, "rebase-"+r.NewK8sVersion+".json")
+}
+
+func loadRebaseState(r *ecmConfig.K3sRelease) (*rebaseState, error) {
+	b, err := os.ReadFile(rebaseStateFile(r))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("no rebase in progress for " + r.NewK8sVersion)
+		}
+		return nil, err
+	}
+
+	var state rebaseState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.New("invalid rebase state " + rebaseStateFile(r) + ": " + err.Error())
+	}
+
+	return &state, nil
+}
+
+func saveRebaseState(r *ecmConfig.K3sRelease, state *rebaseState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(rebaseStateFile(r), b, 0o644)
+}
+
+// rebaseInProgress returns an error if a previous run stopped on a conflict
+// which hasn't been continued or aborted yet.
+func rebaseInProgress(r *ecmConfig.K3sRelease) error {
+	if _, err := os.Stat(rebaseStateFile(r)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return errors.New("a rebase is in progress for " + r.NewK8sVersion + ", run with --continue or --abort")
+}
+
+// conflictError adds to err what's needed to resolve it.
+func conflictError(r *ecmConfig.K3sRelease, err *RebaseConflictError) error {
+	dir := filepath.Join(r.Workspace, "kubernetes")
+	return errors.New(err.Error() + "\nresolve the conflicts in " + dir +
+		" and run 'release generate k3s tags " + r.NewK8sVersion + " --continue', or '--abort' to start over")
+}
+
+// replay replays commits onto onto with the current user as committer. On a
+// conflict, the last replayed commit is checked out with the changes of the
+// conflicting commit applied, conflicting files have conflict markers, and
+// the state is saved to be continued.
+func replay(repo *git.Repository, r *ecmConfig.K3sRelease, u *ecmConfig.User, state *rebaseState, onto plumbing.Hash, commits []*object.Commit) (plumbing.Hash, error) {
+	committer := object.Signature{Name: u.GithubUsername, Email: u.Email, When: time.Now()}
+
+	head, err := replayCommits(repo.Storer, onto, commits, committer)
+	if err == nil {
+		return head, nil
+	}
+
+	var conflictErr *RebaseConflictError
+	if !errors.As(err, &conflictErr) {
+		return plumbing.ZeroHash, err
+	}
+
+	state.Head = head.String()
+	state.Commit = conflictErr.Commit.String()
+	state.Paths = conflictErr.Paths
+	state.Remaining = nil
+	for i, c := range commits {
+		if c.Hash == conflictErr.Commit {
+			for _, remaining := range commits[i+1:] {
+				state.Remaining = append(state.Remaining, remaining.Hash.String())
+			}
+			if err := writeConflict(repo, head, c, conflictErr.Paths); err != nil {
+				return plumbing.ZeroHash, err
+			}
+			break
+		}
+	}
+
+	if err := saveRebaseState(r, state); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return plumbing.ZeroHash, conflictError(r, conflictErr)
+}
+
+// writeConflict checks out head and writes the changes of c to the
+// worktree, the same as git leaves it when a rebase stops on a conflict.
+func writeConflict(repo *git.Repository, head plumbing.Hash, c *object.Commit, paths []string) error {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: head, Force: true}); err != nil {
+		return err
+	}
+
+	headCommit, err := repo.CommitObject(head)
+	if err != nil {
+		return err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	updates, _, err := commitUpdates(repo.Storer, c, headTree)
+	if err != nil {
+		return err
+	}
+
+	dir := wt.Filesystem.Root()
+
+	for path, entry := range updates {
+		if entry == nil {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		content, err := readBlob(repo.Storer, entry.Hash)
+		if err != nil {
+			return err
+		}
+		if err := writeWorktreeFile(dir, path, content, entry.Mode); err != nil {
+			return err
+		}
+	}
+
+	parent, err := c.Parent(0)
+	if err != nil {
+		return err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return err
+	}
+
+	label := c.Hash.String()[:12] + " (" + commitSubject(c) + ")"
+
+	for _, path := range paths {
+		base, baseMode, err := fileContent(parentTree, path)
+		if err != nil {
+			return err
+		}
+		ours, mode, err := fileContent(headTree, path)
+		if err != nil {
+			return err
+		}
+		theirs, theirMode, err := fileContent(tree, path)
+		if err != nil {
+			return err
+		}
+		if mode == filemode.Empty {
+			mode = theirMode
+		}
+
+		content := conflictContent(base, ours, theirs, baseMode != filemode.Empty && mode != filemode.Empty && theirMode != filemode.Empty, label)
+		if err := writeWorktreeFile(dir, path, content, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileContent returns the content and mode of path in tree, or an empty
+// mode if it doesn't exist.
+func fileContent(tree *object.Tree, path string) ([]byte, filemode.FileMode, error) {
+	f, err := tree.File(path)
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return nil, filemode.Empty, nil
+		}
+		return nil, filemode.Empty, err
+	}
+
+	content, err := f.Contents()
+	return []byte(content), f.Mode, err
+}
+
+// conflictContent returns the content of a conflicting file. Text files
+// that exist on every side get conflict markers around the conflicting
+// lines only, the whole file is marked otherwise, e.g. if one side deleted
+// it.
+func conflictContent(base, ours, theirs []byte, exists bool, label string) []byte {
+	text := bytes.IndexByte(base, 0) == -1 && bytes.IndexByte(ours, 0) == -1 && bytes.IndexByte(theirs, 0) == -1
+	if exists && text {
+		merged, _ := merge3(base, ours, theirs, label)
+		return merged
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString(conflictMarker + "HEAD\n")
+	b.Write(ours)
+	terminateLine(&b)
+	b.WriteString("=======\n")
+	b.Write(theirs)
+	terminateLine(&b)
+	b.WriteString(">>>>>>> " + label + "\n")
+
+	return b.Bytes()
+}
+
+func writeWorktreeFile(dir, path string, content []byte, mode filemode.FileMode) error {
+	p := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if mode == filemode.Symlink {
+		return os.Symlink(string(content), p)
+	}
+
+	perm := os.FileMode(0o644)
+	if mode == filemode.Executable {
+		perm = 0o755
+	}
+
+	return os.WriteFile(p, content, perm)
+}
+
+// ContinueTags continues a rebase stopped on a conflict once the conflicting
+// files have been resolved, then tags the result the same as GenerateTags.
+func ContinueTags(r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
+	state, err := loadRebaseState(r)
+	if err != nil {
+		return err
+	}
+
+	var tags []Tag
+	if state.Docker {
+		if err := continueDockerRebase(r); err != nil {
+			return errors.New("failed to continue rebase: " + err.Error())
+		}
+		if tags, err = dockerTag(r, u); err != nil {
+			return errors.New("failed to tag: " + err.Error())
+		}
+	} else {
+		if tags, err = continueNativeRebase(r, u, state); err != nil {
+			return errors.New("failed to continue rebase: " + err.Error())
+		}
+	}
+
+	if err := os.Remove(rebaseStateFile(r)); err != nil {
+		return err
+	}
+	fmt.Println("successfully rebased and tagged")
+
+	return writeTagsFile(r, tags)
+}
+
+// continueNativeRebase commits the resolved conflict, replays the remaining
+// commits and tags the result.
+func continueNativeRebase(r *ecmConfig.K3sRelease, u *ecmConfig.User, state *rebaseState) ([]Tag, error) {
+	dir := filepath.Join(r.Workspace, "kubernetes")
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head := plumbing.NewHash(state.Head)
+	headCommit, err := repo.CommitObject(head)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	c, err := repo.CommitObject(plumbing.NewHash(state.Commit))
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	if ref.Hash() != head {
+		return nil, errors.New("HEAD moved to " + ref.Hash().String() + " since the rebase stopped at " + state.Head)
+	}
+
+	for _, path := range state.Paths {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if bytes.Contains(content, []byte(conflictMarker)) {
+			return nil, errors.New(path + " still has conflict markers")
+		}
+	}
+
+	// every change in the worktree is committed, the same as git commits
+	// the index, so edits made while resolving aren't lost
+	updates, err := worktreeUpdates(repo, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	committer := object.Signature{Name: u.GithubUsername, Email: u.Email, When: time.Now()}
+	if head, err = commitTree(repo.Storer, c, headTree, updates, head, committer); err != nil {
+		return nil, err
+	}
+
+	commits := make([]*object.Commit, len(state.Remaining))
+	for i, h := range state.Remaining {
+		if commits[i], err = repo.CommitObject(plumbing.NewHash(h)); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("replaying %d remaining commits\n", len(commits))
+	if head, err = replay(repo, r, u, state, head, commits); err != nil {
+		return nil, err
+	}
+
+	return finishNativeRebase(repo, r, head)
+}
+
+// worktreeUpdates returns the tree entries to set on HEAD to commit the
+// changes of the worktree, a nil entry deletes the path.
+func worktreeUpdates(repo *git.Repository, dir string) (map[string]*object.TreeEntry, error) {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]*object.TreeEntry)
+	for path, fs := range status {
+		if fs.Worktree == git.Unmodified && fs.Staging == git.Unmodified {
+			continue
+		}
+		if fs.Extra != "" {
+			updates[fs.Extra] = nil
+		}
+
+		entry, err := worktreeEntry(repo, dir, path)
+		if err != nil {
+			return nil, err
+		}
+		updates[path] = entry
+	}
+
+	return updates, nil
+}
+
+// worktreeEntry stores the content of path in the worktree and returns its
+// tree entry, or nil if it doesn't exist.
+func worktreeEntry(repo *git.Repository, dir, path string) (*object.TreeEntry, error) {
+	p := filepath.Join(dir, filepath.FromSlash(path))
+
+	info, err := os.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var content []byte
+	mode := filemode.Regular
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, err
+		}
+		content, mode = []byte(target), filemode.Symlink
+	default:
+		if content, err = os.ReadFile(p); err != nil {
+			return nil, err
+		}
+		if info.Mode()&0o111 != 0 {
+			mode = filemode.Executable
+		}
+	}
+
+	h, err := writeBlob(repo.Storer, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &object.TreeEntry{Name: filepath.Base(path), Mode: mode, Hash: h}, nil
+}
+
+func continueDockerRebase(r *ecmConfig.K3sRelease) error {
+	dir := filepath.Join(r.Workspace, "kubernetes")
+
+	out, err := ecmExec.RunCommand(dir, "git", "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return err
+	}
+	for _, path := range strings.Fields(out) {
+		if _, err := ecmExec.RunCommand(dir, "git", "add", "-A", "--", path); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("git rebase --continue")
+	out, err = ecmExec.RunCommand(dir, "git", "-c", "core.editor=true", "rebase", "--continue")
+	if err != nil {
+		return dockerRebaseError(r, err)
+	}
+	fmt.Println(out)
+
+	return nil
+}
+
+// dockerRebaseError saves the rebase state if err is due to a conflict in
+// a rebase run with git.
+func dockerRebaseError(r *ecmConfig.K3sRelease, err error) error {
+	dir := filepath.Join(r.Workspace, "kubernetes")
+
+	commit, revErr := ecmExec.RunCommand(dir, "git", "rev-parse", "-q", "--verify", "REBASE_HEAD")
+	if revErr != nil {
+		return err
+	}
+	subject, logErr := ecmExec.RunCommand(dir, "git", "log", "-1", "--format=%s", "REBASE_HEAD")
+	if logErr != nil {
+		return err
+	}
+	paths, diffErr := ecmExec.RunCommand(dir, "git", "diff", "--name-only", "--diff-filter=U")
+	if diffErr != nil {
+		return err
+	}
+
+	conflictErr := &RebaseConflictError{
+		Commit:  plumbing.NewHash(strings.TrimSpace(commit)),
+		Subject: strings.TrimSpace(subject),
+		Paths:   strings.Fields(paths),
+	}
+	state := &rebaseState{
+		Docker: true,
+		Commit: conflictErr.Commit.String(),
+		Paths:  conflictErr.Paths,
+	}
+	if err := saveRebaseState(r, state); err != nil {
+		return err
+	}
+
+	return conflictError(r, conflictErr)
+}
+
+// AbortTags aborts a rebase stopped on a conflict and restores the
+// kubernetes clone to where it was before the rebase.
+func AbortTags(r *ecmConfig.K3sRelease) error {
+	state, err := loadRebaseState(r)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(r.Workspace, "kubernetes")
+
+	if state.Docker {
+		fmt.Println("git rebase --abort")
+		if _, err := ecmExec.RunCommand(dir, "git", "rebase", "--abort"); err != nil {
+			return err
+		}
+	} else {
+		repo, err := git.PlainOpen(dir)
+		if err != nil {
+			return err
+		}
+		wt, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+		checkout, opts := state.OrigHead, &git.CheckoutOptions{Hash: plumbing.NewHash(state.OrigHead), Force: true}
+		if state.OrigBranch != "" {
+			checkout, opts = state.OrigBranch, &git.CheckoutOptions{Branch: plumbing.ReferenceName(state.OrigBranch), Force: true}
+		}
+		fmt.Println("checking out " + checkout)
+		if err := wt.Checkout(opts); err != nil {
+			return err
+		}
+		if err := cleanGitRepo(dir); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(rebaseStateFile(r))
+}
@@ -0,0 +1,284 @@
+package k3s
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	ecmExec "github.com/rancher/ecm-distro-tools/exec"
+	"github.com/rancher/ecm-distro-tools/release"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/mod/modfile"
+)
+
+const k3sUpstreamRemote = "upstream"
+
+// k3sGoWorkflows are the workflows which set up the Go version k3s is built
+// and tested with.
+var k3sGoWorkflows = []string{
+	".github/workflows/integration.yaml",
+	".github/workflows/unitcoverage.yaml",
+}
+
+// dockerfileGoRE matches the version of a golang image reference, e.g. the
+// 1.22.4 of golang:1.22.4-alpine3.20.
+var dockerfileGoRE = regexp.MustCompile(`golang:[0-9][^-\s"']*-`)
+
+func updateK3sReferencesAndPush(r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath string) error {
+	if err := release.SetWorkspace(r.Workspace); err != nil {
+		return err
+	}
+
+	fmt.Println("getting k8s go version")
+
+	goVersion, err := goVersion(r)
+	if err != nil {
+		return err
+	}
+	r.NewGoVersion = goVersion
+
+	fmt.Println("getting ssh auth")
+	gitAuth, err := release.GitSSHAuth(sshKeyPath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(r.Workspace, k3sRepo)
+
+	repo, err := release.CloneOrOpen(dir, "git@github.com:"+u.GithubUsername+"/k3s.git", gitAuth)
+	if err != nil {
+		return err
+	}
+
+	branch, err := release.CheckoutBranchFrom(repo, k3sUpstreamRemote, r.K3sUpstreamURL, r.ReleaseBranch, r.NewK8sVersion+"-"+r.NewSuffix, gitAuth)
+	if err != nil {
+		return err
+	}
+
+	originals, err := editReferences(dir, r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("go mod tidy")
+	if _, err := ecmExec.RunCommand(dir, "go", "mod", "tidy"); err != nil {
+		return errors.New("go mod tidy failed: " + err.Error())
+	}
+
+	if err := release.WriteFileDiffs(os.Stdout, dir, originals); err != nil {
+		return err
+	}
+
+	paths := []string{"go.sum"}
+	for path := range originals {
+		paths = append(paths, path)
+	}
+	if _, err := release.CommitSignedOff(repo, paths, "Update to "+r.NewK8sVersion, u.GithubUsername, u.Email); err != nil {
+		return err
+	}
+
+	if r.DryRun {
+		fmt.Println("dry run, skipping push")
+		return nil
+	}
+
+	return release.PushBranch(repo, branch, gitAuth)
+}
+
+// editReferences updates the kubernetes modules in go.mod and the Go version
+// in the Dockerfiles and workflows of the k3s repo at dir. The original
+// content of every file that's changed is returned, keyed by its path
+// relative to dir.
+func editReferences(dir string, r *ecmConfig.K3sRelease) (map[string][]byte, error) {
+	originals := make(map[string][]byte)
+
+	edit := func(path string, update func([]byte) ([]byte, error)) error {
+		b, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+		updated, err := update(b)
+		if err != nil {
+			return errors.New("failed to update " + path + ": " + err.Error())
+		}
+		if string(updated) == string(b) {
+			return nil
+		}
+		originals[path] = b
+		return os.WriteFile(filepath.Join(dir, path), updated, 0o644)
+	}
+
+	fmt.Println("updating go.mod")
+	if err := edit("go.mod", func(b []byte) ([]byte, error) {
+		return updateGoMod(b, r)
+	}); err != nil {
+		return nil, err
+	}
+
+	dockerfiles, err := filepath.Glob(filepath.Join(dir, "Dockerfile.*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dockerfile := range dockerfiles {
+		path := filepath.Base(dockerfile)
+		fmt.Println("updating " + path)
+		if err := edit(path, func(b []byte) ([]byte, error) {
+			return updateDockerfileGo(b, r.NewGoVersion), nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, workflow := range k3sGoWorkflows {
+		if _, err := os.Stat(filepath.Join(dir, workflow)); os.IsNotExist(err) {
+			fmt.Println(workflow + " not found, skipping it")
+			continue
+		}
+		fmt.Println("updating " + workflow)
+		if err := edit(workflow, func(b []byte) ([]byte, error) {
+			return updateWorkflowGo(b, r.NewGoVersion)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return originals, nil
+}
+
+// updateGoMod moves the k3s-io/kubernetes replacements to the new k3s
+// version, k8s.io/kubernetes to the new kubernetes version and every module
+// on the old kubernetes client version to the new one.
+func updateGoMod(b []byte, r *ecmConfig.K3sRelease) ([]byte, error) {
+	f, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	oldVersion := r.OldK8sVersion + "-" + r.OldSuffix
+	newVersion := r.NewK8sVersion + "-" + r.NewSuffix
+
+	clientVersion := func(v string) string {
+		if v == r.OldK8sClient {
+			return r.NewK8sClient
+		}
+		return v
+	}
+
+	// copy the replacements since dropping one clears it and adding one
+	// modifies f.Replace.
+	replaces := make([]modfile.Replace, len(f.Replace))
+	for i, replace := range f.Replace {
+		replaces[i] = *replace
+	}
+	for _, replace := range replaces {
+		oldModVersion := clientVersion(replace.Old.Version)
+		newModVersion := clientVersion(replace.New.Version)
+		if replace.New.Path == k3sKubernetesModule || strings.HasPrefix(replace.New.Path, k3sKubernetesModule+"/") {
+			newModVersion = strings.ReplaceAll(newModVersion, oldVersion, newVersion)
+		}
+		if oldModVersion == replace.Old.Version && newModVersion == replace.New.Version {
+			continue
+		}
+
+		if oldModVersion != replace.Old.Version {
+			if err := f.DropReplace(replace.Old.Path, replace.Old.Version); err != nil {
+				return nil, err
+			}
+		}
+		if err := f.AddReplace(replace.Old.Path, oldModVersion, replace.New.Path, newModVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, require := range f.Require {
+		v := clientVersion(require.Mod.Version)
+		if require.Mod.Path == "k8s.io/kubernetes" {
+			v = r.NewK8sVersion
+		}
+		if v == require.Mod.Version {
+			continue
+		}
+		if err := f.AddRequire(require.Mod.Path, v); err != nil {
+			return nil, err
+		}
+	}
+
+	f.Cleanup()
+
+	return f.Format()
+}
+
+// updateDockerfileGo sets the version of the golang images referenced by
+// the FROM and ARG instructions of a Dockerfile.
+func updateDockerfileGo(b []byte, goVersion string) []byte {
+	lines := strings.SplitAfter(string(b), "\n")
+
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM", "ARG":
+			lines[i] = dockerfileGoRE.ReplaceAllString(line, "golang:"+goVersion+"-")
+		}
+	}
+
+	return []byte(strings.Join(lines, ""))
+}
+
+// updateWorkflowGo sets every go-version key of a workflow. The values are
+// replaced in place to keep the rest of the file as is.
+func updateWorkflowGo(b []byte, goVersion string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	var values []*yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if key, value := n.Content[i], n.Content[i+1]; key.Value == "go-version" && value.Kind == yaml.ScalarNode {
+					values = append(values, value)
+				}
+			}
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(&doc)
+
+	lines := strings.SplitAfter(string(b), "\n")
+
+	for _, value := range values {
+		line := lines[value.Line-1]
+		start := value.Column - 1
+
+		quote := "'"
+		end := start + len(value.Value)
+		switch value.Style {
+		case yaml.DoubleQuotedStyle:
+			quote = `"`
+			end += 2
+		case yaml.SingleQuotedStyle:
+			end += 2
+		case 0:
+		default:
+			return nil, fmt.Errorf("unsupported go-version style on line %d", value.Line)
+		}
+		if end > len(line) {
+			return nil, fmt.Errorf("unexpected go-version on line %d", value.Line)
+		}
+
+		lines[value.Line-1] = line[:start] + quote + goVersion + quote + line[end:]
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
@@ -0,0 +1,229 @@
+package k3s
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release"
+)
+
+const testK3sGoMod = `module github.com/k3s-io/k3s
+
+go 1.22.2
+
+replace (
+	github.com/spf13/pflag => github.com/spf13/pflag v1.0.6
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.1-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.1-k3s1
+)
+
+require (
+	github.com/spf13/pflag v1.0.5
+	k8s.io/api v0.30.1
+	k8s.io/kube-openapi v0.30.1
+	k8s.io/kubernetes v1.30.1
+)
+`
+
+var testK3sRelease = &ecmConfig.K3sRelease{
+	OldK8sVersion: "v1.30.1",
+	NewK8sVersion: "v1.30.2",
+	OldSuffix:     "k3s1",
+	NewSuffix:     "k3s1",
+	OldK8sClient:  "v0.30.1",
+	NewK8sClient:  "v0.30.2",
+	NewGoVersion:  "1.22.5",
+	ReleaseBranch: "release-1.30",
+}
+
+func TestUpdateGoMod(t *testing.T) {
+	got, err := updateGoMod([]byte(testK3sGoMod), testK3sRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `module github.com/k3s-io/k3s
+
+go 1.22.2
+
+replace (
+	github.com/spf13/pflag => github.com/spf13/pflag v1.0.6
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.2-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.2-k3s1
+)
+
+require (
+	github.com/spf13/pflag v1.0.5
+	k8s.io/api v0.30.2
+	k8s.io/kube-openapi v0.30.2
+	k8s.io/kubernetes v1.30.2
+)
+`
+	if string(got) != want {
+		t.Errorf("updateGoMod() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUpdateDockerfileGo(t *testing.T) {
+	dockerfile := "ARG GOLANG=golang:1.22.4-alpine3.20\nFROM ${GOLANG} AS build\nFROM golang:1.22.4-alpine3.20\nRUN echo golang:1.22.4-alpine\n"
+	want := "ARG GOLANG=golang:1.22.5-alpine3.20\nFROM ${GOLANG} AS build\nFROM golang:1.22.5-alpine3.20\nRUN echo golang:1.22.4-alpine\n"
+
+	if got := string(updateDockerfileGo([]byte(dockerfile), "1.22.5")); got != want {
+		t.Errorf("updateDockerfileGo() = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateWorkflowGo(t *testing.T) {
+	workflow := `name: Integration
+jobs:
+  test:
+    steps:
+      # keep in sync with Dockerfile.dapper
+      - uses: actions/setup-go@v5
+        with:
+          go-version: '1.22.4'
+      - uses: actions/setup-go@v5
+        with: { go-version: "1.22.4", check-latest: true }
+      - uses: actions/setup-go@v5
+        with:
+          go-version: 1.22.4 # plain
+`
+	want := `name: Integration
+jobs:
+  test:
+    steps:
+      # keep in sync with Dockerfile.dapper
+      - uses: actions/setup-go@v5
+        with:
+          go-version: '1.22.5'
+      - uses: actions/setup-go@v5
+        with: { go-version: "1.22.5", check-latest: true }
+      - uses: actions/setup-go@v5
+        with:
+          go-version: '1.22.5' # plain
+`
+
+	got, err := updateWorkflowGo([]byte(workflow), "1.22.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("updateWorkflowGo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for path, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateReferences(t *testing.T) {
+	upstreamDir := t.TempDir()
+	upstream, err := git.PlainInit(upstreamDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, upstreamDir, map[string]string{
+		"go.mod":                             testK3sGoMod,
+		"go.sum":                             "",
+		"Dockerfile.dapper":                  "FROM golang:1.22.4-alpine3.20\n",
+		".github/workflows/integration.yaml": "jobs:\n  test:\n    steps:\n      - with:\n          go-version: '1.22.4'\n",
+	})
+	wt, err := upstream.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.AddGlob("."); err != nil {
+		t.Fatal(err)
+	}
+	head, err := wt.Commit("k3s", &git.CommitOptions{Author: &testSignature})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := upstream.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release-1.30"), head)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{URL: upstreamDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := *testK3sRelease
+	r.K3sUpstreamURL = upstreamDir
+
+	branch, err := release.CheckoutBranchFrom(repo, k3sUpstreamRemote, r.K3sUpstreamURL, r.ReleaseBranch, r.NewK8sVersion+"-"+r.NewSuffix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch.Short() != "v1.30.2-k3s1" {
+		t.Errorf("branch = %s, want v1.30.2-k3s1", branch.Short())
+	}
+
+	originals, err := editReferences(dir, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(originals) != 3 {
+		t.Errorf("changed files = %d, want 3", len(originals))
+	}
+
+	var diff strings.Builder
+	if err := release.WriteFileDiffs(&diff, dir, originals); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.String(), "+FROM golang:1.22.5-alpine3.20") {
+		t.Errorf("diff doesn't include the Dockerfile change:\n%s", diff.String())
+	}
+
+	paths := []string{"go.sum"}
+	for path := range originals {
+		paths = append(paths, path)
+	}
+	h, err := release.CommitSignedOff(repo, paths, "Update to "+r.NewK8sVersion, "k3s", "k3s@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := repo.CommitObject(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Update to v1.30.2\n\nSigned-off-by: k3s <k3s@example.com>\n"; commit.Message != want {
+		t.Errorf("message = %q, want %q", commit.Message, want)
+	}
+	if commit.ParentHashes[0] != head {
+		t.Errorf("parent = %s, want %s", commit.ParentHashes[0], head)
+	}
+
+	f, err := commit.File("Dockerfile.dapper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := f.Contents(); content != "FROM golang:1.22.5-alpine3.20\n" {
+		t.Errorf("Dockerfile.dapper = %q", content)
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Name() != branch || ref.Hash() != h {
+		t.Errorf("HEAD = %s, want %s at %s", ref, branch, h)
+	}
+}
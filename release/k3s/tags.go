@@ -0,0 +1,606 @@
+package k3s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/google/go-github/v90/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+)
+
+// stagingModulesPath is where the kubernetes staging modules live, each of
+// them is tagged as <path>/<module>/<version>.
+const stagingModulesPath = "staging/src/k8s.io"
+
+// maxReplayCommits is the max amount of k3s commits expected on top of a
+// kubernetes release.
+const maxReplayCommits = 1000
+
+// Tag is a tag created in the kubernetes workspace clone.
+type Tag struct {
+	Name   string
+	Commit plumbing.Hash
+}
+
+// RebaseConflictError is returned when a k3s commit can't be replayed on top
+// of the new kubernetes release because both changed the same lines.
+type RebaseConflictError struct {
+	Commit  plumbing.Hash
+	Subject string
+	Paths   []string
+}
+
+func (e *RebaseConflictError) Error() string {
+	return "conflict replaying " + e.Commit.String() + " (" + e.Subject + ") in: " + strings.Join(e.Paths, ", ")
+}
+
+func commitSubject(c *object.Commit) string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return subject
+}
+
+// nativeRebaseAndTag is the go-git equivalent of running
+// git rebase --onto <new> <old> <previous k3s tag>~1 followed by tag.sh.
+func nativeRebaseAndTag(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) ([]Tag, error) {
+	dir := filepath.Join(r.Workspace, "kubernetes")
+
+	fmt.Println("cleaning git repo: " + dir)
+	if err := cleanGitRepo(dir); err != nil {
+		return nil, err
+	}
+
+	prevK3sTag, err := previousK3sReleaseTag(ctx, ghClient, r)
+	if err != nil {
+		return nil, err
+	}
+	if prevK3sTag == "" {
+		return nil, errors.New("no previous k3s release found for " + r.OldK8sVersion)
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	onto, err := repo.ResolveRevision(plumbing.Revision(r.NewK8sVersion))
+	if err != nil {
+		return nil, errors.New("failed to resolve " + r.NewK8sVersion + ": " + err.Error())
+	}
+	upstream, err := repo.ResolveRevision(plumbing.Revision(r.OldK8sVersion))
+	if err != nil {
+		return nil, errors.New("failed to resolve " + r.OldK8sVersion + ": " + err.Error())
+	}
+	tip, err := repo.ResolveRevision(plumbing.Revision(prevK3sTag + "~1"))
+	if err != nil {
+		return nil, errors.New("failed to resolve " + prevK3sTag + "~1: " + err.Error())
+	}
+
+	commits, err := commitsToReplay(repo, *upstream, *tip)
+	if err != nil {
+		return nil, err
+	}
+
+	origHead, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("replaying %d commits from %s onto %s\n", len(commits), prevK3sTag, r.NewK8sVersion)
+	state := &rebaseState{OrigHead: origHead.Hash().String()}
+	if origHead.Name().IsBranch() {
+		state.OrigBranch = origHead.Name().String()
+	}
+	head, err := replay(repo, r, u, state, *onto, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	return finishNativeRebase(repo, r, head)
+}
+
+// finishNativeRebase checks out the rebased commit and tags it, replacing
+// the tags of a previous run.
+func finishNativeRebase(repo *git.Repository, r *ecmConfig.K3sRelease, head plumbing.Hash) ([]Tag, error) {
+	if err := checkoutRebased(repo, head); err != nil {
+		return nil, err
+	}
+
+	tagExists, err := isTagExists(r)
+	if err != nil {
+		return nil, err
+	}
+	if tagExists {
+		fmt.Println("tag exists, removing it")
+		if err := removeExistingTags(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return createTags(repo, head, r.NewK8sVersion+"-"+r.NewSuffix)
+}
+
+// checkoutRebased checks out the last replayed commit, the same as git
+// rebase leaves a detached HEAD when rebasing a tag.
+func checkoutRebased(repo *git.Repository, head plumbing.Hash) error {
+	fmt.Println("checking out " + head.String())
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Checkout(&git.CheckoutOptions{Hash: head, Force: true})
+}
+
+// commitsToReplay returns the commits between upstream and tip, oldest
+// first. The k3s branches are kept linear, so a merge commit means the
+// history isn't what the native rebase expects.
+func commitsToReplay(repo *git.Repository, upstream, tip plumbing.Hash) ([]*object.Commit, error) {
+	var commits []*object.Commit
+
+	c, err := repo.CommitObject(tip)
+	if err != nil {
+		return nil, err
+	}
+
+	for c.Hash != upstream {
+		if len(commits) == maxReplayCommits {
+			return nil, fmt.Errorf("%s not found in the last %d commits of %s", upstream, maxReplayCommits, tip)
+		}
+		if c.NumParents() != 1 {
+			return nil, errors.New("can't replay merge or root commit " + c.Hash.String())
+		}
+
+		commits = append(commits, c)
+
+		if c, err = c.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.Reverse(commits)
+
+	return commits, nil
+}
+
+// replayCommits applies the changes of each commit on top of onto and
+// returns the last created commit. Commits that become empty are dropped,
+// the same as git rebase does. On a conflict, the last commit replayed
+// successfully is returned along with a *RebaseConflictError.
+func replayCommits(s storer.EncodedObjectStorer, onto plumbing.Hash, commits []*object.Commit, committer object.Signature) (plumbing.Hash, error) {
+	head := onto
+
+	for _, c := range commits {
+		headCommit, err := object.GetCommit(s, head)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		baseTree, err := headCommit.Tree()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		updates, conflicts, err := commitUpdates(s, c, baseTree)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if len(conflicts) > 0 {
+			return head, &RebaseConflictError{Commit: c.Hash, Subject: commitSubject(c), Paths: conflicts}
+		}
+
+		if head, err = commitTree(s, c, baseTree, updates, head, committer); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return head, nil
+}
+
+// commitTree commits baseTree with the given updates as a copy of c on top
+// of head. head is returned as is if the updates don't change baseTree.
+func commitTree(s storer.EncodedObjectStorer, c *object.Commit, baseTree *object.Tree, updates map[string]*object.TreeEntry, head plumbing.Hash, committer object.Signature) (plumbing.Hash, error) {
+	treeHash, err := writeTree(s, baseTree, updates)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if treeHash == baseTree.Hash {
+		fmt.Println("dropping empty commit " + c.Hash.String())
+		return head, nil
+	}
+
+	commit := &object.Commit{
+		Author:       c.Author,
+		Committer:    committer,
+		Message:      c.Message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{head},
+	}
+
+	return storeObject(s, commit)
+}
+
+// commitUpdates returns the tree entries to set on baseTree to apply the
+// changes of c, a nil entry deletes the path, and the paths that conflict.
+func commitUpdates(s storer.EncodedObjectStorer, c *object.Commit, baseTree *object.Tree) (map[string]*object.TreeEntry, []string, error) {
+	parent, err := c.Parent(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := make(map[string]*object.TreeEntry)
+	var conflicts []string
+
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		path := change.To.Name
+		if action == merkletrie.Delete {
+			path = change.From.Name
+		}
+
+		base, err := baseTree.FindEntry(path)
+		if err != nil && !errors.Is(err, object.ErrEntryNotFound) && !errors.Is(err, object.ErrDirectoryNotFound) {
+			return nil, nil, err
+		}
+
+		from, to := change.From.TreeEntry, change.To.TreeEntry
+
+		switch {
+		case action == merkletrie.Insert && base == nil:
+			updates[path] = &to
+		case action == merkletrie.Delete && base == nil:
+		case base != nil && base.Hash == to.Hash && action != merkletrie.Delete:
+		case base != nil && base.Hash == from.Hash && action == merkletrie.Delete:
+			updates[path] = nil
+		case base != nil && base.Hash == from.Hash:
+			updates[path] = &to
+		case action == merkletrie.Modify && base != nil && base.Mode.IsFile():
+			merged, ok, err := mergeBlob(s, from.Hash, to.Hash, base.Hash)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				conflicts = append(conflicts, path)
+				continue
+			}
+			updates[path] = &object.TreeEntry{Name: to.Name, Mode: to.Mode, Hash: merged}
+		default:
+			conflicts = append(conflicts, path)
+		}
+	}
+
+	return updates, conflicts, nil
+}
+
+// mergeBlob merges the changes between from and to into base line by line.
+// It reports false if they conflict or any of the blobs is binary.
+func mergeBlob(s storer.EncodedObjectStorer, from, to, base plumbing.Hash) (plumbing.Hash, bool, error) {
+	var contents [3][]byte
+	for i, h := range []plumbing.Hash{from, to, base} {
+		b, err := readBlob(s, h)
+		if err != nil {
+			return plumbing.ZeroHash, false, err
+		}
+		if bytes.IndexByte(b, 0) != -1 {
+			return plumbing.ZeroHash, false, nil
+		}
+		contents[i] = b
+	}
+
+	merged, conflict := merge3(contents[0], contents[2], contents[1], "")
+	if conflict {
+		return plumbing.ZeroHash, false, nil
+	}
+
+	h, err := writeBlob(s, merged)
+	return h, err == nil, err
+}
+
+func writeBlob(s storer.EncodedObjectStorer, content []byte) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(obj)
+}
+
+func readBlob(s storer.EncodedObjectStorer, h plumbing.Hash) ([]byte, error) {
+	blob, err := object.GetBlob(s, h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// writeTree stores a copy of base with the given updates, keyed by path
+// relative to base, and returns its hash. Only the subtrees containing an
+// update are rewritten, base may be nil for a new directory.
+func writeTree(s storer.EncodedObjectStorer, base *object.Tree, updates map[string]*object.TreeEntry) (plumbing.Hash, error) {
+	if base != nil && len(updates) == 0 {
+		return base.Hash, nil
+	}
+
+	direct := make(map[string]*object.TreeEntry)
+	nested := make(map[string]map[string]*object.TreeEntry)
+	for path, entry := range updates {
+		name, rest, found := strings.Cut(path, "/")
+		if !found {
+			direct[name] = entry
+			continue
+		}
+		if nested[name] == nil {
+			nested[name] = make(map[string]*object.TreeEntry)
+		}
+		nested[name][rest] = entry
+	}
+
+	var entries []object.TreeEntry
+	seen := make(map[string]bool)
+
+	var baseEntries []object.TreeEntry
+	if base != nil {
+		baseEntries = base.Entries
+	}
+
+	for _, e := range baseEntries {
+		seen[e.Name] = true
+
+		if entry, ok := direct[e.Name]; ok {
+			if entry != nil {
+				entries = append(entries, object.TreeEntry{Name: e.Name, Mode: entry.Mode, Hash: entry.Hash})
+			}
+			continue
+		}
+
+		sub, ok := nested[e.Name]
+		if !ok {
+			entries = append(entries, e)
+			continue
+		}
+
+		var subTree *object.Tree
+		if e.Mode == filemode.Dir {
+			t, err := object.GetTree(s, e.Hash)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			subTree = t
+		}
+
+		h, err := writeTree(s, subTree, sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if !h.IsZero() {
+			entries = append(entries, object.TreeEntry{Name: e.Name, Mode: filemode.Dir, Hash: h})
+		}
+	}
+
+	for name, entry := range direct {
+		if !seen[name] && entry != nil {
+			entries = append(entries, object.TreeEntry{Name: name, Mode: entry.Mode, Hash: entry.Hash})
+		}
+	}
+
+	for name, sub := range nested {
+		if seen[name] {
+			continue
+		}
+		h, err := writeTree(s, nil, sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if !h.IsZero() {
+			entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+		}
+	}
+
+	// an empty directory is removed from its parent
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+
+	// git sorts directories as if their name ended with a slash
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	return storeObject(s, &object.Tree{Entries: entries})
+}
+
+type encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+func storeObject(s storer.EncodedObjectStorer, o encoder) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(obj)
+}
+
+// createTags tags head with the k3s version, and each staging module with
+// <staging path>/<module>/<version> so they can be required as Go modules.
+func createTags(repo *git.Repository, head plumbing.Hash, tagVersion string) ([]Tag, error) {
+	commit, err := repo.CommitObject(head)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	names, err := tagNames(tree, tagVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i] = Tag{Name: name, Commit: head}
+	}
+
+	for _, tag := range tags {
+		fmt.Println("creating tag " + tag.Name)
+		if _, err := repo.CreateTag(tag.Name, tag.Commit, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// tagNames returns the tags of each staging module in tree followed by
+// tagVersion itself.
+func tagNames(tree *object.Tree, tagVersion string) ([]string, error) {
+	staging, err := tree.Tree(stagingModulesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range staging.Entries {
+		if e.Mode != filemode.Dir {
+			continue
+		}
+		if _, err := tree.File(stagingModulesPath + "/" + e.Name + "/go.mod"); err != nil {
+			continue
+		}
+		names = append(names, stagingModulesPath+"/"+e.Name+"/"+tagVersion)
+	}
+
+	return append(names, tagVersion), nil
+}
+
+// resolveTags looks up the commits of the tags created by tag.sh for
+// tagVersion, the names are derived from the staging modules of HEAD.
+func resolveTags(dir, tagVersion string) ([]Tag, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	names, err := tagNames(tree, tagVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		h, err := repo.ResolveRevision(plumbing.Revision("refs/tags/" + name))
+		if err != nil {
+			return nil, errors.New("failed to resolve tag " + name + ": " + err.Error())
+		}
+		tags[i] = Tag{Name: name, Commit: *h}
+	}
+
+	return tags, nil
+}
+
+func writeTagsFile(r *ecmConfig.K3sRelease, tags []Tag) error {
+	var b strings.Builder
+	for _, tag := range tags {
+		b.WriteString(tag.Name + " " + tag.Commit.String() + "\n")
+	}
+
+	tagFile := filepath.Join(r.Workspace, "tags-"+r.NewK8sVersion)
+	return os.WriteFile(tagFile, []byte(b.String()), 0o644)
+}
+
+func tagsFromFile(r *ecmConfig.K3sRelease) ([]Tag, error) {
+	tagFile := filepath.Join(r.Workspace, "tags-"+r.NewK8sVersion)
+
+	dat, err := os.ReadFile(tagFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTags(string(dat)), nil
+}
+
+// parseTags parses the tags file, which lists a tag and its commit per line.
+// Files written by older versions contain the git push commands
+// printed by tag.sh instead, their commit is left empty.
+func parseTags(dat string) []Tag {
+	var tags []Tag
+
+	for _, line := range strings.Split(dat, "\n") {
+		if i := strings.Index(line, "git push $REMOTE"); i != -1 {
+			if fields := strings.Fields(line[i:]); len(fields) > 3 {
+				tags = append(tags, Tag{Name: fields[3]})
+			}
+			continue
+		}
+
+		if fields := strings.Fields(line); len(fields) == 2 && plumbing.IsHash(fields[1]) {
+			tags = append(tags, Tag{Name: fields[0], Commit: plumbing.NewHash(fields[1])})
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,360 @@
+package k3s
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+)
+
+var testSignature = object.Signature{Name: "k3s", Email: "k3s@example.com", When: time.Unix(0, 0)}
+
+func storeBlob(t *testing.T, s storer.EncodedObjectStorer, content string) plumbing.Hash {
+	t.Helper()
+
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func storeCommit(t *testing.T, s storer.EncodedObjectStorer, parent *object.Commit, files map[string]string) *object.Commit {
+	t.Helper()
+
+	updates := make(map[string]*object.TreeEntry)
+	for path, content := range files {
+		updates[path] = &object.TreeEntry{Mode: filemode.Regular, Hash: storeBlob(t, s, content)}
+	}
+
+	treeHash, err := writeTree(s, nil, updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &object.Commit{Author: testSignature, Committer: testSignature, Message: "commit", TreeHash: treeHash}
+	if parent != nil {
+		c.ParentHashes = []plumbing.Hash{parent.Hash}
+	}
+
+	h, err := storeObject(s, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := object.GetCommit(s, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func treeFiles(t *testing.T, s storer.EncodedObjectStorer, h plumbing.Hash) map[string]string {
+	t.Helper()
+
+	commit, err := object.GetCommit(s, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := make(map[string]string)
+	if err := files.ForEach(func(f *object.File) error {
+		content, err := f.Contents()
+		contents[f.Name] = content
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestReplayCommits(t *testing.T) {
+	const goMod = "module k8s.io/kubernetes\n\ngo 1.22\n\nrequire (\n\tk8s.io/api v0.0.0\n)\n"
+
+	tests := []struct {
+		name          string
+		onto          map[string]string
+		want          map[string]string
+		wantConflicts []string
+	}{
+		{
+			name: "changes on different lines",
+			onto: map[string]string{"go.mod": "// upstream\n" + strings.Replace(goMod, "1.22", "1.23", 1), "hack/tag.sh": "tag\n"},
+			want: map[string]string{
+				"go.mod":      "// upstream\n" + strings.Replace(strings.Replace(goMod, "1.22", "1.23", 1), "v0.0.0", "v1.30.1-k3s1", 1),
+				"hack/tag.sh": "tag\n",
+				"pkg/k3s.go":  "k3s\n",
+			},
+		},
+		{
+			name: "file deleted upstream",
+			onto: map[string]string{"go.mod": goMod},
+			want: map[string]string{"go.mod": strings.Replace(goMod, "v0.0.0", "v1.30.1-k3s1", 1), "pkg/k3s.go": "k3s\n"},
+		},
+		{
+			name:          "changes on the same line",
+			onto:          map[string]string{"go.mod": strings.Replace(goMod, "v0.0.0", "v1.31.0", 1), "hack/tag.sh": "tag\n"},
+			wantConflicts: []string{"go.mod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := memory.NewStorage()
+
+			old := storeCommit(t, s, nil, map[string]string{"go.mod": goMod, "hack/tag.sh": "tag\n"})
+			k3s := storeCommit(t, s, old, map[string]string{
+				"go.mod":      strings.Replace(goMod, "v0.0.0", "v1.30.1-k3s1", 1),
+				"hack/tag.sh": "tag\n",
+				"pkg/k3s.go":  "k3s\n",
+			})
+			onto := storeCommit(t, s, old, tt.onto)
+
+			head, err := replayCommits(s, onto.Hash, []*object.Commit{k3s}, testSignature)
+
+			var conflictErr *RebaseConflictError
+			if errors.As(err, &conflictErr) {
+				if !reflect.DeepEqual(conflictErr.Paths, tt.wantConflicts) {
+					t.Errorf("conflicts = %v, want %v", conflictErr.Paths, tt.wantConflicts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantConflicts != nil {
+				t.Fatalf("expected conflicts on %v", tt.wantConflicts)
+			}
+
+			if got := treeFiles(t, s, head); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	h := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+
+	tests := []struct {
+		name string
+		dat  string
+		want []Tag
+	}{
+		{
+			name: "native",
+			dat:  "staging/src/k8s.io/api/v1.30.1-k3s1 " + h.String() + "\nv1.30.1-k3s1 " + h.String() + "\n",
+			want: []Tag{{Name: "staging/src/k8s.io/api/v1.30.1-k3s1", Commit: h}, {Name: "v1.30.1-k3s1", Commit: h}},
+		},
+		{
+			name: "tag.sh",
+			dat:  "+ echo\ngit push $REMOTE staging/src/k8s.io/api/v1.30.1-k3s1\ngit push $REMOTE v1.30.1-k3s1\n",
+			want: []Tag{{Name: "staging/src/k8s.io/api/v1.30.1-k3s1"}, {Name: "v1.30.1-k3s1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTags(tt.dat); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContinueNativeRebase(t *testing.T) {
+	const goMod = "module k8s.io/api\n\nrequire k8s.io/apimachinery v0.0.0\n"
+	const stagingGoMod = stagingModulesPath + "/api/go.mod"
+
+	r := &ecmConfig.K3sRelease{Workspace: t.TempDir(), NewK8sVersion: "v1.30.2", NewSuffix: "k3s1"}
+	u := &ecmConfig.User{GithubUsername: "k3s", Email: "k3s@example.com"}
+
+	repo, err := git.PlainInit(filepath.Join(r.Workspace, "kubernetes"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := repo.Storer
+
+	old := storeCommit(t, s, nil, map[string]string{stagingGoMod: goMod})
+	conflicting := storeCommit(t, s, old, map[string]string{stagingGoMod: strings.Replace(goMod, "v0.0.0", "v1.30.1-k3s1", 1)})
+	next := storeCommit(t, s, conflicting, map[string]string{stagingGoMod: strings.Replace(goMod, "v0.0.0", "v1.30.1-k3s1", 1), "k3s.go": "k3s\n"})
+	onto := storeCommit(t, s, old, map[string]string{stagingGoMod: strings.Replace(goMod, "v0.0.0", "v1.30.2", 1)})
+
+	state := &rebaseState{OrigHead: onto.Hash.String()}
+	if _, err := replay(repo, r, u, state, onto.Hash, []*object.Commit{conflicting, next}); err == nil {
+		t.Fatal("expected a conflict")
+	}
+
+	state, err = loadRebaseState(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &rebaseState{
+		OrigHead:  onto.Hash.String(),
+		Head:      onto.Hash.String(),
+		Commit:    conflicting.Hash.String(),
+		Remaining: []string{next.Hash.String()},
+		Paths:     []string{stagingGoMod},
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("state = %+v, want %+v", state, want)
+	}
+
+	conflictFile := filepath.Join(r.Workspace, "kubernetes", filepath.FromSlash(stagingGoMod))
+	b, err := os.ReadFile(conflictFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConflict := "module k8s.io/api\n\n" + conflictMarker + "HEAD\nrequire k8s.io/apimachinery v1.30.2\n=======\nrequire k8s.io/apimachinery v1.30.1-k3s1\n>>>>>>> " + conflicting.Hash.String()[:12] + " (commit)\n"
+	if string(b) != wantConflict {
+		t.Fatalf("%s = %q, want conflict markers around the conflicting line", stagingGoMod, b)
+	}
+
+	if _, err := continueNativeRebase(r, u, state); err == nil {
+		t.Fatal("expected an error continuing with conflict markers")
+	}
+
+	resolved := strings.Replace(goMod, "v0.0.0", "v1.30.2-k3s1", 1)
+	if err := os.WriteFile(conflictFile, []byte(resolved), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// other edits made while resolving are committed too
+	if err := os.WriteFile(filepath.Join(r.Workspace, "kubernetes", "fix.go"), []byte("fix\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := continueNativeRebase(r, u, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames := []string{stagingModulesPath + "/api/v1.30.2-k3s1", "v1.30.2-k3s1"}
+	if len(tags) != len(wantNames) {
+		t.Fatalf("tags = %v, want %v", tags, wantNames)
+	}
+	for i, tag := range tags {
+		if tag.Name != wantNames[i] || tag.Commit != tags[len(tags)-1].Commit {
+			t.Errorf("tag %d = %v, want %s at the rebased commit", i, tag, wantNames[i])
+		}
+		ref, err := repo.Tag(tag.Name)
+		if err != nil || ref.Hash() != tag.Commit {
+			t.Errorf("tag %s in the repo = %v, %v, want %s", tag.Name, ref, err, tag.Commit)
+		}
+	}
+
+	wantFiles := map[string]string{stagingGoMod: resolved, "fix.go": "fix\n", "k3s.go": "k3s\n"}
+	if got := treeFiles(t, s, tags[len(tags)-1].Commit); !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("files = %q, want %q", got, wantFiles)
+	}
+}
+
+func TestConflictContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		ours   string
+		theirs string
+		exists bool
+		want   string
+	}{
+		{
+			name:   "modified on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nours\nc\n",
+			theirs: "a\ntheirs\nc\n",
+			exists: true,
+			want:   "a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> abc (fix)\nc\n",
+		},
+		{
+			name:   "deleted upstream",
+			base:   "a\n",
+			theirs: "theirs\n",
+			want:   "<<<<<<< HEAD\n=======\ntheirs\n>>>>>>> abc (fix)\n",
+		},
+		{
+			name:   "binary",
+			base:   "a\x00",
+			ours:   "ours",
+			theirs: "theirs\n",
+			exists: true,
+			want:   "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> abc (fix)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(conflictContent([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), tt.exists, "abc (fix)"))
+			if got != tt.want {
+				t.Errorf("conflictContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbortTags(t *testing.T) {
+	r := &ecmConfig.K3sRelease{Workspace: t.TempDir(), NewK8sVersion: "v1.30.2", NewSuffix: "k3s1"}
+	u := &ecmConfig.User{GithubUsername: "k3s", Email: "k3s@example.com"}
+
+	repo, err := git.PlainInit(filepath.Join(r.Workspace, "kubernetes"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := repo.Storer
+
+	old := storeCommit(t, s, nil, map[string]string{"go.mod": "v0.0.0\n"})
+	conflicting := storeCommit(t, s, old, map[string]string{"go.mod": "v1.30.1-k3s1\n"})
+	onto := storeCommit(t, s, old, map[string]string{"go.mod": "v1.30.2\n"})
+
+	branch := plumbing.NewBranchReferenceName("k3s")
+	if err := s.SetReference(plumbing.NewHashReference(branch, old.Hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &rebaseState{OrigHead: old.Hash.String(), OrigBranch: branch.String()}
+	if _, err := replay(repo, r, u, state, onto.Hash, []*object.Commit{conflicting}); err == nil {
+		t.Fatal("expected a conflict")
+	}
+
+	if err := AbortTags(r); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Name() != branch || head.Hash() != old.Hash {
+		t.Errorf("HEAD = %s at %s, want %s at %s", head.Name(), head.Hash(), branch, old.Hash)
+	}
+	if _, err := os.Stat(rebaseStateFile(r)); !os.IsNotExist(err) {
+		t.Errorf("expected the rebase state to be removed, got %v", err)
+	}
+}
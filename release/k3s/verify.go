@@ -0,0 +1,203 @@
+package k3s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release"
+)
+
+const (
+	TagOK       = "ok"
+	TagMissing  = "missing"
+	TagMismatch = "mismatch"
+)
+
+// TagCheck is the result of verifying a single tag on the k3s-io remote.
+type TagCheck struct {
+	Name   string
+	Local  plumbing.Hash
+	Remote plumbing.Hash
+	Status string
+}
+
+// VerifyTags checks that every tag in the tags file, and every staging
+// module tag of the release, exists on the k3s-io remote and points to the
+// commit it was created at. The results are written to w and an error is
+// returned if any tag is missing or mismatched.
+func VerifyTags(r *ecmConfig.K3sRelease, sshKeyPath string, w io.Writer) error {
+	tags, err := tagsFromFile(r)
+	if err != nil {
+		return errors.New("failed to extract tags from file: " + err.Error())
+	}
+
+	dir := filepath.Join(r.Workspace, "kubernetes")
+
+	fmt.Println("opening kubernetes repo")
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+
+	// tags files written by tag.sh don't have the commits
+	for i, tag := range tags {
+		if !tag.Commit.IsZero() {
+			continue
+		}
+		h, err := repo.ResolveRevision(plumbing.Revision("refs/tags/" + tag.Name))
+		if err != nil {
+			return errors.New("failed to resolve tag " + tag.Name + ": " + err.Error())
+		}
+		tags[i].Commit = *h
+	}
+
+	expected, err := expectedTags(repo, r.NewK8sVersion+"-"+r.NewSuffix)
+	if err != nil {
+		return errors.New("failed to list staging modules: " + err.Error())
+	}
+
+	fmt.Println("getting remote: " + r.K3sRepoOwner)
+	remote, err := repo.Remote(r.K3sRepoOwner)
+	if err != nil {
+		return errors.New("failed to find remote: '" + r.K3sRepoOwner + "' " + err.Error())
+	}
+
+	fmt.Println("getting ssh key auth")
+	gitAuth, err := release.GitSSHAuth(sshKeyPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("listing remote tags")
+	refs, err := remote.List(&git.ListOptions{Auth: gitAuth})
+	if err != nil {
+		return errors.New("failed to list remote refs: " + err.Error())
+	}
+
+	checks := checkTags(tags, expected, remoteTags(refs))
+
+	return printTagChecks(w, checks)
+}
+
+// expectedTags returns the tags the release should have, based on the
+// staging modules at the commit of the release tag.
+func expectedTags(repo *git.Repository, tagVersion string) ([]string, error) {
+	h, err := repo.ResolveRevision(plumbing.Revision("refs/tags/" + tagVersion))
+	if err != nil {
+		return nil, errors.New("failed to resolve tag " + tagVersion + ": " + err.Error())
+	}
+	commit, err := repo.CommitObject(*h)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return tagNames(tree, tagVersion)
+}
+
+// remoteTags maps the tag refs to the commit they point to, annotated tags
+// are resolved to their peeled commit.
+func remoteTags(refs []*plumbing.Reference) map[string]plumbing.Hash {
+	tags := make(map[string]plumbing.Hash)
+
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		name := ref.Name().Short()
+		if peeled, ok := strings.CutSuffix(name, "^{}"); ok {
+			tags[peeled] = ref.Hash()
+			continue
+		}
+		if _, ok := tags[name]; !ok {
+			tags[name] = ref.Hash()
+		}
+	}
+
+	return tags
+}
+
+// checkTags compares the local tags with the remote ones. Expected tags
+// which aren't in the local list are reported as missing too.
+func checkTags(local []Tag, expected []string, remote map[string]plumbing.Hash) []TagCheck {
+	checks := make([]TagCheck, 0, len(local))
+	seen := make(map[string]bool)
+
+	for _, tag := range local {
+		seen[tag.Name] = true
+
+		check := TagCheck{Name: tag.Name, Local: tag.Commit, Status: TagOK}
+		remoteCommit, ok := remote[tag.Name]
+		switch {
+		case !ok:
+			check.Status = TagMissing
+		case remoteCommit != tag.Commit:
+			check.Remote = remoteCommit
+			check.Status = TagMismatch
+		default:
+			check.Remote = remoteCommit
+		}
+		checks = append(checks, check)
+	}
+
+	for _, name := range expected {
+		if seen[name] {
+			continue
+		}
+		check := TagCheck{Name: name, Status: TagMissing}
+		if remoteCommit, ok := remote[name]; ok {
+			check.Remote = remoteCommit
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func printTagChecks(w io.Writer, checks []TagCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "tag\tlocal\tremote\tstatus")
+	fmt.Fprintln(tw, "---\t-----\t------\t------")
+
+	var failed int
+	for _, check := range checks {
+		if check.Status != TagOK {
+			failed++
+		}
+		tw.Write([]byte(strings.Join([]string{
+			check.Name,
+			shortHash(check.Local),
+			shortHash(check.Remote),
+			check.Status,
+		}, "\t") + "\n"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(checks)) + " tags missing or mismatched")
+	}
+
+	return nil
+}
+
+func shortHash(h plumbing.Hash) string {
+	if h.IsZero() {
+		return ""
+	}
+	return h.String()[:12]
+}
@@ -0,0 +1,56 @@
+package k3s
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestRemoteTags(t *testing.T) {
+	tagObj := plumbing.NewHash("1111111111111111111111111111111111111111")
+	commit := plumbing.NewHash("2222222222222222222222222222222222222222")
+
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", commit),
+		plumbing.NewHashReference("refs/tags/v1.30.2-k3s1", commit),
+		plumbing.NewHashReference("refs/tags/v1.30.1-k3s1", tagObj),
+		plumbing.NewHashReference("refs/tags/v1.30.1-k3s1^{}", commit),
+	}
+
+	want := map[string]plumbing.Hash{"v1.30.2-k3s1": commit, "v1.30.1-k3s1": commit}
+	if got := remoteTags(refs); !reflect.DeepEqual(got, want) {
+		t.Errorf("remoteTags() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckTags(t *testing.T) {
+	commit := plumbing.NewHash("2222222222222222222222222222222222222222")
+	other := plumbing.NewHash("3333333333333333333333333333333333333333")
+
+	local := []Tag{
+		{Name: "staging/src/k8s.io/api/v1.30.2-k3s1", Commit: commit},
+		{Name: "staging/src/k8s.io/apimachinery/v1.30.2-k3s1", Commit: commit},
+		{Name: "v1.30.2-k3s1", Commit: commit},
+	}
+	expected := []string{
+		"staging/src/k8s.io/api/v1.30.2-k3s1",
+		"staging/src/k8s.io/apimachinery/v1.30.2-k3s1",
+		"staging/src/k8s.io/client-go/v1.30.2-k3s1",
+		"v1.30.2-k3s1",
+	}
+	remote := map[string]plumbing.Hash{
+		"staging/src/k8s.io/api/v1.30.2-k3s1":          commit,
+		"staging/src/k8s.io/apimachinery/v1.30.2-k3s1": other,
+	}
+
+	want := []TagCheck{
+		{Name: "staging/src/k8s.io/api/v1.30.2-k3s1", Local: commit, Remote: commit, Status: TagOK},
+		{Name: "staging/src/k8s.io/apimachinery/v1.30.2-k3s1", Local: commit, Remote: other, Status: TagMismatch},
+		{Name: "v1.30.2-k3s1", Local: commit, Status: TagMissing},
+		{Name: "staging/src/k8s.io/client-go/v1.30.2-k3s1", Status: TagMissing},
+	}
+	if got := checkTags(local, expected, remote); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkTags() = %+v, want %+v", got, want)
+	}
+}
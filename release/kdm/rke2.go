@@ -6,10 +6,9 @@ import (
 	"fmt"
 	"os"
 	"slices"
-	"strconv"
 	"strings"
 
-	"github.com/Masterminds/semver/v3"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"go.yaml.in/yaml/v3"
 )
 
@@ -235,28 +234,17 @@ func (u *RKE2ChannelsUpdater) rke2LatestMinor(major, minor int) (string, error)
 
 // parseRKE2Version receives a version in this format: vX.Y.Z+rke2rN
 // and returns the major, minor, patch, and release numbers as integers.
-func parseRKE2Version(version string) (int, int, int, int, error) {
-	v, err := semver.NewVersion(version)
+func parseRKE2Version(rke2Version string) (int, int, int, int, error) {
+	v, err := version.Parse(rke2Version)
 	if err != nil {
-		return 0, 0, 0, 0, fmt.Errorf("failed to parse version '%s': %w", version, err)
+		return 0, 0, 0, 0, fmt.Errorf("failed to parse version '%s': %w", rke2Version, err)
 	}
 
-	major := int(v.Major())
-	minor := int(v.Minor())
-	patch := int(v.Patch())
-
-	metadata := v.Metadata()
-	if !strings.HasPrefix(metadata, "rke2r") {
-		return 0, 0, 0, 0, fmt.Errorf("invalid metadata format: expected 'rke2r' but got %q", metadata)
-	}
-
-	releaseStr := strings.TrimPrefix(metadata, "rke2r")
-	release, err := strconv.Atoi(releaseStr)
-	if err != nil {
-		return 0, 0, 0, 0, fmt.Errorf("invalid release version part %q: %w", releaseStr, err)
+	if v.Metadata.Label != "rke2r" || v.Metadata.Number == 0 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid metadata format: expected 'rke2rN' but got %q", v.Metadata.String())
 	}
 
-	return major, minor, patch, release, nil
+	return int(v.Major), int(v.Minor), int(v.Patch), v.Metadata.Number, nil
 }
 
 func (u *RKE2ChannelsUpdater) addRelease(release Release) error {
@@ -0,0 +1,78 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+// Promotion describes the pre-release a GA tag is promoted from and the
+// commits merged to the release branch since that pre-release was tagged.
+type Promotion struct {
+	PreRelease string
+	SHA        string
+	Branch     string
+	Status     string
+	NewCommits []*github.RepositoryCommit
+}
+
+// NewPromotion resolves the commit the given pre-release tag points at and
+// compares it with the head of the release branch.
+func NewPromotion(ctx context.Context, client *github.Client, owner, repo, branch, preRelease string) (*Promotion, error) {
+	if preRelease == "" {
+		return nil, errors.New("invalid pre-release provided")
+	}
+
+	sha, err := repository.RefCommitSHA(ctx, client, owner, repo, "tags/"+preRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	comp, _, err := client.Repositories.CompareCommits(ctx, owner, repo, sha, branch, &github.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("comparing %s with %s: %w", preRelease, branch, err)
+	}
+
+	return &Promotion{
+		PreRelease: preRelease,
+		SHA:        sha,
+		Branch:     branch,
+		Status:     comp.GetStatus(),
+		NewCommits: comp.Commits,
+	}, nil
+}
+
+// Validate returns an error if the release branch has moved since the
+// pre-release was tagged, unless new commits are explicitly allowed.
+func (p *Promotion) Validate(allowNewCommits bool) error {
+	if p.Status == "diverged" {
+		return errors.New(p.PreRelease + " is not part of the history of " + p.Branch)
+	}
+
+	if len(p.NewCommits) > 0 && !allowNewCommits {
+		return fmt.Errorf("%d commit(s) merged to %s since %s, use --allow-new-commits to promote anyway", len(p.NewCommits), p.Branch, p.PreRelease)
+	}
+
+	return nil
+}
+
+// Print writes the pre-release commit and the commits merged since then.
+func (p *Promotion) Print(w io.Writer) {
+	fmt.Fprintln(w, "promoting "+p.PreRelease+": "+p.SHA)
+
+	if len(p.NewCommits) == 0 {
+		fmt.Fprintln(w, "no commits merged to "+p.Branch+" since "+p.PreRelease)
+		return
+	}
+
+	fmt.Fprintf(w, "%d commit(s) merged to %s since %s:\n", len(p.NewCommits), p.Branch, p.PreRelease)
+	for _, c := range p.NewCommits {
+		message, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+		fmt.Fprintf(w, "  %.12s %s\n", c.GetSHA(), message)
+	}
+}
@@ -5,18 +5,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
@@ -24,25 +21,18 @@ import (
 	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
 	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	ecmHTTP "github.com/rancher/ecm-distro-tools/http"
+	"github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/cli"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"golang.org/x/mod/semver"
-	"golang.org/x/sync/errgroup"
 	"sigs.k8s.io/yaml"
 )
 
 const (
 	rancherOrg                    = "rancher"
 	rancherRepo                   = rancherOrg
-	rancherRegistryBaseURL        = "https://registry.rancher.com"
-	stagingRancherRegistryBaseURL = "https://stgregistry.suse.com"
-	sccSUSEURL                    = "https://scc.suse.com/api/registry/authorize"
-	stagingSccSUSEURL             = "https://stgscc.suse.com/api/registry/authorize"
-	dockerRegistryURL             = "https://registry-1.docker.io"
-	dockerAuthURL                 = "https://auth.docker.io/token"
-	sccSUSEService                = "SUSE+Linux+Docker+Registry"
-	dockerService                 = "registry.docker.io"
 	dashboardUpdateRefsBranchBase = "update-dashboard-refs"
 )
 
@@ -66,38 +56,6 @@ var regsyncDefaultMediaTypes = []string{
 	"application/vnd.oci.image.index.v1+json",
 }
 
-var registriesInfo = map[string]registryInfo{
-	"registry.rancher.com": {
-		BaseURL:     rancherRegistryBaseURL,
-		AuthURL:     sccSUSEURL,
-		Service:     sccSUSEService,
-		UserEnv:     `{{env "PRIME_REGISTRY_USERNAME"}}`,
-		PasswordEnv: `{{env "PRIME_REGISTRY_PASSWORD"}}`,
-	},
-	"stgregistry.suse.com": {
-		BaseURL:     stagingRancherRegistryBaseURL,
-		AuthURL:     stagingSccSUSEURL,
-		Service:     sccSUSEService,
-		UserEnv:     `{{env "STAGING_REGISTRY_USERNAME"}}`,
-		PasswordEnv: `{{env "STAGING_REGISTRY_PASSWORD"}}`,
-	},
-	"docker.io": {
-		BaseURL:     dockerRegistryURL,
-		AuthURL:     dockerAuthURL,
-		Service:     dockerService,
-		UserEnv:     `{{env "DOCKERIO_REGISTRY_USERNAME"}}`,
-		PasswordEnv: `{{env "DOCKERIO_REGISTRY_PASSWORD"}}`,
-	},
-}
-
-type registryInfo struct {
-	BaseURL     string
-	AuthURL     string
-	Service     string
-	UserEnv     string
-	PasswordEnv string
-}
-
 type imageDigest map[string]string
 
 type RancherRCDepsLine struct {
@@ -114,10 +72,6 @@ type RancherRCDeps struct {
 	KDMWithDev     []RancherRCDepsLine `json:"kdmWithDev"`
 }
 
-type registryAuthToken struct {
-	Token string `json:"token"`
-}
-
 type regsyncConfig struct {
 	Version  int             `json:"version"`
 	Creds    []regsyncCreds  `json:"creds"`
@@ -263,7 +217,8 @@ func ReleaseBranchFromTag(tag string) (string, error) {
 // If the tag to be created is a pre-release (rc or alpha) it will automatically find the latest tag and add one to it. E.g: v2.14.0 (pre-release) -> v2.14.0-alpha2
 // Returns tag, commit sha, error
 func CreateTag(ctx context.Context, ghClient *github.Client, owner, repo, baseTag, sha, branch, releaseType string, preRelease, dryRun bool) (string, string, error) {
-	if !semver.IsValid(baseTag) {
+	baseVersion, err := version.Parse(baseTag)
+	if err != nil {
 		return "", "", errors.New("the base tag is invalid: " + baseTag)
 	}
 
@@ -275,37 +230,28 @@ func CreateTag(ctx context.Context, ghClient *github.Client, owner, repo, baseTa
 		sha = commitSHA
 	}
 
-	tag := baseTag
+	tagVersion := version.Rancher.GA(baseVersion)
 
 	if preRelease {
-		latestVersionNumber := 1
-		latestVersion, err := release.LatestPreRelease(ctx, ghClient, owner, repo, baseTag, releaseType)
+		latestVersion, err := release.LatestPreRelease(ctx, ghClient, owner, repo, baseVersion, releaseType, version.Rancher)
 		if err != nil {
 			return "", "", err
 		}
 
-		if latestVersion != nil {
-			trimmedVersionNumber := strings.TrimPrefix(*latestVersion, baseTag+"-"+releaseType)
-			currentVersionNumber, err := strconv.Atoi(trimmedVersionNumber)
-			if err != nil {
-				return "", "", errors.New("failed to parse trimmed latest version number: " + err.Error())
-			}
-			latestVersionNumber = currentVersionNumber + 1
+		tagVersion, err = version.Rancher.Next(baseVersion, releaseType, latestVersion)
+		if err != nil {
+			return "", "", err
 		}
-		tag = baseTag + "-" + releaseType + strconv.Itoa(latestVersionNumber)
 	}
 
-	if !semver.IsValid(tag) {
-		return "", "", errors.New("the tag is invalid: " + tag)
-	}
+	tag := tagVersion.String()
 
 	if dryRun {
 		fmt.Println("dry run, skipping creating tag")
 		return tag, sha, nil
 	}
 
-	_, _, err := ghClient.Git.CreateRef(ctx, owner, repo, github.CreateRef{Ref: "refs/tags/" + tag, SHA: sha})
-	if err != nil {
+	if _, _, err := ghClient.Git.CreateRef(ctx, owner, repo, github.CreateRef{Ref: "refs/tags/" + tag, SHA: sha}); err != nil {
 		return "", "", err
 	}
 	return tag, sha, nil
@@ -400,147 +346,8 @@ func formatContentLine(line string) string {
 	return strings.TrimSpace(line)
 }
 
-// ImagesLocations searches for missing images in a registry and creates a map with the locations of the images, or if they are missing
-// this map can be used to identify where which image should be synced from
-func ImagesLocations(username, password string, concurrencyLimit int, checkImages, ignoreImages []string, targetRegistry string, imagesRegiestries []string) (map[string][]string, error) {
-	imagesLocations := make(map[string][]string)
-
-	missingFromTarget, err := MissingImagesFromRegistry(username, password, targetRegistry, concurrencyLimit, checkImages, ignoreImages)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check missing images from target registry: %w", err)
-	}
-
-	lastMissingImages := missingFromTarget
-	for _, registry := range imagesRegiestries {
-		missingFromRegistry, err := MissingImagesFromRegistry(username, password, registry, concurrencyLimit, lastMissingImages, ignoreImages)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check missing images from registry: %w", err)
-		}
-
-		imagesLocations[registry], err = imagesDiff(lastMissingImages, missingFromRegistry)
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate image diff for registry: %w", err)
-		}
-
-		lastMissingImages = missingFromRegistry
-	}
-
-	if lastMissingImages == nil {
-		lastMissingImages = make([]string, 0)
-	}
-	imagesLocations["missing"] = lastMissingImages
-
-	return imagesLocations, nil
-}
-
-// imagesDiff compares two images slices and returns a slice with all images that are in the source slice, but not in the compare slice
-func imagesDiff(source, compare []string) ([]string, error) {
-	cm, err := imageSliceToMap(compare, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create map from compare images: %w", err)
-	}
-
-	diff := make([]string, 0)
-
-	for _, s := range source {
-		if _, ok := cm[s]; !ok {
-			diff = append(diff, s)
-		}
-	}
-
-	return diff, nil
-}
-
-// MissingImagesFromRegistry receives registry information and a list of images and checks which images are missing from that registry
-// it uses the docker http api v2 to check images concurrently
-func MissingImagesFromRegistry(username, password, registry string, concurrencyLimit int, checkImages, ignoreImages []string) ([]string, error) {
-	ignore, err := imageSliceToMap(ignoreImages, true)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ignore list from ignoreImages: %w", err)
-	}
-
-	// create an error group with a limit to prevent accidentaly doing a DOS attack against our registry
-	ctx, cancel := context.WithCancel(context.Background())
-	errGroup, ctx := errgroup.WithContext(ctx)
-	errGroup.SetLimit(concurrencyLimit)
-	missingImagesChan := make(chan string, len(checkImages))
-
-	// auth tokens can be reused, but maps need a lock for reading and writing in go routines
-	repositoryAuths := make(map[string]string)
-	mu := sync.RWMutex{}
-
-	rgInfo, ok := registriesInfo[registry]
-	if !ok {
-		cancel()
-		return nil, errors.New("registry must be one of the following: 'docker.io', 'registry.rancher.com' or 'stgregistry.suse.com'")
-	}
-
-	for _, imageAndVersion := range checkImages {
-		image, imageVersion, err := splitImageAndVersion(imageAndVersion)
-		if err != nil {
-			cancel()
-			return nil, fmt.Errorf("failed to split image and version: %w", err)
-		}
-
-		if _, ok := ignore[image]; ok {
-			continue
-		}
-
-		func(ctx context.Context, missingImagesChan chan string, image, imageVersion, username, password string, repositoryAuths map[string]string, mu *sync.RWMutex) {
-			errGroup.Go(func() error {
-				// if any other check failed, stop running to prevent wasting resources
-				// this doesn't include 404's since it is expected. Any other errors are included
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-					mu.Lock()
-
-					var ok bool
-					var auth string
-					var err error
-
-					auth, ok = repositoryAuths[image]
-					if !ok {
-						auth, err = registryAuth(rgInfo.AuthURL, rgInfo.Service, image, username, password)
-						if err != nil {
-							cancel()
-							return fmt.Errorf("failed to authenticate with registry: %w", err)
-						}
-						repositoryAuths[image] = auth
-					}
-					mu.Unlock()
-
-					exists, err := checkIfImageExists(rgInfo.BaseURL, image, imageVersion, auth)
-					if err != nil {
-						cancel()
-						return fmt.Errorf("failed to check if image exists: %w", err)
-					}
-
-					fullImage := image + ":" + imageVersion
-					if !exists {
-						missingImagesChan <- fullImage
-					}
-					return nil
-				}
-			})
-		}(ctx, missingImagesChan, image, imageVersion, username, password, repositoryAuths, &mu)
-
-	}
-	if err := errGroup.Wait(); err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to check images in registry: %w", err)
-	}
-	cancel()
-
-	close(missingImagesChan)
-	missingImages := readStringChan(missingImagesChan)
-
-	return missingImages, nil
-}
-
-func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, outputPath string) error {
-	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry)
+func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry string, registries map[string]ecmConfig.Registry, outputPath string) error {
+	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry, registries)
 	if err != nil {
 		return err
 	}
@@ -553,30 +360,14 @@ func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, o
 	return os.WriteFile(outputPath, b, 0o644)
 }
 
-func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry string) (*regsyncConfig, error) {
-	sourceRegistryInfo, ok := registriesInfo[sourceRegistry]
-	if !ok {
-		return nil, errors.New("invalid source registry")
-	}
-	targetRegistryInfo, ok := registriesInfo[targetRegistry]
-	if !ok {
-		return nil, errors.New("invalid target registry")
-	}
-
+// generateRegsyncConfig creates the config to sync images from the source
+// to the target registry. Registries are authenticated with the credentials
+// of the environment variables of their definition, or else the docker
+// config ones.
+func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry string, registries map[string]ecmConfig.Registry) (*regsyncConfig, error) {
 	config := regsyncConfig{
 		Version: 1,
-		Creds: []regsyncCreds{
-			{
-				Registry: sourceRegistry,
-				User:     sourceRegistryInfo.UserEnv,
-				Pass:     sourceRegistryInfo.PasswordEnv,
-			},
-			{
-				Registry: targetRegistry,
-				User:     targetRegistryInfo.UserEnv,
-				Pass:     targetRegistryInfo.PasswordEnv,
-			},
-		},
+		Creds:   make([]regsyncCreds, 0),
 		Defaults: regsyncDefaults{
 			Parallel:   1,
 			MediaTypes: regsyncDefaultMediaTypes,
@@ -584,6 +375,16 @@ func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry strin
 		Sync: make([]regsyncSync, len(images)),
 	}
 
+	for _, host := range []string{sourceRegistry, targetRegistry} {
+		if definition, ok := registries[host]; ok && definition.UsernameEnv != "" {
+			config.Creds = append(config.Creds, regsyncCreds{
+				Registry: host,
+				User:     `{{env "` + definition.UsernameEnv + `"}}`,
+				Pass:     `{{env "` + definition.PasswordEnv + `"}}`,
+			})
+		}
+	}
+
 	for i, imageAndVersion := range images {
 		image, imageVersion, err := splitImageAndVersion(imageAndVersion)
 		if err != nil {
@@ -599,19 +400,6 @@ func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry strin
 	return &config, nil
 }
 
-func imageSliceToMap(images []string, validate bool) (map[string]bool, error) {
-	imagesMap := make(map[string]bool, len(images))
-	for _, image := range images {
-		if validate {
-			if err := validateRepoImage(image); err != nil {
-				return nil, fmt.Errorf("failed to validate image: %w", err)
-			}
-		}
-		imagesMap[image] = true
-	}
-	return imagesMap, nil
-}
-
 // splitImageAndVersion will validate the image format and return
 // repo/image, version and any validation errors
 // e.g: rancher/rancher-agent:v2.9.0
@@ -640,7 +428,10 @@ func validateRepoImage(repoImage string) error {
 	return nil
 }
 
-func GenerateDockerImageDigests(outputFile, imagesFileURL, registry, username, password string, imagesList []string, verbose bool) error {
+// GenerateDockerImageDigests writes the digests of the images of imagesList,
+// or else of the images list artifact at imagesFileURL, in the registry of
+// client to outputFile.
+func GenerateDockerImageDigests(ctx context.Context, outputFile, imagesFileURL string, client *registry.Client, imagesList []string) error {
 	var err error
 	if len(imagesList) == 0 {
 		if imagesFileURL == "" {
@@ -652,50 +443,11 @@ func GenerateDockerImageDigests(outputFile, imagesFileURL, registry, username, p
 		}
 	}
 
-	imagesList = cleanImages(imagesList, registry)
-
-	imagesDigests, err := dockerImagesDigests(imagesList, registry, username, password)
+	imagesDigests, err := client.ImageDigests(ctx, imagesList)
 	if err != nil {
 		return err
 	}
-	return createAssetFile(outputFile, imagesDigests)
-}
-
-func dockerImagesDigests(imagesList []string, registry, username, password string) (imageDigest, error) {
-	rgInfo, ok := registriesInfo[registry]
-	if !ok {
-		return nil, errors.New("registry must be one of the following: 'docker.io', 'registry.rancher.com' or 'stgregistry.suse.com'")
-	}
-
-	imagesDigests := make(imageDigest)
-	repositoryAuths := make(map[string]string)
-
-	for _, imageAndVersion := range imagesList {
-		if imageAndVersion == "" || imageAndVersion == " " {
-			continue
-		}
-		if !strings.Contains(imageAndVersion, ":") {
-			return nil, errors.New("malformed image name: , missing ':'")
-		}
-		splitImage := strings.Split(imageAndVersion, ":")
-		image := splitImage[0]
-		imageVersion := splitImage[1]
-
-		if _, ok := repositoryAuths[image]; !ok {
-			auth, err := registryAuth(rgInfo.AuthURL, rgInfo.Service, image, username, password)
-			if err != nil {
-				return nil, err
-			}
-			repositoryAuths[image] = auth
-		}
-		digest, _, err := dockerImageDigest(rgInfo.BaseURL, image, imageVersion, repositoryAuths[image])
-		if err != nil {
-			return nil, err
-		}
-		// e.g: registry.rancher.com/rancher/rancher:v2.9.0 = sha256:1234567890
-		imagesDigests[registry+"/"+imageAndVersion] = digest
-	}
-	return imagesDigests, nil
+	return createAssetFile(outputFile, imageDigest(imagesDigests))
 }
 
 func createAssetFile(outputFile string, contents fmt.Stringer) (err error) {
@@ -737,28 +489,6 @@ func artifactImageList(imagesFileURL string) (list []string, err error) {
 	return list, nil
 }
 
-func cleanImages(images []string, registry string) []string {
-	for k, im := range images {
-		if im == "" || im == " " {
-			continue
-		}
-		image := cleanImage(im, registry)
-		images[k] = image
-	}
-	return images
-}
-
-func cleanImage(image, registry string) string {
-	switch registry {
-	case "docker.io":
-		if len(strings.Split(image, "/")) == 1 {
-			image = path.Join("library", image)
-		}
-	}
-
-	return image
-}
-
 func (d imageDigest) String() string {
 	var o strings.Builder
 	keys := make([]string, 0, len(d))
@@ -784,96 +514,6 @@ func getLinesFromReader(body io.Reader) ([]string, error) {
 	return strings.Split(string(lines), "\n"), nil
 }
 
-func dockerImageDigest(registryBaseURL, img, imgVersion, auth string) (dockerDigest string, statusCode int, err error) {
-	httpClient := ecmHTTP.NewClient(time.Second * 15)
-	req, err := http.NewRequest("GET", registryBaseURL+"/v2/"+img+"/manifests/"+imgVersion, nil)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to create HTTP request for image manifest: %w", err)
-	}
-
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+prettyjws")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.list.v2+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("Docker-Distribution-Api-Version", "registry/2.0")
-	req.Header.Add("Authorization", "Bearer "+auth)
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to execute HTTP request for image manifest: %w", err)
-	}
-	defer func() {
-		if closeErr := errors.Join(res.Body.Close()); closeErr != nil {
-			err = errors.Join(err, closeErr)
-		}
-	}()
-
-	// if the status is 404, the image exists, but the tag doesn't
-	if res.StatusCode == http.StatusNotFound {
-		return "", res.StatusCode, nil
-	}
-	// if the status is 401, the image doesn't exit on this registry
-	if res.StatusCode == http.StatusUnauthorized {
-		return "", res.StatusCode, nil
-	}
-	dockerDigest = res.Header.Get("Docker-Content-Digest")
-
-	return dockerDigest, res.StatusCode, nil
-}
-
-func checkIfImageExists(registryBaseURL, img, imgVersion, auth string) (bool, error) {
-	_, statusCode, err := dockerImageDigest(registryBaseURL, img, imgVersion, auth)
-	if err != nil {
-		return false, fmt.Errorf("failed to get image digest: %w", err)
-	}
-	if statusCode == http.StatusNotFound {
-		return false, nil
-	}
-	// unauthorized is not a hard fail because it is a valid response when the image doesn't exist on the registry, even though the creds are valid
-	if statusCode == http.StatusUnauthorized {
-		return false, nil
-	}
-	if statusCode != http.StatusOK {
-		return false, fmt.Errorf("unexpected status code when checking image: expected 200, got %d", statusCode)
-	}
-
-	return true, nil
-}
-
-func registryAuth(authURL, service, image, username, password string) (token string, err error) {
-	httpClient := ecmHTTP.NewClient(time.Second * 15)
-	scope := "repository:" + image + ":pull"
-	url := authURL + "?scope=" + scope + "&service=" + service
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create auth request: %w", err)
-	}
-	if len(username) > 1 && len(password) > 1 {
-		req.SetBasicAuth(username, password)
-	}
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to execute auth request: %w", err)
-	}
-	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("authentication failed: expected status 200, got %d", res.StatusCode)
-	}
-	defer func() {
-		if closeErr := errors.Join(res.Body.Close()); closeErr != nil {
-			err = errors.Join(err, closeErr)
-		}
-	}()
-
-	var auth registryAuthToken
-	if err := json.NewDecoder(res.Body).Decode(&auth); err != nil {
-		return "", fmt.Errorf("failed to decode auth token: %w", err)
-	}
-
-	return auth.Token, nil
-}
-
 func ImagesFromArtifact(url string) (images []string, err error) {
 	httpClient := ecmHTTP.NewClient(time.Second * 15)
 	res, err := httpClient.Get(url)
@@ -899,15 +539,6 @@ func ImagesFromArtifact(url string) (images []string, err error) {
 	return file, nil
 }
 
-func readStringChan(ch <-chan string) []string {
-	var data []string
-	for s := range ch {
-		data = append(data, s)
-	}
-
-	return data
-}
-
 const checkRancherRCDepsTemplate = `{{- define "componentsFile" -}}
 # Images with -rc
 {{range .RancherImages}}
@@ -1,6 +1,10 @@
 package rancher
 
-import "testing"
+import (
+	"testing"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+)
 
 const (
 	rancherRepoImage = "rancher/rancher"
@@ -20,24 +24,6 @@ var (
 	}
 )
 
-func TestImageSliceToMap(t *testing.T) {
-	images, err := imageSliceToMap(imagesWithoutVersion, true)
-	if err != nil {
-		t.Error(err)
-	}
-	if _, ok := images[imagesWithoutVersion[0]]; !ok {
-		t.Error("expected image not found on map " + imagesWithoutVersion[0])
-	}
-	_, err = imageSliceToMap(imagesWithVersion, true)
-	if err == nil {
-		t.Error("expected to flag image with version as malformed")
-	}
-	_, err = imageSliceToMap(imagesWithVersion, false)
-	if err != nil {
-		t.Error("didn't expect to flag image with version as malformed")
-	}
-}
-
 func TestValidateRepoImage(t *testing.T) {
 	if err := validateRepoImage(rancherRepoImage); err != nil {
 		t.Error(err)
@@ -73,10 +59,13 @@ func TestGenerateRegsyncConfig(t *testing.T) {
 	sourceRancherImage := sourceRegistry + "/" + rancherImage
 	sourceRancherAgentImage := sourceRegistry + "/" + rancherAgentImage
 	targetRancherImage := targetRegistry + "/" + rancherImage
-	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry)
+	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry, ecmConfig.DefaultRegistries)
 	if err != nil {
 		t.Error(err)
 	}
+	if len(config.Creds) != 2 || config.Creds[1].User != `{{env "PRIME_REGISTRY_USERNAME"}}` {
+		t.Errorf("creds should use the environment variables of the registries, got: %+v", config.Creds)
+	}
 	if config.Sync[0].Source != sourceRancherImage {
 		t.Error("rancher image should be: '" + sourceRancherImage + "' instead, got: '" + config.Sync[0].Source + "'")
 	}
@@ -90,3 +79,16 @@ func TestGenerateRegsyncConfig(t *testing.T) {
 		t.Error("rancher agent image should be: '" + sourceRancherAgentImage + "' instead, got: '" + config.Sync[1].Source + "'")
 	}
 }
+
+func TestGenerateRegsyncConfigUndefinedRegistry(t *testing.T) {
+	config, err := generateRegsyncConfig([]string{"rancher/rancher:v2.9.0"}, "docker.io", "localhost:5000", ecmConfig.DefaultRegistries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Creds) != 1 || config.Creds[0].Registry != "docker.io" {
+		t.Errorf("only the defined registries should have creds, got: %+v", config.Creds)
+	}
+	if config.Sync[0].Target != "localhost:5000/rancher/rancher" {
+		t.Error("target rancher image should be: 'localhost:5000/rancher/rancher' instead, got: '" + config.Sync[0].Target + "'")
+	}
+}
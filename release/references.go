@@ -0,0 +1,186 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/pmezard/go-difflib/difflib"
+	ssh2 "golang.org/x/crypto/ssh"
+)
+
+// GitSSHAuth is a utility function which is used to get the ssh authentication method for connecting to an ssh server.
+// the function takes a single parameter, privateKey, which is a string representing the path to a private key file.
+// If the privateKey is an empty string, the function uses the default private key located at $HOME/.ssh/id_rsa.
+// The function then creates a new ssh.AuthMethod using the ssh.NewPublicKeysFromFile function, passing in the "git" user, the privateKey path, and an empty password.
+// If this returns an error, the function returns nil and the error.
+// Finally, the function returns the publicKeys variable, which is now an ssh.AuthMethod, and a nil error.
+func GitSSHAuth(privateKey string) (ssh.AuthMethod, error) {
+	if privateKey == "" {
+		privateKey = os.Getenv("HOME") + "/.ssh/id_rsa"
+	}
+
+	publicKeys, err := ssh.NewPublicKeysFromFile("git", privateKey, "")
+	if err != nil {
+		return nil, err
+	}
+	publicKeys.HostKeyCallback = ssh2.InsecureIgnoreHostKey()
+
+	return publicKeys, nil
+}
+
+// CloneOrOpen clones url into dir, or opens it if it's already cloned.
+func CloneOrOpen(dir, url string, auth transport.AuthMethod) (*git.Repository, error) {
+	fmt.Println("cloning " + url)
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:      url,
+		Auth:     auth,
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		if err != git.ErrRepositoryAlreadyExists {
+			return nil, err
+		}
+		fmt.Println("repo already exists, opening it")
+		return git.PlainOpen(dir)
+	}
+
+	return repo, nil
+}
+
+// CheckoutBranchFrom fetches remote, adding it with remoteURL if needed, and
+// checks out branch from the base branch of the remote, replacing branch if
+// it already exists. Untracked files are removed, and an error is returned
+// if there are uncommitted changes instead of discarding them.
+func CheckoutBranchFrom(repo *git.Repository, remote, remoteURL, base, branch string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	fmt.Println("creating remote: '" + remote + " " + remoteURL + "'")
+	if _, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: remote,
+		URLs: []string{remoteURL},
+	}); err != nil && err != git.ErrRemoteExists {
+		return "", err
+	}
+
+	fmt.Println("fetching remote: " + remote)
+	if err := repo.Fetch(&git.FetchOptions{
+		RemoteName: remote,
+		Auth:       auth,
+		Progress:   os.Stdout,
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", err
+	}
+
+	baseRef, err := repo.Reference(plumbing.NewRemoteReferenceName(remote, base), true)
+	if err != nil {
+		return "", errors.New("failed to find " + remote + "/" + base + ": " + err.Error())
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return "", err
+	}
+	for path, s := range status {
+		if s.Worktree != git.Untracked || s.Staging != git.Untracked {
+			return "", errors.New("repo has uncommitted changes in " + path + ", commit or stash them first")
+		}
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branch)
+
+	fmt.Println("checking out " + branch + " from " + remote + "/" + base)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branchRef, baseRef.Hash())); err != nil {
+		return "", err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Branch: branchRef, Force: true}); err != nil {
+		return "", err
+	}
+
+	fmt.Println("removing untracked files")
+	if err := wt.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return "", err
+	}
+
+	return branchRef, nil
+}
+
+// WriteFileDiffs writes a unified diff of each file in originals, keyed by
+// path relative to dir, against its current content.
+func WriteFileDiffs(w io.Writer, dir string, originals map[string][]byte) error {
+	paths := make([]string, 0, len(originals))
+	for path := range originals {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		b, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+		if err := difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(originals[path])),
+			B:        difflib.SplitLines(string(b)),
+			FromFile: "a/" + path,
+			ToFile:   "b/" + path,
+			Context:  3,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CommitSignedOff commits paths with a Signed-off-by trailer for the author.
+func CommitSignedOff(repo *git.Repository, paths []string, subject, name, email string) (plumbing.Hash, error) {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, path := range paths {
+		if _, err := wt.Add(path); err != nil {
+			return plumbing.ZeroHash, errors.New("failed to add " + path + ": " + err.Error())
+		}
+	}
+
+	signature := &object.Signature{Name: name, Email: email, When: time.Now()}
+	msg := subject + "\n\nSigned-off-by: " + name + " <" + email + ">\n"
+
+	fmt.Println("committing changes")
+	return wt.Commit(msg, &git.CommitOptions{Author: signature})
+}
+
+// PushBranch pushes branch to origin and sets it as its upstream.
+func PushBranch(repo *git.Repository, branch plumbing.ReferenceName, auth transport.AuthMethod) error {
+	fmt.Println("pushing " + branch.Short() + " to origin")
+	if err := repo.Push(&git.PushOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+		Progress:   os.Stdout,
+		RefSpecs:   []config.RefSpec{config.RefSpec(branch + ":" + branch)},
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return errors.New("failed to push " + branch.Short() + ": " + err.Error())
+	}
+
+	if err := repo.CreateBranch(&config.Branch{Name: branch.Short(), Remote: "origin", Merge: branch}); err != nil && err != git.ErrBranchExists {
+		return err
+	}
+
+	return nil
+}
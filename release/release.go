@@ -19,6 +19,7 @@ import (
 
 	"github.com/google/go-github/v90/github"
 	httpecm "github.com/rancher/ecm-distro-tools/http"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/mod/modfile"
@@ -497,7 +498,7 @@ func VerifyAssets(ctx context.Context, client *github.Client, owner, repo string
 			releases[tag] = true
 		}
 
-		if repo == "rke2-packing" && len(release.Assets) == rke2Packaging {
+		if repo == "rke2-packaging" && len(release.Assets) == rke2Packaging {
 			releases[tag] = true
 		}
 	}
@@ -784,54 +785,73 @@ func findInURL(url, regex, str string, checkStatusCode bool) []string {
 
 // LatestRC will get the latest rc created for the k8s version in either rke2 or k3s
 func LatestRC(ctx context.Context, owner, repo, k8sVersion, projectSuffix string, client *github.Client) (*string, error) {
-	var latestFoundRC *string
-	rcNumber := 1
+	v, err := version.Parse(k8sVersion)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		tagName := fmt.Sprintf("%s-rc%d+%s", k8sVersion, rcNumber, projectSuffix)
+	latestRC, err := LatestPreRelease(ctx, client, owner, repo, v, "rc", version.Distro(projectSuffix))
+	if err != nil || latestRC == nil {
+		return nil, err
+	}
+
+	found := latestRC.String()
+	return &found, nil
+}
+
+// LatestPreRelease returns the latest pre-release of v with the given label
+// (rc, alpha...) that is tagged in the repository, numbering the tags
+// according to the given scheme. It returns nil if there is none.
+func LatestPreRelease(ctx context.Context, client *github.Client, owner, repo string, v version.Version, preReleaseLabel string, scheme version.Scheme) (*version.Version, error) {
+	var latestFoundPreRelease *version.Version
 
-		ref := "tags/" + tagName
+	for preReleaseNumber := 1; ; preReleaseNumber++ {
+		preRelease := scheme.PreRelease(v, preReleaseLabel, preReleaseNumber)
+
+		ref := "tags/" + preRelease.String()
 
 		// checking if the tags exists in the repository
 		_, resp, err := client.Git.GetRef(ctx, owner, repo, ref)
 		if err != nil {
 			// if the call returns a 404 error it means that the tag doesn't exist
-			// and we can stop looking for more RCs, otherwise we return the error
+			// and we can stop looking for more pre-releases, otherwise we return the error
 			if resp != nil && resp.StatusCode == http.StatusNotFound {
 				break
 			}
 			return nil, err
 		}
-		found := tagName
-		latestFoundRC = &found
-		rcNumber++
+		latestFoundPreRelease = &preRelease
 	}
 
-	return latestFoundRC, nil
+	return latestFoundPreRelease, nil
 }
 
-func LatestPreRelease(ctx context.Context, client *github.Client, owner, repo, version, preReleaseSuffix string) (*string, error) {
-	var latestFoundPreRelease *string
-	preReleaseNumber := 1
-
-	for {
-		tagName := fmt.Sprintf("%s-%s%d", version, preReleaseSuffix, preReleaseNumber)
-
-		ref := "tags/" + tagName
+// NextTag returns the next RC of k8sVersion to tag in owner/repo, numbered
+// according to the given scheme, or its GA if rc isn't set, along with the
+// latest RC tagged, nil if there is none. A GA requires an RC.
+func NextTag(ctx context.Context, client *github.Client, owner, repo, k8sVersion string, scheme version.Scheme, rc bool) (string, *version.Version, error) {
+	v, err := version.Parse(k8sVersion)
+	if err != nil {
+		return "", nil, errors.New("invalid k8s version: " + k8sVersion)
+	}
 
-		_, resp, err := client.Git.GetRef(ctx, owner, repo, ref)
-		if err != nil {
-			if resp != nil && resp.StatusCode == http.StatusNotFound {
-				break
-			}
-			return nil, err
+	latestRC, err := LatestPreRelease(ctx, client, owner, repo, v, "rc", scheme)
+	if err != nil {
+		return "", nil, err
+	}
+	if !rc {
+		if latestRC == nil {
+			return "", nil, errors.New("couldn't find the latest RC")
 		}
-		found := tagName
-		latestFoundPreRelease = &found
-		preReleaseNumber++
+		return scheme.GA(v).String(), latestRC, nil
 	}
 
-	return latestFoundPreRelease, nil
+	nextRC, err := scheme.Next(v, "rc", latestRC)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return nextRC.String(), latestRC, nil
 }
 
 // StatsMonthly
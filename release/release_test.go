@@ -1,6 +1,16 @@
 package release
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/release/version"
+)
 
 func TestMajMin(t *testing.T) {
 	tests := []struct {
@@ -82,3 +92,156 @@ func TestCapitalize(t *testing.T) {
 		})
 	}
 }
+
+func TestPromotionValidate(t *testing.T) {
+	tests := []struct {
+		name            string
+		promotion       Promotion
+		allowNewCommits bool
+		wantErr         bool
+	}{
+		{
+			name:      "no new commits",
+			promotion: Promotion{PreRelease: "v1.30.1-rc2+rke2r1", Branch: "release-1.30", Status: "identical"},
+		},
+		{
+			name: "new commits",
+			promotion: Promotion{
+				PreRelease: "v1.30.1-rc2+rke2r1",
+				Branch:     "release-1.30",
+				Status:     "ahead",
+				NewCommits: []*github.RepositoryCommit{{SHA: new("abc")}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new commits allowed",
+			promotion: Promotion{
+				PreRelease: "v1.30.1-rc2+rke2r1",
+				Branch:     "release-1.30",
+				Status:     "ahead",
+				NewCommits: []*github.RepositoryCommit{{SHA: new("abc")}},
+			},
+			allowNewCommits: true,
+		},
+		{
+			name:            "diverged",
+			promotion:       Promotion{PreRelease: "v1.30.1-rc2+rke2r1", Branch: "release-1.30", Status: "diverged"},
+			allowNewCommits: true,
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.promotion.Validate(tt.allowNewCommits); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNextSELinuxTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		builds  map[string]int
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "first testing",
+			channel: ChannelTesting,
+			builds:  map[string]int{},
+			want:    "v0.18.testing.1",
+		},
+		{
+			name:    "next testing",
+			channel: ChannelTesting,
+			builds:  map[string]int{ChannelTesting: 2, ChannelLatest: 1, ChannelStable: 1},
+			want:    "v0.18.testing.3",
+		},
+		{
+			name:    "promote testing to latest",
+			channel: ChannelLatest,
+			builds:  map[string]int{ChannelTesting: 2, ChannelLatest: 1},
+			want:    "v0.18.latest.2",
+		},
+		{
+			name:    "latest already promoted",
+			channel: ChannelLatest,
+			builds:  map[string]int{ChannelTesting: 2, ChannelLatest: 2},
+			wantErr: true,
+		},
+		{
+			name:    "promote latest to stable",
+			channel: ChannelStable,
+			builds:  map[string]int{ChannelTesting: 2, ChannelLatest: 2, ChannelStable: 1},
+			want:    "v0.18.stable.2",
+		},
+		{
+			name:    "stable before latest",
+			channel: ChannelStable,
+			builds:  map[string]int{ChannelTesting: 1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid channel",
+			channel: "beta",
+			builds:  map[string]int{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextSELinuxTag("v0.18", tt.channel, tt.builds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nextSELinuxTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nextSELinuxTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSatelliteTag(t *testing.T) {
+	tags := map[string]bool{"v1.30.2-rc1+rke2r1": true, "v1.30.2-rc2+rke2r1": true, "v1.29.6+rke2r1": true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/repos/rancher/rke2/git/ref/tags/"))
+		if !tags[tag] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ref": "refs/tags/` + tag + `"}`))
+	}))
+	defer server.Close()
+
+	client, err := github.NewClient(github.WithURLs(new(server.URL+"/"), nil), github.WithDisableRateLimitCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		k8sVersion string
+		rc         bool
+		want       string
+		wantErr    bool
+	}{
+		{name: "latest rc", k8sVersion: "v1.30.2", rc: true, want: "v1.30.2-rc2+rke2r1"},
+		{name: "no rc", k8sVersion: "v1.31.0", rc: true, wantErr: true},
+		{name: "ga", k8sVersion: "v1.29.6", want: "v1.29.6+rke2r1"},
+		{name: "ga not tagged", k8sVersion: "v1.30.2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SatelliteTag(context.Background(), client, "rancher", "rke2", tt.k8sVersion, version.Distro("rke2r1"), tt.rc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SatelliteTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SatelliteTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
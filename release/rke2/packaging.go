@@ -0,0 +1,131 @@
+package rke2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/version"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+// stableSoakTime is how long an rke2 GA release has to be published
+// before its packages can be promoted to the stable channel.
+const stableSoakTime = 24 * time.Hour
+
+// PackagingOpts describes an rke2-packaging release for an rke2 release.
+type PackagingOpts struct {
+	Owner       string
+	Repo        string
+	RKE2Owner   string
+	RKE2Repo    string
+	RKE2Version string
+	Channel     string
+	RPMVersion  int
+	DryRun      bool
+}
+
+// PackagingTag returns the rke2-packaging tag of an rke2 release in a channel,
+// e.g. v1.30.1+rke2r1.stable.0.
+func PackagingTag(rke2Version, channel string, rpmVersion int) string {
+	return rke2Version + "." + channel + "." + strconv.Itoa(rpmVersion)
+}
+
+// CreatePackagingRelease creates the rke2-packaging release for an rke2
+// release after verifying the rke2 release is published and the channel
+// ordering is respected.
+func CreatePackagingRelease(ctx context.Context, client *github.Client, opts *PackagingOpts) error {
+	v, err := version.Parse(opts.RKE2Version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("verifying rke2 release " + opts.RKE2Version)
+	rke2Release, _, err := client.Repositories.GetReleaseByTag(ctx, opts.RKE2Owner, opts.RKE2Repo, opts.RKE2Version)
+	if err != nil {
+		if ghErr, ok := err.(*github.ErrorResponse); ok && ghErr.Response.StatusCode == http.StatusNotFound {
+			return errors.New("rke2 release not found: " + opts.RKE2Version)
+		}
+		return err
+	}
+	if rke2Release.GetDraft() {
+		return errors.New("rke2 release is still a draft: " + opts.RKE2Version)
+	}
+
+	var latestTagged bool
+	if opts.Channel == release.ChannelStable {
+		refs, _, err := client.Git.ListMatchingRefs(ctx, opts.Owner, opts.Repo, "tags/"+opts.RKE2Version+"."+release.ChannelLatest+".")
+		if err != nil {
+			return err
+		}
+		latestTagged = len(refs) > 0
+	}
+
+	if err := validatePackagingChannel(v, opts.Channel, rke2Release.GetPublishedAt().Time, latestTagged, time.Now()); err != nil {
+		return err
+	}
+
+	tag := PackagingTag(opts.RKE2Version, opts.Channel, opts.RPMVersion)
+	releaseOpts := &repository.CreateReleaseOpts{
+		Owner:  opts.Owner,
+		Repo:   opts.Repo,
+		Name:   tag,
+		Tag:    tag,
+		Branch: "master",
+	}
+
+	fmt.Printf("create release options: %+v\n", *releaseOpts)
+
+	if opts.DryRun {
+		fmt.Println("dry run, skipping creating release")
+		return nil
+	}
+
+	createdRelease, err := repository.CreateRelease(ctx, client, releaseOpts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("release created: " + createdRelease.GetHTMLURL())
+	return nil
+}
+
+// validatePackagingChannel enforces the testing, latest, stable ordering:
+// RCs can only be published to testing, stable requires latest to be
+// tagged and the GA release to have been published for stableSoakTime.
+func validatePackagingChannel(v version.Version, channel string, publishedAt time.Time, latestTagged bool, now time.Time) error {
+	if v.Metadata.Label != "rke2r" || v.Metadata.Number == 0 {
+		return errors.New("invalid rke2 version: " + v.String())
+	}
+
+	switch channel {
+	case release.ChannelTesting:
+		return nil
+	case release.ChannelLatest, release.ChannelStable:
+	default:
+		return errors.New("invalid channel: " + channel)
+	}
+
+	if v.IsPreRelease() {
+		return errors.New("pre-releases can only be published to the testing channel: " + v.String())
+	}
+
+	if channel == release.ChannelLatest {
+		return nil
+	}
+
+	if !latestTagged {
+		return errors.New("can't publish to stable before latest: " + v.String())
+	}
+
+	if soak := now.Sub(publishedAt); soak < stableSoakTime {
+		return fmt.Errorf("can't publish to stable within %s of GA, %s left", stableSoakTime, (stableSoakTime - soak).Round(time.Minute))
+	}
+
+	return nil
+}
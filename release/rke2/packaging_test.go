@@ -0,0 +1,98 @@
+package rke2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/version"
+)
+
+func TestPackagingTag(t *testing.T) {
+	if got := PackagingTag("v1.30.1-rc1+rke2r1", release.ChannelTesting, 0); got != "v1.30.1-rc1+rke2r1.testing.0" {
+		t.Errorf("PackagingTag() = %v, want v1.30.1-rc1+rke2r1.testing.0", got)
+	}
+}
+
+func TestValidatePackagingChannel(t *testing.T) {
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		version      string
+		channel      string
+		publishedAt  time.Time
+		latestTagged bool
+		wantErr      bool
+	}{
+		{
+			name:    "testing rc",
+			version: "v1.30.1-rc1+rke2r1",
+			channel: release.ChannelTesting,
+		},
+		{
+			name:    "testing ga",
+			version: "v1.30.1+rke2r1",
+			channel: release.ChannelTesting,
+		},
+		{
+			name:    "latest ga",
+			version: "v1.30.1+rke2r1",
+			channel: release.ChannelLatest,
+		},
+		{
+			name:    "latest rc",
+			version: "v1.30.1-rc1+rke2r1",
+			channel: release.ChannelLatest,
+			wantErr: true,
+		},
+		{
+			name:         "stable after soak",
+			version:      "v1.30.1+rke2r1",
+			channel:      release.ChannelStable,
+			publishedAt:  now.Add(-25 * time.Hour),
+			latestTagged: true,
+		},
+		{
+			name:         "stable within soak",
+			version:      "v1.30.1+rke2r1",
+			channel:      release.ChannelStable,
+			publishedAt:  now.Add(-time.Hour),
+			latestTagged: true,
+			wantErr:      true,
+		},
+		{
+			name:        "stable before latest",
+			version:     "v1.30.1+rke2r1",
+			channel:     release.ChannelStable,
+			publishedAt: now.Add(-48 * time.Hour),
+			wantErr:     true,
+		},
+		{
+			name:    "invalid channel",
+			version: "v1.30.1+rke2r1",
+			channel: "beta",
+			wantErr: true,
+		},
+		{
+			name:    "not an rke2 version",
+			version: "v1.30.1+k3s1",
+			channel: release.ChannelTesting,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := version.Parse(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = validatePackagingChannel(v, tt.channel, tt.publishedAt, tt.latestTagged, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePackagingChannel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package rke2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	ecmExec "github.com/rancher/ecm-distro-tools/exec"
+	"github.com/rancher/ecm-distro-tools/release"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	rke2UpstreamRemote = "upstream"
+	k3sKubernetesFork  = "github.com/k3s-io/kubernetes"
+)
+
+var (
+	versionShK8sRE            = regexp.MustCompile(`KUBERNETES_VERSION:-([^}]*)`)
+	versionShImageTagRE       = regexp.MustCompile(`KUBERNETES_IMAGE_TAG:-([^}]*)`)
+	hardenedBuildBaseRE       = regexp.MustCompile(`rancher/hardened-build-base:(v[^b\s]*b[0-9]*)`)
+	hardenedKubernetesRE      = regexp.MustCompile(`rancher/hardened-kubernetes:(\S+)`)
+	windowsKubectlVersionRE   = regexp.MustCompile(`(?m)^RUN KUBECTL_VERSION=(v[0-9][0-9.]*)`)
+	windowsLinuxKubectlSHARE  = regexp.MustCompile(`KUBECTL_SHA256="([a-f0-9]*)" ;;`)
+	windowsKubectlSHARE       = regexp.MustCompile(`KUBECTL_SHA256="([a-f0-9]*)" &&`)
+	windowsKubeletSHARE       = regexp.MustCompile(`KUBELET_SHA256="([a-f0-9]*)`)
+	windowsKubeProxySHARE     = regexp.MustCompile(`KUBE_PROXY_SHA256="([a-f0-9]*)`)
+	windowsBinaryCaseVersionF = `RUN case[^\n]*\n[^\n]*?(%s)\)`
+)
+
+// referenceValues are the values the rke2 references are updated to, besides
+// the versions of the release itself.
+type referenceValues struct {
+	KubernetesImageTag  string // fetched from rancher/image-build-kubernetes releases
+	LinuxKubectlSHA     string // dl.k8s.io linux/amd64 kubectl SHA256
+	WindowsKubectlSHA   string // dl.k8s.io windows/amd64 kubectl.exe SHA256
+	WindowsKubeletSHA   string // dl.k8s.io windows/amd64 kubelet.exe SHA256
+	WindowsKubeProxySHA string // dl.k8s.io windows/amd64 kube-proxy.exe SHA256
+}
+
+// valueChange is a single value updated in one of the rke2 files.
+type valueChange struct {
+	File string
+	Name string
+	Old  string
+	New  string
+}
+
+// fileEdit replaces values in the content of a file and records what
+// changed.
+type fileEdit struct {
+	path    string
+	content string
+	changes []valueChange
+}
+
+// replace sets the first group of every match of re to value.
+func (e *fileEdit) replace(name string, re *regexp.Regexp, value string) {
+	var b strings.Builder
+	var old string
+	var found bool
+	last := 0
+
+	for _, m := range re.FindAllStringSubmatchIndex(e.content, -1) {
+		if !found {
+			old, found = e.content[m[2]:m[3]], true
+		}
+		b.WriteString(e.content[last:m[2]])
+		b.WriteString(value)
+		last = m[3]
+	}
+	if !found {
+		fmt.Println(name + " not found in " + e.path + ", skipping it")
+		return
+	}
+	b.WriteString(e.content[last:])
+
+	e.content = b.String()
+	e.changes = append(e.changes, valueChange{File: e.path, Name: name, Old: old, New: value})
+}
+
+func updateRKE2ReferencesAndPush(r *ecmConfig.RKE2Release, u *ecmConfig.User, values *referenceValues, sshKeyPath string, interactive bool) error {
+	fmt.Println("getting ssh auth")
+	gitAuth, err := release.GitSSHAuth(sshKeyPath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(r.Workspace, "rke2")
+
+	repo, err := release.CloneOrOpen(dir, "git@github.com:"+u.GithubUsername+"/rke2.git", gitAuth)
+	if err != nil {
+		return err
+	}
+
+	upstreamURL := "https://github.com/" + r.RKE2RepoOwner + "/" + r.RKE2RepoName + ".git"
+	branch, err := release.CheckoutBranchFrom(repo, rke2UpstreamRemote, upstreamURL, r.ReleaseBranch, r.NewK8sVersion+"-"+r.NewSuffix, nil)
+	if err != nil {
+		return err
+	}
+
+	originals, changes, err := editReferences(dir, r, values)
+	if err != nil {
+		return err
+	}
+
+	var approve func(string) bool
+	if interactive {
+		approve = func(path string) bool {
+			return ecmExec.UserInput("apply the changes to " + path + "?")
+		}
+	}
+	approved, err := reviewReferences(os.Stdout, dir, originals, changes, approve)
+	if err != nil {
+		return err
+	}
+	if len(approved) == 0 {
+		return errors.New("no changes to commit")
+	}
+
+	// go.sum only follows go.mod, it's left as is if go.mod was rejected
+	if slices.Contains(approved, "go.mod") {
+		fmt.Println("go mod tidy")
+		if _, err := ecmExec.RunCommand(dir, "go", "mod", "tidy"); err != nil {
+			return errors.New("go mod tidy failed: " + err.Error())
+		}
+		approved = append(approved, "go.sum")
+	}
+
+	subject := "Update to " + r.NewK8sVersion + "-" + r.NewSuffix
+	if _, err := release.CommitSignedOff(repo, approved, subject, u.GithubUsername, u.Email); err != nil {
+		return err
+	}
+
+	if r.DryRun {
+		fmt.Println("dry run, skipping push")
+		return nil
+	}
+
+	return release.PushBranch(repo, branch, gitAuth)
+}
+
+// editReferences updates the rke2 files in dir. The original content of
+// every changed file is returned, keyed by its path relative to dir, along
+// with the values that changed.
+func editReferences(dir string, r *ecmConfig.RKE2Release, values *referenceValues) (map[string][]byte, []valueChange, error) {
+	originals := make(map[string][]byte)
+	var changes []valueChange
+
+	edit := func(path string, update func(e *fileEdit) error) error {
+		b, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("updating " + path)
+		e := &fileEdit{path: path, content: string(b)}
+		if err := update(e); err != nil {
+			return errors.New("failed to update " + path + ": " + err.Error())
+		}
+		if e.content == string(b) {
+			return nil
+		}
+
+		originals[path] = b
+		changes = append(changes, e.changes...)
+
+		return os.WriteFile(filepath.Join(dir, path), []byte(e.content), 0o644)
+	}
+
+	buildBaseTag := "v" + r.NewGoVersion + "b1"
+	caseVersionRE := regexp.MustCompile(fmt.Sprintf(windowsBinaryCaseVersionF, regexp.QuoteMeta(r.OldK8sVersion)))
+
+	edits := []struct {
+		path   string
+		update func(e *fileEdit) error
+	}{
+		{"go.mod", func(e *fileEdit) error {
+			return updateGoMod(e, r)
+		}},
+		{"scripts/version.sh", func(e *fileEdit) error {
+			e.replace("KUBERNETES_VERSION", versionShK8sRE, r.NewK8sVersion)
+			e.replace("KUBERNETES_IMAGE_TAG", versionShImageTagRE, values.KubernetesImageTag)
+			return nil
+		}},
+		{"Dockerfile", func(e *fileEdit) error {
+			e.replace("hardened-build-base", hardenedBuildBaseRE, buildBaseTag)
+			e.replace("hardened-kubernetes", hardenedKubernetesRE, values.KubernetesImageTag)
+			return nil
+		}},
+		{"Dockerfile.windows", func(e *fileEdit) error {
+			e.replace("hardened-build-base", hardenedBuildBaseRE, buildBaseTag)
+			e.replace("linux kubectl version", windowsKubectlVersionRE, r.NewK8sVersion)
+			e.replace("linux kubectl sha256", windowsLinuxKubectlSHARE, values.LinuxKubectlSHA)
+			e.replace("windows binaries version", caseVersionRE, r.NewK8sVersion)
+			e.replace("windows kubectl sha256", windowsKubectlSHARE, values.WindowsKubectlSHA)
+			e.replace("windows kubelet sha256", windowsKubeletSHARE, values.WindowsKubeletSHA)
+			e.replace("windows kube-proxy sha256", windowsKubeProxySHARE, values.WindowsKubeProxySHA)
+			return nil
+		}},
+	}
+
+	for _, e := range edits {
+		if err := edit(e.path, e.update); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return originals, changes, nil
+}
+
+// updateGoMod sets the Go version and moves the k3s-io/kubernetes
+// replacements to the new kubernetes version.
+func updateGoMod(e *fileEdit, r *ecmConfig.RKE2Release) error {
+	f, err := modfile.Parse(e.path, []byte(e.content), nil)
+	if err != nil {
+		return err
+	}
+
+	if f.Go == nil || f.Go.Version != r.NewGoVersion {
+		var old string
+		if f.Go != nil {
+			old = f.Go.Version
+		}
+		if err := f.AddGoStmt(r.NewGoVersion); err != nil {
+			return err
+		}
+		e.changes = append(e.changes, valueChange{File: e.path, Name: "go", Old: old, New: r.NewGoVersion})
+	}
+
+	oldVersion := r.OldK8sVersion + "-" + r.K3sSuffix
+	newVersion := r.NewK8sVersion + "-" + r.K3sSuffix
+
+	var replaced bool
+	for _, replace := range f.Replace {
+		if replace.New.Path != k3sKubernetesFork && !strings.HasPrefix(replace.New.Path, k3sKubernetesFork+"/") {
+			continue
+		}
+		v := strings.ReplaceAll(replace.New.Version, oldVersion, newVersion)
+		if v == replace.New.Version {
+			continue
+		}
+		if !replaced {
+			e.changes = append(e.changes, valueChange{File: e.path, Name: k3sKubernetesFork, Old: replace.New.Version, New: v})
+			replaced = true
+		}
+		if err := f.AddReplace(replace.Old.Path, replace.Old.Version, replace.New.Path, v); err != nil {
+			return err
+		}
+	}
+
+	f.Cleanup()
+	b, err := f.Format()
+	if err != nil {
+		return err
+	}
+	e.content = string(b)
+
+	return nil
+}
+
+// reviewReferences writes the values that changed and a diff of each
+// changed file. If approve is set, it's asked for each file and the files
+// which aren't approved are restored. The approved files are returned.
+func reviewReferences(w io.Writer, dir string, originals map[string][]byte, changes []valueChange, approve func(path string) bool) ([]string, error) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "file\tvalue\told\tnew")
+	fmt.Fprintln(tw, "----\t-----\t---\t---")
+	for _, c := range changes {
+		if c.Old == c.New {
+			continue
+		}
+		fmt.Fprintln(tw, c.File+"\t"+c.Name+"\t"+c.Old+"\t"+c.New)
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(originals))
+	for path := range originals {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var approved []string
+	for _, path := range paths {
+		fmt.Fprintln(w)
+		if err := release.WriteFileDiffs(w, dir, map[string][]byte{path: originals[path]}); err != nil {
+			return nil, err
+		}
+
+		if approve != nil && !approve(path) {
+			fmt.Fprintln(w, "restoring "+path)
+			if err := os.WriteFile(filepath.Join(dir, path), originals[path], 0o644); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		approved = append(approved, path)
+	}
+
+	return approved, nil
+}
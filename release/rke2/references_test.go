@@ -0,0 +1,181 @@
+package rke2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+)
+
+var testRKE2Files = map[string]string{
+	"go.mod": `module github.com/rancher/rke2
+
+go 1.22.2
+
+replace (
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.1-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.1-k3s1
+)
+
+require k8s.io/kubernetes v1.30.1
+`,
+	"scripts/version.sh": `KUBERNETES_VERSION=${KUBERNETES_VERSION:-v1.30.1}
+KUBERNETES_IMAGE_TAG=${KUBERNETES_IMAGE_TAG:-v1.30.1-rke2r1-build20240515}
+`,
+	"Dockerfile": `FROM rancher/hardened-build-base:v1.22.2b1 AS build
+FROM rancher/hardened-kubernetes:v1.30.1-rke2r1-build20240515 AS kubernetes
+`,
+	"Dockerfile.windows": `FROM rancher/hardened-build-base:v1.22.2b1 AS build
+RUN KUBECTL_VERSION=v1.30.1 && \
+    case "$(go env GOARCH)" in \
+    amd64) KUBECTL_SHA256="aaaa" ;; \
+    esac
+RUN case "${KUBERNETES_VERSION}" in \
+    v1.30.1) KUBECTL_SHA256="bbbb" && \
+        KUBELET_SHA256="cccc" && \
+        KUBE_PROXY_SHA256="dddd" ;; \
+    esac
+`,
+}
+
+var testRKE2Release = &ecmConfig.RKE2Release{
+	OldK8sVersion: "v1.30.1",
+	NewK8sVersion: "v1.30.2",
+	NewSuffix:     "rke2r1",
+	K3sSuffix:     "k3s1",
+	NewGoVersion:  "1.22.5",
+}
+
+var testReferenceValues = &referenceValues{
+	KubernetesImageTag:  "v1.30.2-rke2r1-build20240612",
+	LinuxKubectlSHA:     "1111",
+	WindowsKubectlSHA:   "2222",
+	WindowsKubeletSHA:   "3333",
+	WindowsKubeProxySHA: "4444",
+}
+
+func writeRKE2Files(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for path, content := range testRKE2Files {
+		p := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestEditReferences(t *testing.T) {
+	dir := writeRKE2Files(t)
+
+	originals, changes, err := editReferences(dir, testRKE2Release, testReferenceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(originals) != len(testRKE2Files) {
+		t.Errorf("changed files = %d, want %d", len(originals), len(testRKE2Files))
+	}
+
+	want := map[string]string{
+		"go.mod": `module github.com/rancher/rke2
+
+go 1.22.5
+
+replace (
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.2-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.2-k3s1
+)
+
+require k8s.io/kubernetes v1.30.1
+`,
+		"scripts/version.sh": `KUBERNETES_VERSION=${KUBERNETES_VERSION:-v1.30.2}
+KUBERNETES_IMAGE_TAG=${KUBERNETES_IMAGE_TAG:-v1.30.2-rke2r1-build20240612}
+`,
+		"Dockerfile": `FROM rancher/hardened-build-base:v1.22.5b1 AS build
+FROM rancher/hardened-kubernetes:v1.30.2-rke2r1-build20240612 AS kubernetes
+`,
+		"Dockerfile.windows": `FROM rancher/hardened-build-base:v1.22.5b1 AS build
+RUN KUBECTL_VERSION=v1.30.2 && \
+    case "$(go env GOARCH)" in \
+    amd64) KUBECTL_SHA256="1111" ;; \
+    esac
+RUN case "${KUBERNETES_VERSION}" in \
+    v1.30.2) KUBECTL_SHA256="2222" && \
+        KUBELET_SHA256="3333" && \
+        KUBE_PROXY_SHA256="4444" ;; \
+    esac
+`,
+	}
+	for path, content := range want {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("%s =\n%s\nwant\n%s", path, b, content)
+		}
+	}
+
+	wantChanges := []valueChange{
+		{File: "go.mod", Name: "go", Old: "1.22.2", New: "1.22.5"},
+		{File: "go.mod", Name: k3sKubernetesFork, Old: "v1.30.1-k3s1", New: "v1.30.2-k3s1"},
+		{File: "scripts/version.sh", Name: "KUBERNETES_VERSION", Old: "v1.30.1", New: "v1.30.2"},
+		{File: "scripts/version.sh", Name: "KUBERNETES_IMAGE_TAG", Old: "v1.30.1-rke2r1-build20240515", New: "v1.30.2-rke2r1-build20240612"},
+		{File: "Dockerfile", Name: "hardened-build-base", Old: "v1.22.2b1", New: "v1.22.5b1"},
+		{File: "Dockerfile", Name: "hardened-kubernetes", Old: "v1.30.1-rke2r1-build20240515", New: "v1.30.2-rke2r1-build20240612"},
+		{File: "Dockerfile.windows", Name: "hardened-build-base", Old: "v1.22.2b1", New: "v1.22.5b1"},
+		{File: "Dockerfile.windows", Name: "linux kubectl version", Old: "v1.30.1", New: "v1.30.2"},
+		{File: "Dockerfile.windows", Name: "linux kubectl sha256", Old: "aaaa", New: "1111"},
+		{File: "Dockerfile.windows", Name: "windows binaries version", Old: "v1.30.1", New: "v1.30.2"},
+		{File: "Dockerfile.windows", Name: "windows kubectl sha256", Old: "bbbb", New: "2222"},
+		{File: "Dockerfile.windows", Name: "windows kubelet sha256", Old: "cccc", New: "3333"},
+		{File: "Dockerfile.windows", Name: "windows kube-proxy sha256", Old: "dddd", New: "4444"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %+v, want %+v", changes, wantChanges)
+	}
+}
+
+func TestReviewReferences(t *testing.T) {
+	dir := writeRKE2Files(t)
+
+	originals, changes, err := editReferences(dir, testRKE2Release, testReferenceValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	approved, err := reviewReferences(&out, dir, originals, changes, func(path string) bool {
+		return path != "Dockerfile.windows"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"Dockerfile", "go.mod", "scripts/version.sh"}; !reflect.DeepEqual(approved, want) {
+		t.Errorf("approved = %v, want %v", approved, want)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "Dockerfile.windows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testRKE2Files["Dockerfile.windows"] {
+		t.Errorf("Dockerfile.windows wasn't restored:\n%s", b)
+	}
+
+	for _, s := range []string{"KUBERNETES_IMAGE_TAG", "+++ b/scripts/version.sh", "-go 1.22.2"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output doesn't include %q:\n%s", s, out.String())
+		}
+	}
+}
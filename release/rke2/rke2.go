@@ -5,99 +5,27 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"io"
 	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-github/v90/github"
 	"github.com/rancher/ecm-distro-tools/cmd/release/config"
 	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
 	"github.com/rancher/ecm-distro-tools/docker"
-	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	ecmHTTP "github.com/rancher/ecm-distro-tools/http"
 	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/version"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	goDevURL             = "https://go.dev/dl/?mode=json"
-	dockerHubTagsURL     = "https://hub.docker.com/v2/repositories/library/golang/tags"
-	imageBuildBaseRepo   = "image-build-base"
-	updateRKE2ScriptName = "update_rke2_references.sh"
-
-	updateRke2ReferencesScript = `#!/bin/sh
-set -ex
-OS=$(uname -s)
-DRY_RUN={{ .RKE2.DryRun }}
-BRANCH_NAME={{ .RKE2.NewK8sVersion }}-{{ .RKE2.NewSuffix }}
-cd {{ .RKE2.Workspace }}
-ls | grep -w rke2 || git clone "git@github.com:{{ .User.GithubUsername }}/rke2.git"
-cd {{ .RKE2.Workspace }}/rke2
-git remote -v | grep -w upstream || git remote add upstream https://github.com/{{ .RKE2.RKE2RepoOwner }}/{{ .RKE2.RKE2RepoName }}.git
-git fetch upstream
-git stash
-git branch -D "${BRANCH_NAME}" >/dev/null 2>&1 || true
-git checkout -B "${BRANCH_NAME}" upstream/{{ .RKE2.ReleaseBranch }}
-git clean -xfd
-
-case ${OS} in
-Darwin)
-	# go.mod: Go version
-	sed -Ei '' "s/^go [^ ]*/go {{ .RKE2.NewGoVersion }}/" go.mod
-	# go.mod: k3s-io/kubernetes fork replace directives
-	sed -Ei '' "\|github.com/k3s-io/kubernetes| s|{{ replaceAll .RKE2.OldK8sVersion "." "\\." }}-{{ .RKE2.K3sSuffix }}|{{ replaceAll .RKE2.NewK8sVersion "." "\\." }}-{{ .RKE2.K3sSuffix }}|g" go.mod
-	# scripts/version.sh
-	sed -Ei '' "s|KUBERNETES_VERSION:-[^}]*|KUBERNETES_VERSION:-{{ .RKE2.NewK8sVersion }}|" scripts/version.sh
-	sed -Ei '' "s|KUBERNETES_IMAGE_TAG:-[^}]*|KUBERNETES_IMAGE_TAG:-{{ .NewKubernetesImageTag }}|" scripts/version.sh
-	# Dockerfile + Dockerfile.windows: hardened-build-base Go version
-	sed -Ei '' "s|rancher/hardened-build-base:v[^b]*b[0-9]*|rancher/hardened-build-base:v{{ .RKE2.NewGoVersion }}b1|g" Dockerfile Dockerfile.windows
-	# Dockerfile: hardened-kubernetes image tag
-	sed -Ei '' "s|rancher/hardened-kubernetes:[^ ]*|rancher/hardened-kubernetes:{{ .NewKubernetesImageTag }}|" Dockerfile
-	# Dockerfile.windows: build-env linux kubectl version
-	sed -Ei '' "s/^RUN KUBECTL_VERSION=v[0-9][0-9.]*/RUN KUBECTL_VERSION={{ .RKE2.NewK8sVersion }}/" Dockerfile.windows
-	# Dockerfile.windows: build-env linux kubectl SHA (trailing ";;" is the discriminator)
-	sed -Ei '' "s/KUBECTL_SHA256=\"[a-f0-9]*\" ;;/KUBECTL_SHA256=\"{{ .LinuxKubectlSHA }}\" ;;/" Dockerfile.windows
-	# Dockerfile.windows: Windows binary case statement version key
-	sed -Ei '' "/RUN case/{ n; s/{{ replaceAll .RKE2.OldK8sVersion "." "\\." }}\)/{{ .RKE2.NewK8sVersion }}\)/; }" Dockerfile.windows
-	# Dockerfile.windows: Windows kubectl SHA (trailing "&&" is the discriminator)
-	sed -Ei '' "s/KUBECTL_SHA256=\"[a-f0-9]*\" &&/KUBECTL_SHA256=\"{{ .WindowsKubectlSHA }}\" \&\&/" Dockerfile.windows
-	# Dockerfile.windows: Windows kubelet + kube-proxy SHAs (each appears only once)
-	sed -Ei '' "s/KUBELET_SHA256=\"[a-f0-9]*/KUBELET_SHA256=\"{{ .WindowsKubeletSHA }}/" Dockerfile.windows
-	sed -Ei '' "s/KUBE_PROXY_SHA256=\"[a-f0-9]*/KUBE_PROXY_SHA256=\"{{ .WindowsKubeProxySHA }}/" Dockerfile.windows
-	;;
-Linux)
-	sed -Ei "s/^go [^ ]*/go {{ .RKE2.NewGoVersion }}/" go.mod
-	sed -Ei "\|github.com/k3s-io/kubernetes| s|{{ replaceAll .RKE2.OldK8sVersion "." "\\." }}-{{ .RKE2.K3sSuffix }}|{{ replaceAll .RKE2.NewK8sVersion "." "\\." }}-{{ .RKE2.K3sSuffix }}|g" go.mod
-	sed -Ei "s|KUBERNETES_VERSION:-[^}]*|KUBERNETES_VERSION:-{{ .RKE2.NewK8sVersion }}|" scripts/version.sh
-	sed -Ei "s|KUBERNETES_IMAGE_TAG:-[^}]*|KUBERNETES_IMAGE_TAG:-{{ .NewKubernetesImageTag }}|" scripts/version.sh
-	sed -Ei "s|rancher/hardened-build-base:v[^b]*b[0-9]*|rancher/hardened-build-base:v{{ .RKE2.NewGoVersion }}b1|g" Dockerfile Dockerfile.windows
-	sed -Ei "s|rancher/hardened-kubernetes:[^ ]*|rancher/hardened-kubernetes:{{ .NewKubernetesImageTag }}|" Dockerfile
-	sed -Ei "s/^RUN KUBECTL_VERSION=v[0-9][0-9.]*/RUN KUBECTL_VERSION={{ .RKE2.NewK8sVersion }}/" Dockerfile.windows
-	sed -Ei "s/KUBECTL_SHA256=\"[a-f0-9]*\" ;;/KUBECTL_SHA256=\"{{ .LinuxKubectlSHA }}\" ;;/" Dockerfile.windows
-	sed -Ei "/RUN case/{ n; s/{{ replaceAll .RKE2.OldK8sVersion "." "\\." }}\)/{{ .RKE2.NewK8sVersion }}\)/; }" Dockerfile.windows
-	sed -Ei "s/KUBECTL_SHA256=\"[a-f0-9]*\" &&/KUBECTL_SHA256=\"{{ .WindowsKubectlSHA }}\" \&\&/" Dockerfile.windows
-	sed -Ei "s/KUBELET_SHA256=\"[a-f0-9]*/KUBELET_SHA256=\"{{ .WindowsKubeletSHA }}/" Dockerfile.windows
-	sed -Ei "s/KUBE_PROXY_SHA256=\"[a-f0-9]*/KUBE_PROXY_SHA256=\"{{ .WindowsKubeProxySHA }}/" Dockerfile.windows
-	;;
-*)
-	>&2 echo "${OS} not supported yet"
-	exit 1
-	;;
-esac
-
-go mod tidy
-
-git add go.mod go.sum scripts/version.sh Dockerfile Dockerfile.windows
-git commit --signoff -m "Update to {{ .RKE2.NewK8sVersion }}-{{ .RKE2.NewSuffix }}"
-if [ "${DRY_RUN}" = false ]; then
-	git push --set-upstream origin "${BRANCH_NAME}"
-fi`
+	goDevURL           = "https://go.dev/dl/?mode=json"
+	dockerHubTagsURL   = "https://hub.docker.com/v2/repositories/library/golang/tags"
+	imageBuildBaseRepo = "image-build-base"
 )
 
 type goVersionRecord struct {
@@ -105,20 +33,17 @@ type goVersionRecord struct {
 	Stable  bool   `json:"stable"`
 }
 
-type UpdateScriptVars struct {
-	RKE2                  *ecmConfig.RKE2Release
-	User                  *ecmConfig.User
-	NewKubernetesImageTag string // fetched from rancher/image-build-kubernetes releases
-	LinuxKubectlSHA       string // dl.k8s.io linux/amd64 kubectl SHA256
-	WindowsKubectlSHA     string // dl.k8s.io windows/amd64 kubectl.exe SHA256
-	WindowsKubeletSHA     string // dl.k8s.io windows/amd64 kubelet.exe SHA256
-	WindowsKubeProxySHA   string // dl.k8s.io windows/amd64 kube-proxy.exe SHA256
-}
-
 // UpdateRKE2References updates k8s, k3s and Go references in a local RKE2
-// checkout and optionally opens a pull request.
-func UpdateRKE2References(ctx context.Context, ghClient *github.Client, r *ecmConfig.RKE2Release, u *ecmConfig.User) error {
-	if err := updateRKE2ReferencesAndPush(ctx, ghClient, r, u); err != nil {
+// checkout and optionally opens a pull request. The values that changed and
+// a diff of each file are printed before committing, if interactive is set
+// each file has to be approved to be committed.
+func UpdateRKE2References(ctx context.Context, ghClient *github.Client, r *ecmConfig.RKE2Release, u *ecmConfig.User, sshKeyPath string, interactive bool) error {
+	values, err := rke2ReferenceValues(ctx, ghClient, r)
+	if err != nil {
+		return err
+	}
+
+	if err := updateRKE2ReferencesAndPush(r, u, values, sshKeyPath, interactive); err != nil {
 		return err
 	}
 
@@ -130,9 +55,11 @@ func UpdateRKE2References(ctx context.Context, ghClient *github.Client, r *ecmCo
 	return createRKE2ReferencesPR(ctx, ghClient, r, u)
 }
 
-func updateRKE2ReferencesAndPush(ctx context.Context, ghClient *github.Client, r *ecmConfig.RKE2Release, u *ecmConfig.User) error {
+// rke2ReferenceValues collects the versions and checksums the references
+// are updated to.
+func rke2ReferenceValues(ctx context.Context, ghClient *github.Client, r *ecmConfig.RKE2Release) (*referenceValues, error) {
 	if err := release.SetWorkspace(r.Workspace); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Default go.mod k3s fork suffix when not explicitly configured.
@@ -143,14 +70,14 @@ func updateRKE2ReferencesAndPush(ctx context.Context, ghClient *github.Client, r
 	fmt.Println("getting k8s go version")
 	goVersion, err := release.KubernetesGoVersion(ctx, ghClient, r.NewK8sVersion)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	r.NewGoVersion = goVersion
 
 	fmt.Println("getting kubernetes image tag from rancher/image-build-kubernetes")
 	kubernetesImageTag, err := kubernetesImageTag(ctx, ghClient, r.NewK8sVersion, r.NewSuffix)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Println("fetching linux/amd64 kubectl SHA256")
@@ -158,7 +85,7 @@ func updateRKE2ReferencesAndPush(ctx context.Context, ghClient *github.Client, r
 		"https://dl.k8s.io/release/%s/bin/linux/amd64/kubectl.sha256", r.NewK8sVersion,
 	))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Println("fetching windows/amd64 binary SHA256s")
@@ -166,46 +93,30 @@ func updateRKE2ReferencesAndPush(ctx context.Context, ghClient *github.Client, r
 		"https://dl.k8s.io/release/%s/bin/windows/amd64/kubectl.exe.sha256", r.NewK8sVersion,
 	))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	windowsKubeletSHA, err := fetchSHA(fmt.Sprintf(
 		"https://dl.k8s.io/release/%s/bin/windows/amd64/kubelet.exe.sha256", r.NewK8sVersion,
 	))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	windowsKubeProxySHA, err := fetchSHA(fmt.Sprintf(
 		"https://dl.k8s.io/release/%s/bin/windows/amd64/kube-proxy.exe.sha256", r.NewK8sVersion,
 	))
 	if err != nil {
-		return err
-	}
-
-	funcMap := template.FuncMap{
-		"replaceAll": strings.ReplaceAll,
-	}
-
-	fmt.Println("creating update rke2 references script template")
-
-	scriptVars := UpdateScriptVars{
-		RKE2:                  r,
-		User:                  u,
-		NewKubernetesImageTag: kubernetesImageTag,
-		LinuxKubectlSHA:       linuxKubectlSHA,
-		WindowsKubectlSHA:     windowsKubectlSHA,
-		WindowsKubeletSHA:     windowsKubeletSHA,
-		WindowsKubeProxySHA:   windowsKubeProxySHA,
-	}
-
-	updateScriptOut, err := ecmExec.RunTemplatedScript(r.Workspace, updateRKE2ScriptName, updateRke2ReferencesScript, funcMap, scriptVars)
-	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Println(updateScriptOut)
 
-	return nil
+	return &referenceValues{
+		KubernetesImageTag:  kubernetesImageTag,
+		LinuxKubectlSHA:     linuxKubectlSHA,
+		WindowsKubectlSHA:   windowsKubectlSHA,
+		WindowsKubeletSHA:   windowsKubeletSHA,
+		WindowsKubeProxySHA: windowsKubeProxySHA,
+	}, nil
 }
 
 func createRKE2ReferencesPR(ctx context.Context, ghClient *github.Client, r *ecmConfig.RKE2Release, u *ecmConfig.User) error {
@@ -331,36 +242,17 @@ func ImageBuildBaseRelease(ctx context.Context, ghClient *github.Client, dryRun
 	return nil
 }
 
-func CreateRef(ctx context.Context, client *github.Client, r *ecmConfig.RKE2Release, opts *repository.CreateRefOpts, rc bool) error {
+// CreateRef tags the next RC or the GA of a rke2 release and returns the
+// created reference, or nil on a dry run.
+func CreateRef(ctx context.Context, client *github.Client, r *ecmConfig.RKE2Release, opts *repository.CreateRefOpts, rc bool) (*github.Reference, error) {
 	fmt.Println("validating tag")
-	_, err := semver.NewVersion(opts.Tag)
-	if err != nil {
-		return errors.New("tag isn't a valid semver: " + opts.Tag)
+	if _, err := version.Parse(opts.Tag); err != nil {
+		return nil, errors.New("tag isn't a valid semver: " + opts.Tag)
 	}
 
-	name := r.NewK8sVersion + "+" + r.NewSuffix
-
-	latestRC, err := release.LatestRC(ctx, opts.Owner, opts.Repo, r.NewK8sVersion, r.NewSuffix, client)
+	name, _, err := release.NextTag(ctx, client, opts.Owner, opts.Repo, r.NewK8sVersion, version.Distro(r.NewSuffix), rc)
 	if err != nil {
-		return err
-	}
-	if latestRC == nil && !rc {
-		return errors.New("couldn't find the latest RC")
-	}
-	if rc {
-		latestRCNumber := 1
-		if latestRC != nil {
-			trimmedRCNumber, _, found := strings.Cut(strings.TrimPrefix(*latestRC, r.NewK8sVersion+"-rc"), "+rke2r")
-			if !found {
-				return errors.New("failed to parse rc number from " + *latestRC)
-			}
-			currentRCNumber, err := strconv.Atoi(trimmedRCNumber)
-			if err != nil {
-				return err
-			}
-			latestRCNumber = currentRCNumber + 1
-		}
-		name = r.NewK8sVersion + "-rc" + strconv.Itoa(latestRCNumber) + "+" + r.NewSuffix
+		return nil, err
 	}
 
 	opts.Tag = name
@@ -369,15 +261,15 @@ func CreateRef(ctx context.Context, client *github.Client, r *ecmConfig.RKE2Rele
 
 	if r.DryRun {
 		fmt.Println("dry run, skipping creating tag")
-		return nil
+		return nil, nil
 	}
 	createdRef, err := repository.CreateRef(ctx, client, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Println("ref created: " + *createdRef.URL)
-	return nil
+	return createdRef, nil
 }
 
 // dockerHubResponse defines the structure for the Docker Hub API response.
@@ -0,0 +1,235 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-github/v90/github"
+	"github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release/version"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+// Channels used by the rke2-packaging and selinux repos, in the order a
+// release is promoted through them.
+const (
+	ChannelTesting = "testing"
+	ChannelLatest  = "latest"
+	ChannelStable  = "stable"
+)
+
+// Satellite is the container image published by the CI of a repository
+// released alongside k3s or rke2 with the same tags.
+type Satellite struct {
+	Image     string
+	Platforms []registry.Platform
+}
+
+var (
+	linuxAmd64   = registry.Platform{OS: "linux", Architecture: "amd64"}
+	linuxArm64   = registry.Platform{OS: "linux", Architecture: "arm64"}
+	linuxArm     = registry.Platform{OS: "linux", Architecture: "arm"}
+	windowsAmd64 = registry.Platform{OS: "windows", Architecture: "amd64"}
+)
+
+var (
+	K3sUpgrade = Satellite{
+		Image:     "rancher/k3s-upgrade",
+		Platforms: []registry.Platform{linuxAmd64, linuxArm64, linuxArm},
+	}
+	RKE2Upgrade = Satellite{
+		Image:     "rancher/rke2-upgrade",
+		Platforms: []registry.Platform{linuxAmd64, linuxArm64},
+	}
+	RKE2SystemAgentInstaller = Satellite{
+		Image:     "rancher/system-agent-installer-rke2",
+		Platforms: []registry.Platform{linuxAmd64, linuxArm64, windowsAmd64},
+	}
+)
+
+// WaitForSatelliteImage polls the registry until the image of a satellite
+// release is published for all of its platforms or the timeout expires.
+func WaitForSatelliteImage(ctx context.Context, c *registry.Client, s Satellite, tag string, timeout, interval time.Duration) error {
+	ref, err := name.ParseReference(s.Image + ":" + strings.ReplaceAll(tag, "+", "-"))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		img, err := c.Image(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		missing := registry.MissingPlatforms(img, s.Platforms)
+		if img.Exists && len(missing) == 0 {
+			fmt.Println("image " + ref.String() + " published for all platforms")
+			return nil
+		}
+
+		fmt.Printf("waiting for image %s, missing platforms: %v\n", ref.String(), missing)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("image %s wasn't published for %v within %s", ref.String(), missing, timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// SatelliteTag returns the tag a satellite release of k8sVersion is created
+// with: the latest RC tagged in the k3s or rke2 repo owner/repo if rc is set,
+// its GA otherwise. It fails if that tag doesn't exist yet, so the satellite
+// tags never drift from the k3s and rke2 ones.
+func SatelliteTag(ctx context.Context, client *github.Client, owner, repo, k8sVersion string, scheme version.Scheme, rc bool) (string, error) {
+	v, err := version.Parse(k8sVersion)
+	if err != nil {
+		return "", errors.New("invalid k8s version: " + k8sVersion)
+	}
+
+	if rc {
+		latestRC, err := LatestPreRelease(ctx, client, owner, repo, v, "rc", scheme)
+		if err != nil {
+			return "", err
+		}
+		if latestRC == nil {
+			return "", errors.New("no RC of " + scheme.GA(v).String() + " is tagged in " + owner + "/" + repo)
+		}
+		return latestRC.String(), nil
+	}
+
+	tag := scheme.GA(v).String()
+	if _, resp, err := client.Git.GetRef(ctx, owner, repo, "tags/"+tag); err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", errors.New(tag + " isn't tagged in " + owner + "/" + repo)
+		}
+		return "", err
+	}
+
+	return tag, nil
+}
+
+// CreateSatelliteRelease creates the release of a satellite repo tagged with
+// opts.Tag, a pre-release if rc is set. GA releases are published right away
+// so that their image is built and can be waited for.
+func CreateSatelliteRelease(ctx context.Context, client *github.Client, opts *repository.CreateReleaseOpts, rc, dryRun bool) error {
+	opts.Name = opts.Tag
+	opts.Prerelease = rc
+	opts.Draft = false
+	opts.ReleaseNotes = ""
+
+	fmt.Printf("create release options: %+v\n", *opts)
+
+	if dryRun {
+		fmt.Println("dry run, skipping creating release")
+		return nil
+	}
+
+	createdRelease, err := repository.CreateRelease(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("release created: " + createdRelease.GetHTMLURL())
+	return nil
+}
+
+var selinuxVersionRE = regexp.MustCompile(`^v\d+\.\d+$`)
+
+// SELinuxTag returns the next tag of a k3s-selinux or rke2-selinux release
+// line, e.g. v0.18.testing.2. A new build starts in testing and the same
+// build number is then promoted to latest and stable, so latest requires a
+// testing tag and stable a latest tag that haven't been promoted yet.
+func SELinuxTag(ctx context.Context, client *github.Client, owner, repo, selinuxVersion, channel string) (string, error) {
+	if !selinuxVersionRE.MatchString(selinuxVersion) {
+		return "", errors.New("invalid selinux version, expected vX.Y: " + selinuxVersion)
+	}
+
+	builds := make(map[string]int)
+	for _, c := range []string{ChannelTesting, ChannelLatest, ChannelStable} {
+		n, err := latestChannelBuild(ctx, client, owner, repo, selinuxVersion, c)
+		if err != nil {
+			return "", err
+		}
+		builds[c] = n
+	}
+
+	return nextSELinuxTag(selinuxVersion, channel, builds)
+}
+
+func nextSELinuxTag(selinuxVersion, channel string, builds map[string]int) (string, error) {
+	var n int
+
+	switch channel {
+	case ChannelTesting:
+		n = builds[ChannelTesting] + 1
+	case ChannelLatest:
+		n = builds[ChannelTesting]
+		if n == 0 || n <= builds[ChannelLatest] {
+			return "", errors.New("no new testing build of " + selinuxVersion + " to promote to latest")
+		}
+	case ChannelStable:
+		n = builds[ChannelLatest]
+		if n == 0 || n <= builds[ChannelStable] {
+			return "", errors.New("no new latest build of " + selinuxVersion + " to promote to stable")
+		}
+	default:
+		return "", errors.New("invalid channel: " + channel)
+	}
+
+	return selinuxVersion + "." + channel + "." + strconv.Itoa(n), nil
+}
+
+// latestChannelBuild returns the highest build number tagged in a channel,
+// or 0 if there is none.
+func latestChannelBuild(ctx context.Context, client *github.Client, owner, repo, selinuxVersion, channel string) (int, error) {
+	prefix := "tags/" + selinuxVersion + "." + channel + "."
+
+	refs, _, err := client.Git.ListMatchingRefs(ctx, owner, repo, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int
+	for _, ref := range refs {
+		n, err := strconv.Atoi(strings.TrimPrefix(ref.GetRef(), "refs/"+prefix))
+		if err != nil {
+			continue
+		}
+		latest = max(latest, n)
+	}
+
+	return latest, nil
+}
+
+// CreateSELinuxRelease creates a release of a k3s-selinux or rke2-selinux
+// repo from opts.Branch, only testing builds are marked as pre-releases.
+func CreateSELinuxRelease(ctx context.Context, client *github.Client, opts *repository.CreateReleaseOpts, testing, dryRun bool) error {
+	opts.Name = opts.Tag
+	opts.Prerelease = testing
+
+	fmt.Printf("create release options: %+v\n", *opts)
+
+	if dryRun {
+		fmt.Println("dry run, skipping creating release")
+		return nil
+	}
+
+	createdRelease, err := repository.CreateRelease(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("release created: " + createdRelease.GetHTMLURL())
+	return nil
+}
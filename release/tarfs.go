@@ -0,0 +1,134 @@
+package release
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TarFS implements fs.FS for some files of a tarball, e.g. the image lists
+// in the artifacts of a CI build. Files are read into memory and flattened to
+// their base names, like the assets of a GitHub release.
+type TarFS struct {
+	files map[string]*tarFileInfo
+}
+
+// NewTarFS reads the regular files of a tarball, gzip compressed or not,
+// with one of the base names in names. The other files are skipped without
+// being read.
+func NewTarFS(r io.Reader, names []string) (*TarFS, error) {
+	br := bufio.NewReader(r)
+
+	var tr *tar.Reader
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		tr = tar.NewReader(gr)
+	} else {
+		tr = tar.NewReader(br)
+	}
+
+	tfs := &TarFS{files: make(map[string]*tarFileInfo)}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Base(header.Name)
+		if !slices.Contains(names, name) {
+			continue
+		}
+		if _, ok := tfs.files[name]; ok {
+			return nil, errors.New("tarball has several files named " + name)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		tfs.files[name] = &tarFileInfo{name: name, data: data, modTime: header.ModTime}
+	}
+
+	return tfs, nil
+}
+
+// Open implements fs.FS for the files of the tarball
+func (t *TarFS) Open(name string) (fs.File, error) {
+	name = filepath.Clean(name)
+	name = strings.TrimPrefix(name, "/")
+
+	info, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &tarFile{info: info, reader: bytes.NewReader(info.data)}, nil
+}
+
+func (t *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = filepath.Clean(name)
+	name = strings.TrimPrefix(name, "/")
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(t.files))
+	for _, info := range t.files {
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+// tarFile implements fs.File for a file of a tarball
+type tarFile struct {
+	info   *tarFileInfo
+	reader *bytes.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarFile) Read(b []byte) (int, error) {
+	return f.reader.Read(b)
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+// tarFileInfo implements both fs.FileInfo and fs.DirEntry for a file of a
+// tarball
+type tarFileInfo struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+func (i *tarFileInfo) Name() string               { return i.name }
+func (i *tarFileInfo) Size() int64                { return int64(len(i.data)) }
+func (i *tarFileInfo) Mode() fs.FileMode          { return 0o444 } // read only
+func (i *tarFileInfo) ModTime() time.Time         { return i.modTime }
+func (i *tarFileInfo) IsDir() bool                { return false }
+func (i *tarFileInfo) Sys() interface{}           { return nil }
+func (i *tarFileInfo) Type() fs.FileMode          { return i.Mode() }
+func (i *tarFileInfo) Info() (fs.FileInfo, error) { return i, nil }
@@ -0,0 +1,68 @@
+package release
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+
+	"github.com/rancher/ecm-distro-tools/internal/tartest"
+)
+
+func TestNewTarFS(t *testing.T) {
+	files := map[string][]byte{
+		"dist/artifacts/rke2-images-all.linux-amd64.txt": []byte("rancher/rke2-runtime:v1.30.2-rke2r1\n"),
+		"dist/artifacts/rke2-images-all.linux-arm64.txt": []byte("rancher/rke2-runtime:v1.30.2-rke2r1\n"),
+		"dist/artifacts/sha256sum-amd64.txt":             []byte("abc  rke2.linux-amd64.tar.gz\n"),
+		"dist/amd64/sha256sum-amd64.txt":                 []byte("abc  rke2.linux-amd64.tar.gz\n"),
+	}
+	names := []string{"rke2-images-all.linux-amd64.txt", "rke2-images-all.linux-arm64.txt", "rke2-images.windows-amd64.txt"}
+
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{name: "tar"},
+		{name: "tar.gz", compress: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfs, err := NewTarFS(bytes.NewReader(tartest.Tarball(t, files, nil, tt.compress)), names)
+			if err != nil {
+				t.Fatalf("NewTarFS() error = %v", err)
+			}
+
+			content, err := fs.ReadFile(tfs, "rke2-images-all.linux-amd64.txt")
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if string(content) != "rancher/rke2-runtime:v1.30.2-rke2r1\n" {
+				t.Errorf("ReadFile() = %q", content)
+			}
+
+			entries, err := fs.ReadDir(tfs, ".")
+			if err != nil {
+				t.Fatalf("ReadDir() error = %v", err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("ReadDir() returned %d entries, want 2", len(entries))
+			}
+
+			if _, err := tfs.Open("rke2-images.windows-amd64.txt"); err == nil {
+				t.Error("Open() of a missing file error = nil")
+			}
+			if _, err := tfs.Open("sha256sum-amd64.txt"); err == nil {
+				t.Error("Open() of a file that wasn't asked for error = nil")
+			}
+		})
+	}
+
+	t.Run("duplicate names", func(t *testing.T) {
+		duplicates := map[string][]byte{
+			"amd64/k3s-images.txt": []byte("a"),
+			"arm64/k3s-images.txt": []byte("b"),
+		}
+		if _, err := NewTarFS(bytes.NewReader(tartest.Tarball(t, duplicates, nil, false)), []string{"k3s-images.txt"}); err == nil {
+			t.Error("NewTarFS() error = nil, want an error for the duplicate names")
+		}
+	})
+}
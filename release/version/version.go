@@ -0,0 +1,251 @@
+// Package version parses, compares and increments the release versions of
+// the products released with this tool.
+//
+// The supported formats are:
+//
+//	v2.9.0-rc1          rancher, rancher-prime, dashboard and ui
+//	v2.9.0-rc.1         cli
+//	v1.30.1-rc1+k3s1    k3s
+//	v1.30.1-rc1+rke2r1  rke2
+//	v1.30.1-k3s1        k3s-io/kubernetes and image-build upstream tags
+package version
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	versionRE = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+	// suffixRE splits an identifier such as rc1, rc.1, rke2r1 or
+	// k3s1-build20260415 into its label, number and the identifiers that
+	// follow the number.
+	suffixRE = regexp.MustCompile(`^([A-Za-z][0-9A-Za-z-]*?)(\.?)([1-9]\d*)([-.][0-9A-Za-z.-]*)?$`)
+)
+
+// Suffix is a pre-release or build metadata identifier made of a label and
+// an optional number, e.g. rc1, rc.1, k3s1 or rke2r1. The identifiers that
+// follow the number, e.g. -build20260415 in k3s1-build20260415, are kept in
+// Extra. Identifiers that don't follow that pattern, e.g. 0.dev, are kept
+// verbatim in Label.
+type Suffix struct {
+	Label  string
+	Number int
+	Dotted bool
+	Extra  string
+}
+
+func parseSuffix(s string) Suffix {
+	m := suffixRE.FindStringSubmatch(s)
+	if m == nil {
+		return Suffix{Label: s}
+	}
+
+	n, err := strconv.Atoi(m[3])
+	if err != nil {
+		return Suffix{Label: s}
+	}
+
+	return Suffix{
+		Label:  m[1],
+		Number: n,
+		Dotted: m[2] == ".",
+		Extra:  m[4],
+	}
+}
+
+// String returns the suffix as it appears in a version.
+func (s Suffix) String() string {
+	if s.Number == 0 {
+		return s.Label
+	}
+	if s.Dotted {
+		return s.Label + "." + strconv.Itoa(s.Number) + s.Extra
+	}
+	return s.Label + strconv.Itoa(s.Number) + s.Extra
+}
+
+// IsZero reports whether the suffix is empty.
+func (s Suffix) IsZero() bool {
+	return s == Suffix{}
+}
+
+func compareSuffix(a, b Suffix) int {
+	if a.Label != b.Label {
+		return strings.Compare(a.Label, b.Label)
+	}
+	if c := compareInt(uint64(a.Number), uint64(b.Number)); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Extra, b.Extra)
+}
+
+// Version is a semantic version with an optional numbered pre-release and
+// build metadata.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease Suffix
+	Metadata   Suffix
+}
+
+// Parse parses a version in any of the formats supported by this package.
+// The leading "v" is optional.
+func Parse(s string) (Version, error) {
+	m := versionRE.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, errors.New("invalid version: " + s)
+	}
+
+	var v Version
+	var err error
+	if v.Major, err = strconv.ParseUint(m[1], 10, 64); err != nil {
+		return Version{}, errors.New("invalid major version: " + s)
+	}
+	if v.Minor, err = strconv.ParseUint(m[2], 10, 64); err != nil {
+		return Version{}, errors.New("invalid minor version: " + s)
+	}
+	if v.Patch, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+		return Version{}, errors.New("invalid patch version: " + s)
+	}
+	if m[4] != "" {
+		v.PreRelease = parseSuffix(m[4])
+	}
+	if m[5] != "" {
+		v.Metadata = parseSuffix(m[5])
+	}
+
+	return v, nil
+}
+
+// String returns the version with a leading "v".
+func (v Version) String() string {
+	return v.Core() + v.suffixes()
+}
+
+// Core returns the version without pre-release and metadata, e.g. v1.30.1.
+func (v Version) Core() string {
+	return "v" + strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10) + "." + strconv.FormatUint(v.Patch, 10)
+}
+
+// MajorMinor returns the major and minor components, e.g. v1.30.
+func (v Version) MajorMinor() string {
+	return "v" + strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10)
+}
+
+func (v Version) suffixes() string {
+	var s string
+	if !v.PreRelease.IsZero() {
+		s += "-" + v.PreRelease.String()
+	}
+	if !v.Metadata.IsZero() {
+		s += "+" + v.Metadata.String()
+	}
+	return s
+}
+
+// IsPreRelease reports whether the version has a pre-release suffix.
+func (v Version) IsPreRelease() bool {
+	return !v.PreRelease.IsZero()
+}
+
+// Compare returns -1, 0 or 1 if v is lower, equal or greater than o.
+// A version without a pre-release is greater than any of its pre-releases.
+// Unlike semver, metadata is compared as well so that v1.30.1+rke2r1 sorts
+// before v1.30.1+rke2r2.
+func (v Version) Compare(o Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	switch {
+	case v.PreRelease.IsZero() && !o.PreRelease.IsZero():
+		return 1
+	case !v.PreRelease.IsZero() && o.PreRelease.IsZero():
+		return -1
+	}
+	if c := compareSuffix(v.PreRelease, o.PreRelease); c != 0 {
+		return c
+	}
+
+	return compareSuffix(v.Metadata, o.Metadata)
+}
+
+func compareInt(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Scheme describes how a product numbers its pre-releases and which build
+// metadata it appends to its versions.
+type Scheme struct {
+	// Dotted separates the pre-release label from its number, e.g. rc.1.
+	Dotted bool
+	// Metadata is appended to every version, e.g. k3s1 or rke2r1.
+	Metadata string
+}
+
+var (
+	// Rancher numbers pre-releases as v2.9.0-rc1 and v2.9.0-alpha1.
+	Rancher = Scheme{}
+	// Dashboard numbers pre-releases as v2.9.0-rc1, it's shared with ui.
+	Dashboard = Scheme{}
+	// CLI numbers pre-releases as v2.9.0-rc.1.
+	CLI = Scheme{Dotted: true}
+)
+
+// Distro returns the scheme of a k3s or rke2 release line with the given
+// suffix, e.g. v1.30.1-rc1+k3s1 or v1.30.1-rc1+rke2r1.
+func Distro(suffix string) Scheme {
+	return Scheme{Metadata: suffix}
+}
+
+// GA returns the GA version of v in this scheme.
+func (s Scheme) GA(v Version) Version {
+	v.PreRelease = Suffix{}
+	v.Metadata = parseMetadata(s.Metadata)
+	return v
+}
+
+// PreRelease returns the pre-release number n of v with the given label.
+func (s Scheme) PreRelease(v Version, label string, n int) Version {
+	v.PreRelease = Suffix{Label: label, Number: n, Dotted: s.Dotted}
+	v.Metadata = parseMetadata(s.Metadata)
+	return v
+}
+
+// Next returns the pre-release that follows latest, or the first pre-release
+// of v if latest is nil.
+func (s Scheme) Next(v Version, label string, latest *Version) (Version, error) {
+	if latest == nil {
+		return s.PreRelease(v, label, 1), nil
+	}
+
+	if latest.Core() != v.Core() || latest.PreRelease.Label != label || latest.PreRelease.Number == 0 {
+		return Version{}, errors.New("failed to parse " + label + " number from " + latest.String())
+	}
+
+	return s.PreRelease(v, label, latest.PreRelease.Number+1), nil
+}
+
+func parseMetadata(metadata string) Suffix {
+	if metadata == "" {
+		return Suffix{}
+	}
+	return parseSuffix(metadata)
+}
@@ -0,0 +1,260 @@
+package version
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		version string
+		want    Version
+		wantErr bool
+	}{
+		{
+			version: "v2.9.0",
+			want:    Version{Major: 2, Minor: 9},
+		},
+		{
+			version: "v2.9.0-rc1",
+			want:    Version{Major: 2, Minor: 9, PreRelease: Suffix{Label: "rc", Number: 1}},
+		},
+		{
+			version: "v2.9.0-alpha12",
+			want:    Version{Major: 2, Minor: 9, PreRelease: Suffix{Label: "alpha", Number: 12}},
+		},
+		{
+			version: "v2.9.0-rc.3",
+			want:    Version{Major: 2, Minor: 9, PreRelease: Suffix{Label: "rc", Number: 3, Dotted: true}},
+		},
+		{
+			version: "v1.30.1-rc2+k3s1",
+			want: Version{
+				Major: 1, Minor: 30, Patch: 1,
+				PreRelease: Suffix{Label: "rc", Number: 2},
+				Metadata:   Suffix{Label: "k3s", Number: 1},
+			},
+		},
+		{
+			version: "v1.30.1+rke2r2",
+			want:    Version{Major: 1, Minor: 30, Patch: 1, Metadata: Suffix{Label: "rke2r", Number: 2}},
+		},
+		{
+			version: "1.30.1-k3s1",
+			want:    Version{Major: 1, Minor: 30, Patch: 1, PreRelease: Suffix{Label: "k3s", Number: 1}},
+		},
+		{
+			version: "v3.24.2-0.dev",
+			want:    Version{Major: 3, Minor: 24, Patch: 2, PreRelease: Suffix{Label: "0.dev"}},
+		},
+		{
+			version: "v3.6.7-k3s1-build20260415",
+			want:    Version{Major: 3, Minor: 6, Patch: 7, PreRelease: Suffix{Label: "k3s", Number: 1, Extra: "-build20260415"}},
+		},
+		{
+			version: "v1.30.1-k3s1-build20260415.1",
+			want:    Version{Major: 1, Minor: 30, Patch: 1, PreRelease: Suffix{Label: "k3s", Number: 1, Extra: "-build20260415.1"}},
+		},
+		{
+			version: "v1.30",
+			wantErr: true,
+		},
+		{
+			version: "kubernetes-v1.30.1",
+			wantErr: true,
+		},
+		{
+			version: "v01.30.1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := Parse(tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []string{
+		"v2.9.0",
+		"v2.9.0-rc1",
+		"v2.9.0-rc.1",
+		"v1.30.1-rc1+k3s1",
+		"v1.30.1+rke2r1",
+		"v1.30.1-k3s1",
+		"v3.24.2-0.dev",
+		"v3.6.7-k3s1-build20260415",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			v, err := Parse(tt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := v.String(); got != tt {
+				t.Errorf("String() = %v, want %v", got, tt)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "v1.30.1", b: "v1.30.1", want: 0},
+		{a: "v1.30.1", b: "v1.30.2", want: -1},
+		{a: "v1.31.0", b: "v1.30.9", want: 1},
+		{a: "v2.0.0", b: "v1.99.99", want: 1},
+		{a: "v1.30.1-rc1", b: "v1.30.1", want: -1},
+		{a: "v1.30.1-rc2", b: "v1.30.1-rc10", want: -1},
+		{a: "v1.30.1-alpha1", b: "v1.30.1-rc1", want: -1},
+		{a: "v1.30.1+rke2r1", b: "v1.30.1+rke2r2", want: -1},
+		{a: "v1.30.1-rc1+k3s1", b: "v1.30.1+k3s1", want: -1},
+		{a: "v1.30.1-k3s1-build20260101", b: "v1.30.1-k3s2-build20250101", want: -1},
+		{a: "v1.30.1-k3s1-build20250101", b: "v1.30.1-k3s1-build20260101", want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := Parse(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Parse(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Compare(b); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemeNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		scheme  Scheme
+		version string
+		label   string
+		latest  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "rancher first rc",
+			scheme:  Rancher,
+			version: "v2.9.0",
+			label:   "rc",
+			want:    "v2.9.0-rc1",
+		},
+		{
+			name:    "rancher next alpha",
+			scheme:  Rancher,
+			version: "v2.9.0",
+			label:   "alpha",
+			latest:  "v2.9.0-alpha9",
+			want:    "v2.9.0-alpha10",
+		},
+		{
+			name:    "cli next rc",
+			scheme:  CLI,
+			version: "v2.9.0",
+			label:   "rc",
+			latest:  "v2.9.0-rc.1",
+			want:    "v2.9.0-rc.2",
+		},
+		{
+			name:    "dashboard next rc",
+			scheme:  Dashboard,
+			version: "v2.9.0",
+			label:   "rc",
+			latest:  "v2.9.0-rc4",
+			want:    "v2.9.0-rc5",
+		},
+		{
+			name:    "k3s next rc",
+			scheme:  Distro("k3s1"),
+			version: "v1.30.1",
+			label:   "rc",
+			latest:  "v1.30.1-rc1+k3s1",
+			want:    "v1.30.1-rc2+k3s1",
+		},
+		{
+			name:    "rke2 first rc",
+			scheme:  Distro("rke2r2"),
+			version: "v1.30.1",
+			label:   "rc",
+			want:    "v1.30.1-rc1+rke2r2",
+		},
+		{
+			name:    "different core",
+			scheme:  Rancher,
+			version: "v2.9.1",
+			label:   "rc",
+			latest:  "v2.9.0-rc1",
+			wantErr: true,
+		},
+		{
+			name:    "different label",
+			scheme:  Rancher,
+			version: "v2.9.0",
+			label:   "rc",
+			latest:  "v2.9.0-alpha1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Parse(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var latest *Version
+			if tt.latest != "" {
+				l, err := Parse(tt.latest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				latest = &l
+			}
+
+			got, err := tt.scheme.Next(v, tt.label, latest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Next() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemeGA(t *testing.T) {
+	v, err := Parse("v1.30.1-rc3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Distro("k3s2").GA(v).String(); got != "v1.30.1+k3s2" {
+		t.Errorf("GA() = %v, want v1.30.1+k3s2", got)
+	}
+	if got := Rancher.GA(v).String(); got != "v1.30.1" {
+		t.Errorf("GA() = %v, want v1.30.1", got)
+	}
+}
@@ -74,3 +74,14 @@ func SplitOwnerRepo(ownerRepo string) (string, string, error) {
 
 	return ss[0], ss[1], nil
 }
+
+// OwnerRepoFromURL returns the owner and name of a GitHub repository from
+// its https or ssh URL, e.g. https://github.com/rancher/rke2-packaging.
+func OwnerRepoFromURL(url string) (string, string, error) {
+	ownerRepo, ok := strings.CutPrefix(normalizeGitURL(url), "github.com/")
+	if !ok {
+		return "", "", errors.New("not a github repository url: " + url)
+	}
+
+	return SplitOwnerRepo(ownerRepo)
+}
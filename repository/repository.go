@@ -78,6 +78,7 @@ type CreateRefOpts struct {
 	Repo   string `json:"repo"`
 	Tag    string `json:"tag"`
 	Branch string `json:"branch"`
+	SHA    string `json:"sha"` // takes precedence over the head of Branch when set
 }
 
 func ListReleases(ctx context.Context, client *github.Client, owner, repo string) ([]*github.RepositoryRelease, error) {
@@ -142,13 +143,16 @@ func CreateRef(ctx context.Context, client *github.Client, cro *CreateRefOpts) (
 		return nil, errors.New("CreateReleaseOpts cannot be nil")
 	}
 
-	branchRefStr := "heads/" + cro.Branch
-	branchRef, _, err := client.Git.GetRef(ctx, cro.Owner, cro.Repo, branchRefStr)
-	if err != nil {
-		return nil, err
+	commitSHA := cro.SHA
+	if commitSHA == "" {
+		branchRefStr := "heads/" + cro.Branch
+		branchRef, _, err := client.Git.GetRef(ctx, cro.Owner, cro.Repo, branchRefStr)
+		if err != nil {
+			return nil, err
+		}
+		commitSHA = branchRef.Object.GetSHA()
 	}
 
-	commitSHA := branchRef.Object.GetSHA()
 	tagRefStr := "refs/tags/" + cro.Tag
 	newRef := github.CreateRef{
 		Ref: tagRefStr,
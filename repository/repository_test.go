@@ -149,3 +149,28 @@ func TestUpstreamRemote(t *testing.T) {
 		})
 	}
 }
+
+func TestOwnerRepoFromURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		wantOwner string
+		wantRepo  string
+		wantErr   bool
+	}{
+		{url: "https://github.com/rancher/rke2-packaging", wantOwner: "rancher", wantRepo: "rke2-packaging"},
+		{url: "git@github.com:k3s-io/k3s-upgrade.git", wantOwner: "k3s-io", wantRepo: "k3s-upgrade"},
+		{url: "https://gitlab.com/rancher/rke2", wantErr: true},
+		{url: "https://github.com/rancher", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			owner, repo, err := OwnerRepoFromURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OwnerRepoFromURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("OwnerRepoFromURL() = %s/%s, want %s/%s", owner, repo, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+}